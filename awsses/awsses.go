@@ -1,12 +1,18 @@
 package awsses
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ses"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/naughtygopher/verifier"
 )
 
 const (
@@ -19,15 +25,32 @@ type Config struct {
 	AccessKey  string
 	Secret     string
 	HTTPClient *http.Client
+	// TracerProvider is used to trace the API calls, the global tracer provider is used if not set
+	TracerProvider trace.TracerProvider
 }
 
 // AWSSES struct exposes all the services provided by this package
 type AWSSES struct {
-	cfg *Config
-	ses *ses.SES
+	cfg    *Config
+	ses    *ses.SES
+	tracer trace.Tracer
 }
 
 func (awsses *AWSSES) emailInput(sender, recipient, subject, htmlbody, textbody string) *ses.SendEmailInput {
+	body := &ses.Body{}
+	if htmlbody != "" {
+		body.Html = &ses.Content{
+			Charset: aws.String(charset),
+			Data:    aws.String(htmlbody),
+		}
+	}
+	if textbody != "" {
+		body.Text = &ses.Content{
+			Charset: aws.String(charset),
+			Data:    aws.String(textbody),
+		}
+	}
+
 	return &ses.SendEmailInput{
 		Destination: &ses.Destination{
 			CcAddresses: []*string{},
@@ -36,16 +59,7 @@ func (awsses *AWSSES) emailInput(sender, recipient, subject, htmlbody, textbody
 			},
 		},
 		Message: &ses.Message{
-			Body: &ses.Body{
-				Html: &ses.Content{
-					Charset: aws.String(charset),
-					Data:    aws.String(htmlbody),
-				},
-				// Text: &ses.Content{
-				// 	Charset: aws.String(charset),
-				// 	Data:    aws.String(textbody),
-				// },
-			},
+			Body: body,
 			Subject: &ses.Content{
 				Charset: aws.String(charset),
 				Data:    aws.String(subject),
@@ -55,11 +69,39 @@ func (awsses *AWSSES) emailInput(sender, recipient, subject, htmlbody, textbody
 	}
 }
 
-// Send sends an email
-func (awsses *AWSSES) Send(sender, recipient, subject, body string) (interface{}, error) {
-	inp := awsses.emailInput(sender, recipient, subject, body, "")
-	result, err := awsses.ses.SendEmail(inp)
+// Name returns the name of the provider, used in metrics
+func (awsses *AWSSES) Name() string {
+	return "awsses"
+}
+
+// Send sends an email with an HTML body
+func (awsses *AWSSES) Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error) {
+	return awsses.send(ctx, sender, recipient, subject, body, "")
+}
+
+// SendMultipart sends an email with an HTML body & its plain text alternative
+func (awsses *AWSSES) SendMultipart(ctx context.Context, sender, recipient, subject, htmlBody, textBody string) (interface{}, error) {
+	return awsses.send(ctx, sender, recipient, subject, htmlBody, textBody)
+}
+
+func (awsses *AWSSES) send(ctx context.Context, sender, recipient, subject, htmlBody, textBody string) (interface{}, error) {
+	ctx, span := awsses.tracer.Start(
+		ctx,
+		"awsses.SendEmail",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			verifier.AttrProvider.String(awsses.Name()),
+			verifier.AttrRecipient.String(verifier.RedactRecipient(recipient)),
+			attribute.String("cloud.region", awsses.cfg.Region),
+		),
+	)
+	defer span.End()
+
+	inp := awsses.emailInput(sender, recipient, subject, htmlBody, textBody)
+	result, err := awsses.ses.SendEmailWithContext(ctx, inp)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 	return result, nil
@@ -80,8 +122,9 @@ func NewService(cfg *Config) (*AWSSES, error) {
 	}
 
 	awsses := &AWSSES{
-		cfg: cfg,
-		ses: ses.New(sess),
+		cfg:    cfg,
+		tracer: verifier.Tracer(cfg.TracerProvider, verifier.TracerName+"/awsses"),
+		ses:    ses.New(sess),
 	}
 
 	return awsses, nil
@@ -1,12 +1,18 @@
 package awssns
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/naughtygopher/verifier"
 )
 
 // Config holds all the configurations required for AWS SES to function
@@ -15,23 +21,54 @@ type Config struct {
 	AccessKey  string
 	Secret     string
 	HTTPClient *http.Client
+	// TracerProvider is used to trace the API calls, the global tracer provider is used if not set
+	TracerProvider trace.TracerProvider
 }
 
 // AWSSNS struct exposes all the services provided by this package
 type AWSSNS struct {
-	cfg *Config
-	sns *sns.SNS
+	cfg    *Config
+	sns    *sns.SNS
+	tracer trace.Tracer
+}
+
+// Name returns the name of the provider, used in metrics
+func (awssns *AWSSNS) Name() string {
+	return "awssns"
 }
 
-// Send sends a transactional SMS using AWS SNS service
-func (awssns *AWSSNS) Send(recipient string, body string) (interface{}, error) {
+// Send sends a transactional SMS using AWS SNS service. The sender ID set in the context using
+// verifier.WithSenderID is used, in the countries supporting sender IDs
+func (awssns *AWSSNS) Send(ctx context.Context, recipient string, body string) (interface{}, error) {
 	params := &sns.PublishInput{
 		Message:     aws.String(body),
 		PhoneNumber: aws.String(recipient),
 	}
+	if senderID := verifier.SenderIDFromContext(ctx); senderID != "" {
+		params.MessageAttributes = map[string]*sns.MessageAttributeValue{
+			"AWS.SNS.SMS.SenderID": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(senderID),
+			},
+		}
+	}
+
+	ctx, span := awssns.tracer.Start(
+		ctx,
+		"awssns.Publish",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			verifier.AttrProvider.String(awssns.Name()),
+			verifier.AttrRecipient.String(verifier.RedactRecipient(recipient)),
+			attribute.String("cloud.region", awssns.cfg.Region),
+		),
+	)
+	defer span.End()
 
-	resp, err := awssns.sns.Publish(params)
+	resp, err := awssns.sns.PublishWithContext(ctx, params)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
@@ -55,8 +92,9 @@ func NewService(cfg *Config) (*AWSSNS, error) {
 	svc := sns.New(sess)
 
 	awssns := &AWSSNS{
-		cfg: cfg,
-		sns: svc,
+		cfg:    cfg,
+		tracer: verifier.Tracer(cfg.TracerProvider, verifier.TracerName+"/awssns"),
+		sns:    svc,
 	}
 
 	return awssns, nil
@@ -1,18 +1,51 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
 	"github.com/naughtygopher/verifier"
 	"github.com/naughtygopher/verifier/awsses"
 	"github.com/naughtygopher/verifier/awssns"
+	"github.com/naughtygopher/verifier/failover"
+	"github.com/naughtygopher/verifier/metrics"
+	"github.com/naughtygopher/verifier/ratelimit"
+	"github.com/naughtygopher/verifier/smsrouter"
+	"github.com/naughtygopher/verifier/smtp"
 	"github.com/naughtygopher/verifier/stores"
+	"github.com/naughtygopher/verifier/twilio"
+	"github.com/naughtygopher/verifier/webhook"
 )
 
+// env returns the value of the environment variable, or the fallback if it's not set
+func env(key, fallback string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
 func newHTTPClient() *http.Client {
 	return &http.Client{
 		Transport: &http.Transport{
@@ -27,25 +60,195 @@ func newHTTPClient() *http.Client {
 
 func mailmobileConfig() (*awsses.Config, *awssns.Config) {
 	httpClient := newHTTPClient()
+	region := env("AWS_REGION", "us-west-2")
 	return &awsses.Config{
-			Region:     "us-west-2",
+			Region:     region,
 			AccessKey:  os.Getenv("AWSSES_AK"),
 			Secret:     os.Getenv("AWSSES_SEC"),
 			HTTPClient: httpClient,
 		},
 		&awssns.Config{
-			Region:     "us-west-2",
+			Region:     region,
 			AccessKey:  os.Getenv("AWSSES_AK"),
 			Secret:     os.Getenv("AWSSES_SEC"),
 			HTTPClient: httpClient,
 		}
 }
 
+func smtpConfig() *smtp.Config {
+	return &smtp.Config{
+		Host:     env("SMTP_HOST", "localhost"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		Auth:     smtp.AuthMechanism(strings.ToUpper(os.Getenv("SMTP_AUTH"))),
+		Security: smtp.Security(os.Getenv("SMTP_SECURITY")),
+	}
+}
+
+// emailService is the provider used to send verification emails
+type emailService interface {
+	Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error)
+}
+
+// newEmailProvider returns the email provider of the name
+func newEmailProvider(name string) (failover.EmailService, error) {
+	switch name {
+	case "awsses":
+		mailCfg, _ := mailmobileConfig()
+		return awsses.NewService(mailCfg)
+
+	case "smtp":
+		return smtp.NewService(smtpConfig())
+	}
+
+	return nil, fmt.Errorf("unknown email provider '%s', supported providers are 'awsses' & 'smtp'", name)
+}
+
+// newEmailService returns the email provider chosen using the environment variable
+// VERIFIER_EMAIL_PROVIDER. If it's a comma separated list of providers, they're used as a
+// failover chain configured using VERIFIER_EMAIL_FAILOVER_STRATEGY & VERIFIER_EMAIL_FAILOVER_WEIGHTS
+func newEmailService() (emailService, error) {
+	names := strings.Split(env("VERIFIER_EMAIL_PROVIDER", "awsses"), ",")
+	providers := make([]failover.EmailService, 0, len(names))
+	for _, name := range names {
+		provider, err := newEmailProvider(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+
+	cfg, err := failoverConfig("VERIFIER_EMAIL_FAILOVER_STRATEGY", "VERIFIER_EMAIL_FAILOVER_WEIGHTS")
+	if err != nil {
+		return nil, err
+	}
+
+	return failover.NewEmail(cfg, providers...)
+}
+
+// failoverConfig returns the failover configuration set using the environment variables. Weights
+// are a comma separated list, in the same order as the providers
+func failoverConfig(strategyKey, weightsKey string) (*failover.Config, error) {
+	cfg := &failover.Config{
+		Strategy: failover.Strategy(env(strategyKey, string(failover.Priority))),
+	}
+
+	weights := os.Getenv(weightsKey)
+	if weights == "" {
+		return cfg, nil
+	}
+
+	for _, weight := range strings.Split(weights, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", weightsKey, err)
+		}
+		cfg.Weights = append(cfg.Weights, w)
+	}
+
+	return cfg, nil
+}
+
+func twilioConfig() *twilio.Config {
+	return &twilio.Config{
+		AccountSID:          os.Getenv("TWILIO_ACCOUNT_SID"),
+		AuthToken:           os.Getenv("TWILIO_AUTH_TOKEN"),
+		From:                os.Getenv("TWILIO_FROM"),
+		MessagingServiceSID: os.Getenv("TWILIO_MESSAGING_SERVICE_SID"),
+		StatusCallbackURL:   os.Getenv("TWILIO_STATUS_CALLBACK_URL"),
+		HTTPClient:          newHTTPClient(),
+	}
+}
+
+// mobileService is the provider used to send verification text messages
+type mobileService interface {
+	Send(ctx context.Context, recipient, body string) (interface{}, error)
+}
+
+// newMobileProvider returns the text message provider of the name
+func newMobileProvider(name string) (failover.MobileService, error) {
+	switch name {
+	case "awssns":
+		_, mobCfg := mailmobileConfig()
+		return awssns.NewService(mobCfg)
+
+	case "twilio":
+		return twilio.NewService(twilioConfig())
+	}
+
+	return nil, fmt.Errorf("unknown SMS provider '%s', supported providers are 'awssns' & 'twilio'", name)
+}
+
+// newSMSRouter returns a router, with the routing table loaded from the JSON file. The providers
+// in the routing table are referred by their names, e.g. 'awssns' or 'twilio'
+func newSMSRouter(path string) (*smsrouter.Router, error) {
+	table, err := smsrouter.LoadTable(path)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]smsrouter.Route, 0, len(table.Routes)+1)
+	if table.Default != nil {
+		routes = append(routes, *table.Default)
+	}
+	for _, route := range table.Routes {
+		routes = append(routes, route)
+	}
+
+	providers := make(map[string]smsrouter.MobileService, len(routes))
+	for _, route := range routes {
+		if providers[route.Provider] != nil {
+			continue
+		}
+		provider, err := newMobileProvider(route.Provider)
+		if err != nil {
+			return nil, err
+		}
+		providers[route.Provider] = provider
+	}
+
+	return smsrouter.New(table, providers)
+}
+
+// newMobileService returns the text message provider chosen using the environment variable
+// VERIFIER_SMS_PROVIDER. If it's a comma separated list of providers, they're used as a failover
+// chain configured using VERIFIER_SMS_FAILOVER_STRATEGY & VERIFIER_SMS_FAILOVER_WEIGHTS. If
+// VERIFIER_SMS_ROUTES is set, text messages are routed by the country of the recipient instead,
+// as per the routing table in the JSON file
+func newMobileService() (mobileService, error) {
+	if path := os.Getenv("VERIFIER_SMS_ROUTES"); path != "" {
+		return newSMSRouter(path)
+	}
+
+	names := strings.Split(env("VERIFIER_SMS_PROVIDER", "awssns"), ",")
+	providers := make([]failover.MobileService, 0, len(names))
+	for _, name := range names {
+		provider, err := newMobileProvider(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+
+	cfg, err := failoverConfig("VERIFIER_SMS_FAILOVER_STRATEGY", "VERIFIER_SMS_FAILOVER_WEIGHTS")
+	if err != nil {
+		return nil, err
+	}
+
+	return failover.NewMobile(cfg, providers...)
+}
+
 func redisConfig() *stores.RedisConfig {
 	return &stores.RedisConfig{
-		Hosts: []string{
-			"localhost:6379",
-		},
+		Hosts:        strings.Split(env("REDIS_HOSTS", "localhost:6379"), ","),
+		Password:     os.Getenv("REDIS_PASSWORD"),
 		DialTimeout:  time.Second * 3,
 		ReadTimeout:  time.Second * 1,
 		WriteTimeout: time.Second * 2,
@@ -54,11 +257,12 @@ func redisConfig() *stores.RedisConfig {
 
 func postgresConfig() *stores.PostgresConfig {
 	return &stores.PostgresConfig{
-		Host:      "localhost",
-		Port:      "5432",
-		Username:  "user1",
-		Password:  "password",
-		StoreName: "mydb",
+		Host:      env("POSTGRES_HOST", "localhost"),
+		Port:      env("POSTGRES_PORT", "5432"),
+		Username:  env("POSTGRES_USER", "user1"),
+		Password:  env("POSTGRES_PASSWORD", "password"),
+		StoreName: env("POSTGRES_DB", "mydb"),
+		SSLMode:   os.Getenv("POSTGRES_SSLMODE"),
 		PoolSize:  100,
 
 		DialTimeout:  time.Second * 10,
@@ -70,148 +274,391 @@ func postgresConfig() *stores.PostgresConfig {
 	}
 }
 
-func config() *verifier.Config {
+func config() (*verifier.Config, error) {
 	cfg := &verifier.Config{
-		DefaultEmailSub:  "",
-		DefaultFromEmail: "noreply@example.com",
-		EmailCallbackURL: "https://example.com/verify-email",
+		DefaultEmailSub:  os.Getenv("VERIFIER_EMAIL_SUBJECT"),
+		DefaultFromEmail: env("VERIFIER_FROM_EMAIL", "noreply@example.com"),
+		EmailCallbackURL: env("VERIFIER_CALLBACK_URL", "https://example.com/verify-email"),
 		EmailOTPExpiry:   time.Hour * 12,
 		MobileOTPExpiry:  time.Minute * 10,
+		OpaqueErrors:     os.Getenv("VERIFIER_OPAQUE_ERRORS") == "true",
+		// the email address is not exposed in the callback URL, if verified by ID
+		EmailCallbackWithID: os.Getenv("VERIFIER_CALLBACK_WITH_ID") == "true",
+		Logger:              slog.Default(),
+	}
+
+	if interval := os.Getenv("VERIFIER_RESEND_INTERVAL"); interval != "" {
+		resendInterval, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ResendInterval = resendInterval
 	}
-	return cfg
-}
 
-func notifyWithoutCustomRequest(vsvc *verifier.Verifier) {
-	const mobile = "+919876543210"
-	err := vsvc.NewMobile(mobile)
+	if maxResends := os.Getenv("VERIFIER_MAX_RESENDS"); maxResends != "" {
+		max, err := strconv.Atoi(maxResends)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MaxResends = max
+	}
+
+	// the default templates are used if a directory is not provided
+	if dir := os.Getenv("VERIFIER_TEMPLATES_DIR"); dir != "" {
+		tmpls, err := verifier.ParseLocalizedTemplates(os.DirFS(dir), env("VERIFIER_DEFAULT_LOCALE", "en"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Templates = tmpls
+	}
+
+	locales, err := callingCodeLocales()
 	if err != nil {
-		println(err.Error())
-		return
+		return nil, err
+	}
+	if len(locales) > 0 {
+		cfg.LocaleResolver = locales
+	}
+
+	// secrets are stored in plain text if pepper is not provided
+	pepper := os.Getenv("VERIFIER_SECRET_PEPPER")
+	if pepper != "" {
+		hasher, err := verifier.NewHMACHasher([]byte(pepper))
+		if err != nil {
+			return nil, err
+		}
+		cfg.SecretHasher = hasher
 	}
 
-	const email = "john.doe@example.com"
-	err = vsvc.NewEmail(email, "")
+	limits, err := rateLimits()
 	if err != nil {
-		println(err.Error())
-		return
+		return nil, err
+	}
+	cfg.RateLimits = *limits
+
+	if concurrency := os.Getenv("VERIFIER_SEND_CONCURRENCY"); concurrency != "" {
+		cfg.SendWorkers.Concurrency, err = strconv.Atoi(concurrency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if maxAttempts := os.Getenv("VERIFIER_SEND_MAX_ATTEMPTS"); maxAttempts != "" {
+		cfg.SendWorkers.MaxAttempts, err = strconv.Atoi(maxAttempts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// callingCodeLocales parses the locales of country calling codes, of the format
+// '<calling code>=<locale>' separated by commas (e.g. '+55=pt-BR,+33=fr')
+func callingCodeLocales() (verifier.CallingCodeLocales, error) {
+	value := os.Getenv("VERIFIER_CALLING_CODE_LOCALES")
+	locales := verifier.CallingCodeLocales{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		code, locale, ok := strings.Cut(pair, "=")
+		if !ok || !strings.HasPrefix(code, "+") || locale == "" {
+			return nil, fmt.Errorf("invalid calling code locale '%s', expected <calling code>=<locale>", pair)
+		}
+		locales[code] = locale
+	}
+	return locales, nil
+}
+
+// rateLimit parses a rate limit of the format '<max>/<window>' (e.g. '5/1h') from the environment
+// variable, or the fallback if it's not set. A limit is disabled if set to 'off'
+func rateLimit(key, fallback string) (verifier.RateLimit, error) {
+	value := env(key, fallback)
+	if value == "off" {
+		return verifier.RateLimit{}, nil
+	}
+
+	max, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return verifier.RateLimit{}, fmt.Errorf("invalid rate limit '%s' of %s, expected <max>/<window>", value, key)
 	}
 
-	err = vsvc.VerifyMobileSecret(mobile, "secret")
+	limit := verifier.RateLimit{}
+	var err error
+	limit.Max, err = strconv.Atoi(max)
 	if err != nil {
-		println(err.Error())
-		return
+		return verifier.RateLimit{}, fmt.Errorf("invalid rate limit '%s' of %s: %w", value, key, err)
 	}
 
-	err = vsvc.VerifyEmailSecret(email, "secret")
+	limit.Window, err = time.ParseDuration(window)
 	if err != nil {
-		println(err.Error())
-		return
+		return verifier.RateLimit{}, fmt.Errorf("invalid rate limit '%s' of %s: %w", value, key, err)
 	}
+
+	return limit, nil
 }
 
-func notifyWithCustomRequest(vsvc *verifier.Verifier) {
-	req, err := vsvc.NewRequest(
-		verifier.CommTypeMobile,
-		"+919876543210",
-	)
+func rateLimits() (*verifier.RateLimits, error) {
+	limits := &verifier.RateLimits{}
+	var err error
+
+	limits.Recipient, err = rateLimit("VERIFIER_RATELIMIT_RECIPIENT", "5/1h")
 	if err != nil {
-		println(err.Error())
-		return
+		return nil, err
 	}
 
-	err = vsvc.NewMobileWithReq(
-		req,
-		fmt.Sprintf(
-			verifier.DefaultSMSOTPPayload,
-			req.Secret,
-			req.SecretExpiry.String(),
-		),
-	)
+	limits.Client, err = rateLimit("VERIFIER_RATELIMIT_CLIENT", "20/1h")
 	if err != nil {
-		println(err.Error())
-		return
+		return nil, err
 	}
 
-	err = vsvc.VerifyMobileSecret(req.Recipient, req.Secret)
+	limits.Country, err = rateLimit("VERIFIER_RATELIMIT_COUNTRY", "off")
 	if err != nil {
-		println(err.Error())
-		return
+		return nil, err
 	}
 
-	req, err = vsvc.NewRequest(
-		verifier.CommTypeEmail,
-		"john.doe@example.com",
-	)
+	limits.Global, err = rateLimit("VERIFIER_RATELIMIT_GLOBAL", "off")
 	if err != nil {
-		println(err.Error())
-		return
+		return nil, err
 	}
 
-	err = vsvc.NewEmailWithReq(
-		req,
-		"verify your email",
-		fmt.Sprintf(
-			verifier.DefaultEmailOTPPayload,
-			req.Secret,
-			req.SecretExpiry.String(),
-		),
-	)
+	return limits, nil
+}
+
+// newVerifier initializes verifier with the store chosen using the environment variable VERIFIER_STORE
+func newVerifier(mailservice emailService, mobService mobileService, reg prometheus.Registerer) (*verifier.Verifier, error) {
+	cfg, err := config()
 	if err != nil {
-		println(err.Error())
-		return
+		return nil, err
 	}
 
-	err = vsvc.VerifyEmailSecret(req.Recipient, req.Secret)
+	cfg.Metrics, err = metrics.NewPrometheus(reg)
 	if err != nil {
-		println(err.Error())
-		return
+		return nil, err
 	}
+
+	// rate limits are applied per instance, unless redis is used as the store
+	cfg.RateLimiter = ratelimit.NewMemory()
+
+	// sends are queued in memory, unless postgres is used as the store
+	async := os.Getenv("VERIFIER_ASYNC_SENDS") == "true"
+	if async {
+		cfg.SendQueue = stores.NewMemoryQueue()
+	}
+
+	switch env("VERIFIER_STORE", "postgres") {
+	case "memory":
+		return verifier.New(cfg, stores.NewMemory(nil), mailservice, mobService)
+
+	case "redis":
+		rediscfg := redisConfig()
+		redisstore, err := stores.NewRedis(rediscfg)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.RateLimiter = ratelimit.NewRedis(stores.NewRedisClient(rediscfg))
+		return verifier.New(cfg, redisstore, mailservice, mobService)
+
+	case "postgres":
+		postgrestore, err := stores.NewPostgres(postgresConfig())
+		if err != nil {
+			return nil, err
+		}
+
+		if async {
+			cfg.SendQueue, err = stores.NewPostgresQueue(postgresConfig())
+			if err != nil {
+				return nil, err
+			}
+		}
+		return verifier.New(cfg, postgrestore, mailservice, mobService)
+	}
+
+	return nil, errors.New("unknown store, supported stores are 'postgres', 'redis' & 'memory'")
+}
+
+// newWebhooks returns the webhook dispatcher for the URLs in VERIFIER_WEBHOOK_URLS, or nil if none
+// are configured. Pending deliveries are persisted in VERIFIER_WEBHOOK_DIR, so they survive restarts
+func newWebhooks() (*webhook.Dispatcher, error) {
+	urls := os.Getenv("VERIFIER_WEBHOOK_URLS")
+	if urls == "" {
+		return nil, nil
+	}
+
+	secret := os.Getenv("VERIFIER_WEBHOOK_SECRET")
+	cfg := &webhook.Config{
+		HTTPClient: newHTTPClient(),
+		OnError: func(err error) {
+			slog.Error("webhook delivery failed", "error", err)
+		},
+	}
+	for _, url := range strings.Split(urls, ",") {
+		cfg.Endpoints = append(cfg.Endpoints, webhook.Endpoint{
+			URL:    strings.TrimSpace(url),
+			Secret: secret,
+		})
+	}
+
+	store, err := webhook.NewFileStore(env("VERIFIER_WEBHOOK_DIR", "webhooks"))
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook.New(cfg, store)
+}
+
+// setupTracing sets the global tracer provider to export spans using OTLP over HTTP, if an OTLP
+// endpoint is configured using the standard OpenTelemetry environment variables. The returned
+// function flushes the pending spans & stops the provider
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return tp.Shutdown, nil
+}
+
+// newLogger returns a JSON logger, of the level set in VERIFIER_LOG_LEVEL (default info)
+func newLogger() (*slog.Logger, error) {
+	level := slog.LevelInfo
+	err := level.UnmarshalText([]byte(env("VERIFIER_LOG_LEVEL", "info")))
+	if err != nil {
+		return nil, err
+	}
+
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})), nil
 }
 
 func main() {
+	logger, err := newLogger()
+	if err != nil {
+		slog.Error("invalid log level", "error", err)
+		return
+	}
+	slog.SetDefault(logger)
 
-	mailCfg, mobCfg := mailmobileConfig()
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		logger.Error("failed setting up tracing", "error", err)
+		return
+	}
 
-	mailservice, err := awsses.NewService(mailCfg)
+	mailservice, err := newEmailService()
 	if err != nil {
-		println(err.Error())
+		logger.Error("failed initializing email service", "error", err)
 		return
 	}
 
-	mobService, err := awssns.NewService(mobCfg)
+	mobService, err := newMobileService()
 	if err != nil {
-		println(err.Error())
+		logger.Error("failed initializing mobile service", "error", err)
 		return
 	}
 
-	// redisstore, err := stores.NewRedis(redisConfig())
-	// if err != nil {
-	// 	println(err.Error())
-	// 	return
-	// }
-	// vsvc, err := verifier.New(
-	// 	config(),
-	// 	redisstore,
-	// 	mailservice,
-	// 	mobService,
-	// )
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
 
-	postgrestore, err := stores.NewPostgres(postgresConfig())
+	vsvc, err := newVerifier(mailservice, mobService, reg)
 	if err != nil {
-		println(err.Error())
+		logger.Error("failed initializing verifier", "error", err)
 		return
 	}
-	vsvc, err := verifier.New(
-		config(),
-		postgrestore,
-		mailservice,
-		mobService,
-	)
+
+	webhooks, err := newWebhooks()
 	if err != nil {
-		println(err.Error())
+		logger.Error("failed initializing webhooks", "error", err)
+		return
+	}
+	if webhooks != nil {
+		vsvc.AddObserver(webhooks)
+		webhooks.Start()
+	}
+
+	err = vsvc.StartSendWorkers()
+	if err != nil && !errors.Is(err, verifier.ErrNoSendQueue) {
+		logger.Error("failed starting send workers", "error", err)
 		return
 	}
 
-	notifyWithCustomRequest(vsvc)
-	// notifyWithoutCustomRequest(vsvc)
+	srv := newServer(
+		vsvc,
+		os.Getenv("VERIFIER_ADMIN_TOKEN"),
+		os.Getenv("VERIFIER_CLIENT_IP_HEADER"),
+	)
+	srv.metrics = promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	srv.logger = logger
+	if proxies := os.Getenv("VERIFIER_TRUSTED_PROXIES"); proxies != "" {
+		srv.trustedProxies, err = strconv.Atoi(proxies)
+		if err != nil {
+			logger.Error("invalid VERIFIER_TRUSTED_PROXIES", "error", err)
+			return
+		}
+	}
+
+	httpServer := &http.Server{
+		Addr:              env("VERIFIER_HTTP_ADDR", ":8080"),
+		Handler:           otelhttp.NewHandler(srv.routes(), "verifier"),
+		ReadHeaderTimeout: time.Second * 5,
+		ReadTimeout:       time.Second * 10,
+		WriteTimeout:      time.Second * 30,
+		IdleTimeout:       time.Minute,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		logger.Info("listening", "addr", httpServer.Addr)
+		err := httpServer.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed serving HTTP", "error", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	err = httpServer.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Error("failed shutting down HTTP server", "error", err)
+	}
+
+	// sends which are not sent yet remain in the Postgres queue & are attempted on the next start,
+	// whereas the ones queued in memory are lost
+	err = vsvc.StopSendWorkers(shutdownCtx)
+	if err != nil {
+		logger.Error("failed stopping send workers", "error", err)
+	}
+
+	if webhooks != nil {
+		// pending deliveries are attempted again on the next start
+		_ = webhooks.Close()
+	}
+
+	// closes the idle connections of the SMTP provider
+	if closer, ok := mailservice.(io.Closer); ok {
+		_ = closer.Close()
+	}
+
+	err = shutdownTracing(shutdownCtx)
+	if err != nil {
+		logger.Error("failed shutting down tracing", "error", err)
+	}
 }
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// errorResponse is the JSON body sent back for all failed API calls
+type errorResponse struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type newEmailRequest struct {
+	Recipient string `json:"recipient,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	Locale    string `json:"locale,omitempty"`
+}
+
+type newMobileRequest struct {
+	Recipient string `json:"recipient,omitempty"`
+	Locale    string `json:"locale,omitempty"`
+}
+
+type resendRequest struct {
+	Recipient string `json:"recipient,omitempty"`
+}
+
+type verifyRequest struct {
+	Recipient string `json:"recipient,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+}
+
+type verifyByIDRequest struct {
+	ID     string `json:"id,omitempty"`
+	Secret string `json:"secret,omitempty"`
+}
+
+type listResponse struct {
+	Requests []*verifier.Request `json:"requests"`
+}
+
+type statusResponse struct {
+	Status string `json:"status,omitempty"`
+}
+
+// requestStatusResponse is the status of the pending request of a recipient. The rest of the
+// request (e.g. CommStatus & Data) is not exposed, it's available using the admin APIs
+type requestStatusResponse struct {
+	Status       string     `json:"status,omitempty"`
+	SecretExpiry *time.Time `json:"secretExpiry,omitempty"`
+}
+
+// maxBodyBytes is the maximum size of request bodies, larger bodies are rejected without being
+// read entirely
+const maxBodyBytes = 1 << 20
+
+var (
+	// errBadRequest is returned when the request body or query string could not be parsed
+	errBadRequest = errors.New("invalid request payload")
+	// errPayloadTooLarge is returned when the request body is larger than maxBodyBytes
+	errPayloadTooLarge = errors.New("request payload too large")
+	// errUnauthorized is returned when the admin token is missing or invalid
+	errUnauthorized = errors.New("unauthorized")
+)
+
+// server exposes the verifier as an HTTP API
+type server struct {
+	vsvc *verifier.Verifier
+	// adminToken is the bearer token required for the admin APIs (status, get, list & cancel
+	// requests). The admin APIs are not available if it's not set
+	adminToken string
+	// clientIPHeader is the header which has the IP address of the client (e.g. X-Forwarded-For),
+	// when the server is behind a proxy. The remote address of the connection is used if not set
+	clientIPHeader string
+	// trustedProxies is the number of proxies in front of the server, which append the address
+	// they received the request from to the client IP header. 1 is used if not set
+	trustedProxies int
+	// metrics is the handler of the metrics endpoint, which is not available if it's not set
+	metrics http.Handler
+	// logger is used to log every request & response, nothing is logged if it's not set
+	logger *slog.Logger
+}
+
+// errStatus maps errors returned by verifier to HTTP status codes & error codes
+func errStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, errBadRequest):
+		return http.StatusBadRequest, "bad_request"
+	case errors.Is(err, errPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge, "payload_too_large"
+	case errors.Is(err, verifier.ErrInvalidEmail):
+		return http.StatusBadRequest, "invalid_email"
+	case errors.Is(err, verifier.ErrInvalidMobileNumber):
+		return http.StatusBadRequest, "invalid_mobile"
+	case errors.Is(err, verifier.ErrEmptyEmailBody),
+		errors.Is(err, verifier.ErrEmptyMobileMessageBody):
+		return http.StatusBadRequest, "empty_body"
+	case errors.Is(err, verifier.ErrInvalidSecret):
+		return http.StatusUnauthorized, "invalid_secret"
+	case errors.Is(err, verifier.ErrVerificationFailed):
+		return http.StatusUnauthorized, "verification_failed"
+	case errors.Is(err, verifier.ErrSecretExpired):
+		return http.StatusGone, "secret_expired"
+	case errors.Is(err, verifier.ErrMaximumAttemptsExceeded):
+		return http.StatusTooManyRequests, "maximum_attempts_exceeded"
+	case errors.Is(err, verifier.ErrResendTooSoon):
+		return http.StatusTooManyRequests, "resend_too_soon"
+	case errors.Is(err, verifier.ErrMaximumResendsExceeded):
+		return http.StatusTooManyRequests, "maximum_resends_exceeded"
+	case errors.Is(err, verifier.ErrRateLimited):
+		return http.StatusTooManyRequests, "rate_limited"
+	case errors.Is(err, verifier.ErrRequestNotPending):
+		return http.StatusConflict, "not_pending"
+	case errors.Is(err, errUnauthorized):
+		return http.StatusUnauthorized, "unauthorized"
+	case errors.Is(err, verifier.ErrNotFound):
+		return http.StatusNotFound, "not_found"
+	}
+
+	return http.StatusInternalServerError, "internal_error"
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status, code := errStatus(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		// internal errors might have details of the infrastructure, which should not be exposed
+		message = http.StatusText(status)
+	}
+
+	rlErr := &verifier.RateLimitError{}
+	if errors.As(err, &rlErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rlErr.RetryAfter.Seconds()))))
+	}
+
+	writeJSON(w, status, errorResponse{Code: code, Message: message})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, payload interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	err := json.NewDecoder(r.Body).Decode(payload)
+	if err != nil {
+		mbErr := &http.MaxBytesError{}
+		if errors.As(err, &mbErr) {
+			return errPayloadTooLarge
+		}
+		return errBadRequest
+	}
+	return nil
+}
+
+// withLocale returns the context with the locale, if provided
+func withLocale(ctx context.Context, locale string) context.Context {
+	if locale == "" {
+		return ctx
+	}
+	return verifier.WithLocale(ctx, locale)
+}
+
+func (s *server) newEmail(w http.ResponseWriter, r *http.Request) {
+	req := newEmailRequest{}
+	err := readJSON(w, r, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = s.vsvc.NewEmailContext(withLocale(r.Context(), req.Locale), req.Recipient, req.Subject)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, statusResponse{Status: "sent"})
+}
+
+func (s *server) newMobile(w http.ResponseWriter, r *http.Request) {
+	req := newMobileRequest{}
+	err := readJSON(w, r, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = s.vsvc.NewMobileContext(withLocale(r.Context(), req.Locale), req.Recipient)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, statusResponse{Status: "sent"})
+}
+
+// resend returns the handler to resend the secret of the last pending request of the commtype
+func (s *server) resend(ctype verifier.CommType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := resendRequest{}
+		err := readJSON(w, r, &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		err = s.vsvc.ResendContext(r.Context(), ctype, req.Recipient)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusAccepted, statusResponse{Status: "sent"})
+	}
+}
+
+func (s *server) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	req := verifyRequest{}
+	err := readJSON(w, r, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = s.vsvc.VerifyEmailSecretContext(r.Context(), req.Recipient, req.Secret)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statusResponse{Status: "verified"})
+}
+
+func (s *server) verifyMobile(w http.ResponseWriter, r *http.Request) {
+	req := verifyRequest{}
+	err := readJSON(w, r, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = s.vsvc.VerifyMobileSecretContext(r.Context(), req.Recipient, req.Secret)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statusResponse{Status: "verified"})
+}
+
+func (s *server) verifyByID(w http.ResponseWriter, r *http.Request) {
+	req := verifyByIDRequest{}
+	err := readJSON(w, r, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = s.vsvc.VerifyByIDContext(r.Context(), req.ID, req.Secret)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statusResponse{Status: "verified"})
+}
+
+func (s *server) status(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	ctype := verifier.CommType(query.Get("type"))
+	recipient := query.Get("recipient")
+	if recipient == "" || (ctype != verifier.CommTypeEmail && ctype != verifier.CommTypeMobile) {
+		writeError(w, errBadRequest)
+		return
+	}
+
+	verreq, err := s.vsvc.StatusContext(r.Context(), ctype, recipient)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, requestStatusResponse{
+		Status:       string(verreq.Status),
+		SecretExpiry: verreq.SecretExpiry,
+	})
+}
+
+// clientIP returns the IP address of the client which made the request. Clients can set any
+// addresses in the client IP header, and every proxy appends the address it received the request
+// from. So the address appended by the outermost trusted proxy, i.e. trustedProxies from the right,
+// is used; instead of the left most address which could be spoofed
+func (s *server) clientIP(r *http.Request) string {
+	if s.clientIPHeader != "" {
+		ips := make([]string, 0, 4)
+		for _, value := range r.Header.Values(s.clientIPHeader) {
+			for _, ip := range strings.Split(value, ",") {
+				ips = append(ips, strings.TrimSpace(ip))
+			}
+		}
+
+		hops := s.trustedProxies
+		if hops < 1 {
+			hops = 1
+		}
+		if hops > len(ips) {
+			// all the addresses were appended by the trusted proxies
+			hops = len(ips)
+		}
+		if hops > 0 && ips[len(ips)-hops] != "" {
+			return ips[len(ips)-hops]
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withClientKey sets the IP address of the client as the client key in the request context,
+// which is used for rate limiting
+func (s *server) withClientKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := verifier.WithClientKey(r.Context(), s.clientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// statusRecorder records the status code & the size of the response written
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.size += n
+	return n, err
+}
+
+// Unwrap returns the underlying response writer, for http.ResponseController
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// logRequests logs every request & its response. Only the path is logged and not the query string,
+// since it might have the recipient (e.g. /v1/status)
+func (s *server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("client", s.clientIP(r)),
+		}
+		s.logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		s.logger.LogAttrs(
+			r.Context(),
+			slog.LevelInfo,
+			"response",
+			append(
+				attrs,
+				slog.Int("status", rec.status),
+				slog.Int("size", rec.size),
+				slog.Duration("duration", time.Since(start)),
+			)...,
+		)
+	})
+}
+
+func (s *server) getRequest(w http.ResponseWriter, r *http.Request) {
+	verreq, err := s.vsvc.GetContext(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, verreq)
+}
+
+// oneOf returns the option which is equal to the value. It is used to parse values of types which
+// are not exported, but have exported constants
+func oneOf[T ~string](value string, options ...T) (T, bool) {
+	for _, option := range options {
+		if string(option) == value {
+			return option, true
+		}
+	}
+
+	var zero T
+	return zero, false
+}
+
+// listFilter parses the list filter from the query string
+func listFilter(r *http.Request) (verifier.ListFilter, error) {
+	query := r.URL.Query()
+	filter := verifier.ListFilter{
+		Type:      verifier.CommType(query.Get("type")),
+		Recipient: query.Get("recipient"),
+	}
+
+	if status := query.Get("status"); status != "" {
+		var ok bool
+		filter.Status, ok = oneOf(
+			status,
+			verifier.VerStatusPending,
+			verifier.VerStatusExpired,
+			verifier.VerStatusVerified,
+			verifier.VerStatusRejected,
+			verifier.VerStatusExceededAttempts,
+			verifier.VerStatusCancelled,
+		)
+		if !ok {
+			return filter, errBadRequest
+		}
+	}
+
+	for key, target := range map[string]**time.Time{"from": &filter.CreatedFrom, "to": &filter.CreatedTo} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, errBadRequest
+		}
+		*target = &t
+	}
+
+	for key, target := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		value := query.Get(key)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, errBadRequest
+		}
+		*target = n
+	}
+
+	return filter, nil
+}
+
+func (s *server) listRequests(w http.ResponseWriter, r *http.Request) {
+	filter, err := listFilter(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	reqs, err := s.vsvc.ListContext(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, listResponse{Requests: reqs})
+}
+
+func (s *server) cancelRequest(w http.ResponseWriter, r *http.Request) {
+	err := s.vsvc.CancelContext(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statusResponse{Status: "cancelled"})
+}
+
+// admin allows the request only if it has the admin token as the bearer token
+func (s *server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			writeError(w, errUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// routes returns the HTTP handler with all the API routes registered
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", s.health)
+	mux.HandleFunc("POST /v1/email", s.newEmail)
+	mux.HandleFunc("POST /v1/email/verify", s.verifyEmail)
+	mux.HandleFunc("POST /v1/email/resend", s.resend(verifier.CommTypeEmail))
+	mux.HandleFunc("POST /v1/mobile", s.newMobile)
+	mux.HandleFunc("POST /v1/mobile/verify", s.verifyMobile)
+	mux.HandleFunc("POST /v1/mobile/resend", s.resend(verifier.CommTypeMobile))
+	mux.HandleFunc("POST /v1/verify", s.verifyByID)
+
+	if s.metrics != nil {
+		mux.Handle("GET /metrics", s.metrics)
+	}
+
+	if s.adminToken != "" {
+		// status is an admin API, since it reveals if a recipient has a verification in progress
+		mux.HandleFunc("GET /v1/status", s.admin(s.status))
+		mux.HandleFunc("GET /v1/requests", s.admin(s.listRequests))
+		mux.HandleFunc("GET /v1/requests/{id}", s.admin(s.getRequest))
+		mux.HandleFunc("POST /v1/requests/{id}/cancel", s.admin(s.cancelRequest))
+	}
+
+	handler := s.withClientKey(mux)
+	if s.logger != nil {
+		handler = s.logRequests(handler)
+	}
+
+	return handler
+}
+
+func newServer(vsvc *verifier.Verifier, adminToken, clientIPHeader string) *server {
+	return &server{
+		vsvc:           vsvc,
+		adminToken:     adminToken,
+		clientIPHeader: clientIPHeader,
+	}
+}
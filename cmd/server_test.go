@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+	"github.com/naughtygopher/verifier/ratelimit"
+	"github.com/naughtygopher/verifier/stores"
+)
+
+type mockemail struct{}
+
+func (me *mockemail) Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error) {
+	return "message-id", nil
+}
+
+type mockmobile struct{}
+
+func (mm *mockmobile) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	return "message-id", nil
+}
+
+func newTestServer(t *testing.T) (*stores.Memory, http.Handler) {
+	verstore := stores.NewMemory(nil)
+	vsvc, err := verifier.New(
+		&verifier.Config{
+			EmailCallbackURL: "https://example.com/verify",
+			EmailOTPExpiry:   time.Minute,
+			MobileOTPExpiry:  time.Minute,
+			RateLimiter:      ratelimit.NewMemory(),
+			RateLimits: verifier.RateLimits{
+				Client: verifier.RateLimit{Max: 1, Window: time.Hour},
+			},
+		},
+		verstore,
+		&mockemail{},
+		&mockmobile{},
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+	return verstore, newServer(vsvc, "admin-token", "X-Forwarded-For").routes()
+}
+
+func TestServer_routes(t *testing.T) {
+	verstore, handler := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     http.Header
+		body       func() string
+		wantStatus int
+		wantCode   string
+		// wantBody is the expected prefix of the response body
+		wantBody string
+	}{
+		{
+			name:       "invalid payload",
+			method:     http.MethodPost,
+			path:       "/v1/mobile",
+			body:       func() string { return "{" },
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "bad_request",
+		},
+		{
+			name:   "payload too large",
+			method: http.MethodPost,
+			path:   "/v1/mobile",
+			body: func() string {
+				return `{"recipient":"+919876543210","locale":"` + strings.Repeat("a", maxBodyBytes) + `"}`
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   "payload_too_large",
+		},
+		{
+			name:       "invalid mobile",
+			method:     http.MethodPost,
+			path:       "/v1/mobile",
+			body:       func() string { return `{"recipient":"abc"}` },
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "invalid_mobile",
+		},
+		{
+			name:       "new mobile",
+			method:     http.MethodPost,
+			path:       "/v1/mobile",
+			body:       func() string { return `{"recipient":"+919876543210"}` },
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "status",
+			method:     http.MethodGet,
+			path:       "/v1/status?type=mobile&recipient=%2B919876543210",
+			header:     http.Header{"Authorization": []string{"Bearer admin-token"}},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"pending","secretExpiry":`,
+		},
+		{
+			name:       "status unauthorized",
+			method:     http.MethodGet,
+			path:       "/v1/status?type=mobile&recipient=%2B919876543210",
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "unauthorized",
+		},
+		{
+			name:       "resend too soon",
+			method:     http.MethodPost,
+			path:       "/v1/mobile/resend",
+			body:       func() string { return `{"recipient":"+919876543210"}` },
+			wantStatus: http.StatusTooManyRequests,
+			wantCode:   "resend_too_soon",
+		},
+		{
+			name:       "invalid secret",
+			method:     http.MethodPost,
+			path:       "/v1/mobile/verify",
+			body:       func() string { return `{"recipient":"+919876543210","secret":"abc"}` },
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "invalid_secret",
+		},
+		{
+			name:       "new email",
+			method:     http.MethodPost,
+			path:       "/v1/email",
+			body:       func() string { return `{"recipient":"john.doe@example.com"}` },
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:   "verify email",
+			method: http.MethodPost,
+			path:   "/v1/email/verify",
+			body: func() string {
+				verreq, err := verstore.ReadLastPending(
+					context.Background(),
+					verifier.CommTypeEmail,
+					"john.doe@example.com",
+				)
+				if err != nil {
+					t.Fatalf("failed reading request: %v", err)
+				}
+				return fmt.Sprintf(`{"recipient":"john.doe@example.com","secret":%q}`, verreq.Secret)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "rate limited",
+			method:     http.MethodPost,
+			path:       "/v1/mobile",
+			body:       func() string { return `{"recipient":"+919876543211"}` },
+			wantStatus: http.StatusTooManyRequests,
+			wantCode:   "rate_limited",
+		},
+		{
+			name:       "rate limited per client",
+			method:     http.MethodPost,
+			path:       "/v1/mobile",
+			header:     http.Header{"X-Forwarded-For": []string{"10.0.0.1, 10.0.0.2"}},
+			body:       func() string { return `{"recipient":"+919876543211"}` },
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "verify by ID not found",
+			method:     http.MethodPost,
+			path:       "/v1/verify",
+			body:       func() string { return `{"id":"unknown","secret":"abc"}` },
+			wantStatus: http.StatusNotFound,
+			wantCode:   "not_found",
+		},
+		{
+			name:       "list unauthorized",
+			method:     http.MethodGet,
+			path:       "/v1/requests?recipient=john.doe@example.com",
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "unauthorized",
+		},
+		{
+			name:       "list",
+			method:     http.MethodGet,
+			path:       "/v1/requests?recipient=john.doe@example.com&status=verified&limit=10",
+			header:     http.Header{"Authorization": []string{"Bearer admin-token"}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "list invalid status",
+			method:     http.MethodGet,
+			path:       "/v1/requests?status=unknown",
+			header:     http.Header{"Authorization": []string{"Bearer admin-token"}},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "bad_request",
+		},
+		{
+			name:       "get not found",
+			method:     http.MethodGet,
+			path:       "/v1/requests/unknown",
+			header:     http.Header{"Authorization": []string{"Bearer admin-token"}},
+			wantStatus: http.StatusNotFound,
+			wantCode:   "not_found",
+		},
+		{
+			name:       "status not found",
+			method:     http.MethodGet,
+			path:       "/v1/status?type=email&recipient=john.doe@example.com",
+			header:     http.Header{"Authorization": []string{"Bearer admin-token"}},
+			wantStatus: http.StatusNotFound,
+			wantCode:   "not_found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := ""
+			if tt.body != nil {
+				body = tt.body()
+			}
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d (%s)", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+
+			if tt.wantBody != "" && !strings.HasPrefix(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("expected body to start with '%s', got '%s'", tt.wantBody, rec.Body.String())
+			}
+
+			if tt.wantCode == "rate_limited" && rec.Header().Get("Retry-After") == "" {
+				t.Fatalf("expected Retry-After header to be set")
+			}
+
+			if tt.wantCode == "" {
+				return
+			}
+
+			errResp := errorResponse{}
+			err := json.NewDecoder(rec.Body).Decode(&errResp)
+			if err != nil {
+				t.Fatalf("failed decoding error response: %v", err)
+			}
+			if errResp.Code != tt.wantCode {
+				t.Fatalf("expected error code '%s', got '%s'", tt.wantCode, errResp.Code)
+			}
+		})
+	}
+}
+
+func TestServer_cancel(t *testing.T) {
+	verstore, handler := newTestServer(t)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/v1/mobile", `{"recipient":"+919876543210"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d (%s)", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+
+	verreq, err := verstore.ReadLastPending(context.Background(), verifier.CommTypeMobile, "+919876543210")
+	if err != nil {
+		t.Fatalf("failed reading request: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "cancel", method: http.MethodPost, path: "/v1/requests/" + verreq.ID + "/cancel", wantStatus: http.StatusOK},
+		{name: "cancel again", method: http.MethodPost, path: "/v1/requests/" + verreq.ID + "/cancel", wantStatus: http.StatusConflict},
+		{name: "get", method: http.MethodGet, path: "/v1/requests/" + verreq.ID, wantStatus: http.StatusOK},
+		{name: "list", method: http.MethodGet, path: "/v1/requests?status=cancelled", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.method, tt.path, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d (%s)", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	list := listResponse{}
+	rec = serve(http.MethodGet, "/v1/requests?status=cancelled", "")
+	err = json.NewDecoder(rec.Body).Decode(&list)
+	if err != nil {
+		t.Fatalf("failed decoding list response: %v", err)
+	}
+	if len(list.Requests) != 1 || list.Requests[0].ID != verreq.ID {
+		t.Fatalf("expected the cancelled request to be listed, got %v", list.Requests)
+	}
+	if list.Requests[0].Secret != "" {
+		t.Fatalf("expected secret to be removed from the listed request")
+	}
+}
+
+func TestServer_logRequests(t *testing.T) {
+	vsvc, err := verifier.New(&verifier.Config{}, stores.NewMemory(nil), &mockemail{}, &mockmobile{})
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	srv := newServer(vsvc, "", "")
+	srv.logger = slog.New(slog.NewJSONHandler(buf, nil))
+	handler := srv.routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/status?type=mobile&recipient=%2B919876543210", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if strings.Contains(buf.String(), "919876543210") {
+		t.Fatalf("expected the query string not to be logged, got %s", buf.String())
+	}
+
+	type logLine struct {
+		Msg    string `json:"msg"`
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Status int    `json:"status"`
+	}
+	want := []logLine{
+		{Msg: "request", Method: http.MethodGet, Path: "/v1/status"},
+		{Msg: "response", Method: http.MethodGet, Path: "/v1/status", Status: http.StatusNotFound},
+		{Msg: "request", Method: http.MethodGet, Path: "/health"},
+		{Msg: "response", Method: http.MethodGet, Path: "/health", Status: http.StatusOK},
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d log lines, got %d: %s", len(want), len(lines), buf.String())
+	}
+	for i, line := range lines {
+		got := logLine{}
+		err := json.Unmarshal([]byte(line), &got)
+		if err != nil {
+			t.Fatalf("failed decoding log line: %v", err)
+		}
+		if got != want[i] {
+			t.Fatalf("expected log line %+v, got %+v", want[i], got)
+		}
+	}
+}
+
+func TestServer_clientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		trustedProxies int
+		forwardedFor   []string
+		want           string
+	}{
+		{
+			name: "no header configured",
+			want: "192.0.2.1",
+		},
+		{
+			name:   "header not set",
+			header: "X-Forwarded-For",
+			want:   "192.0.2.1",
+		},
+		{
+			name:         "single proxy",
+			header:       "X-Forwarded-For",
+			forwardedFor: []string{"10.0.0.1"},
+			want:         "10.0.0.1",
+		},
+		{
+			name:         "spoofed by the client",
+			header:       "X-Forwarded-For",
+			forwardedFor: []string{"10.0.0.1, 10.0.0.2"},
+			want:         "10.0.0.2",
+		},
+		{
+			name:           "multiple proxies",
+			header:         "X-Forwarded-For",
+			trustedProxies: 2,
+			forwardedFor:   []string{"10.0.0.1, 10.0.0.2", "10.0.0.3"},
+			want:           "10.0.0.2",
+		},
+		{
+			name:           "fewer addresses than proxies",
+			header:         "X-Forwarded-For",
+			trustedProxies: 3,
+			forwardedFor:   []string{"10.0.0.2, 10.0.0.3"},
+			want:           "10.0.0.2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(nil, "", tt.header)
+			srv.trustedProxies = tt.trustedProxies
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/mobile", nil)
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := srv.clientIP(req); got != tt.want {
+				t.Fatalf("expected client IP '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
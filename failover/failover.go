@@ -0,0 +1,337 @@
+// Package failover provides email & mobile services which send using an ordered list of providers,
+// falling through to the next provider if a provider fails with a retryable error. Providers can
+// also be balanced using round-robin or weighted distribution, e.g. to balance costs
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// Strategy is the strategy used to choose the provider tried first
+type Strategy string
+
+const (
+	// Priority tries the providers in the order provided, i.e. the first provider is used unless it
+	// fails. This is the default strategy
+	Priority = Strategy("priority")
+	// RoundRobin rotates the provider tried first, the rest are tried in order
+	RoundRobin = Strategy("round-robin")
+	// Weighted picks the provider tried first at random, proportional to its weight; the rest are
+	// tried in order
+	Weighted = Strategy("weighted")
+)
+
+// ErrNoProviders is the error returned when initializing without any providers
+var ErrNoProviders = errors.New("no providers")
+
+// EmailService is a provider used to send emails, e.g. awsses.AWSSES or smtp.SMTP
+type EmailService interface {
+	Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error)
+}
+
+// multipartEmailService is an email provider which can send an HTML body along with its plain
+// text alternative
+type multipartEmailService interface {
+	SendMultipart(ctx context.Context, sender, recipient, subject, htmlBody, textBody string) (interface{}, error)
+}
+
+// MobileService is a provider used to send text messages, e.g. awssns.AWSSNS or twilio.Twilio
+type MobileService interface {
+	Send(ctx context.Context, recipient, body string) (interface{}, error)
+}
+
+// Config has the configuration of the distribution across providers
+type Config struct {
+	// Strategy is Priority if not set
+	Strategy Strategy
+	// Weights are the weights of the providers in the same order, and are required for Weighted.
+	// Providers with weight 0 are tried first only if all the weights are 0
+	Weights []int
+	// Retryable reports whether the next provider should be tried after the error. If not set,
+	// errors with a method `Retryable() bool` (e.g. twilio.Error) are retried only if it returns
+	// true, and all other errors except context cancellation are retried
+	Retryable func(err error) bool
+}
+
+// Result is the status returned when sent successfully, it has the status returned by the
+// provider which sent, and all the attempts
+type Result struct {
+	Provider string                 `json:"provider,omitempty"`
+	Status   interface{}            `json:"status,omitempty"`
+	Attempts []verifier.SendAttempt `json:"attempts,omitempty"`
+}
+
+// SendAttempts returns all the attempts, so that they're recorded by verifier
+func (res *Result) SendAttempts() []verifier.SendAttempt {
+	return res.Attempts
+}
+
+// Error is the error returned if none of the providers could send
+type Error struct {
+	Attempts []verifier.SendAttempt
+	// Err is the error of the last provider tried
+	Err error
+}
+
+func (e *Error) Error() string {
+	providers := make([]string, 0, len(e.Attempts))
+	for _, attempt := range e.Attempts {
+		providers = append(providers, attempt.Provider)
+	}
+	return fmt.Sprintf("failed sending using %s: %v", strings.Join(providers, ", "), e.Err)
+}
+
+// Unwrap returns the error of the last provider tried
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// SendAttempts returns all the attempts, so that they're recorded by verifier
+func (e *Error) SendAttempts() []verifier.SendAttempt {
+	return e.Attempts
+}
+
+// IsRetryable is the default Config.Retryable
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+
+	return true
+}
+
+// name returns the name of the provider if it has a method `Name() string`, or its position
+func name(provider interface{}, idx int) string {
+	named, ok := provider.(interface{ Name() string })
+	if !ok {
+		return fmt.Sprintf("provider-%d", idx)
+	}
+	return named.Name()
+}
+
+// chain has the distribution & failover logic shared by email & mobile services
+type chain struct {
+	names     []string
+	strategy  Strategy
+	weights   []int
+	total     int
+	retryable func(err error) bool
+
+	next  uint64
+	mu    sync.Mutex
+	rand  *rand.Rand
+	nowFn func() time.Time
+}
+
+func newChain(cfg *Config, names []string) (*chain, error) {
+	if len(names) == 0 {
+		return nil, ErrNoProviders
+	}
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	ch := &chain{
+		names:     names,
+		strategy:  cfg.Strategy,
+		weights:   cfg.Weights,
+		retryable: cfg.Retryable,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		nowFn:     time.Now,
+	}
+	if ch.strategy == "" {
+		ch.strategy = Priority
+	}
+	if ch.retryable == nil {
+		ch.retryable = IsRetryable
+	}
+
+	switch ch.strategy {
+	case Priority, RoundRobin:
+	case Weighted:
+		if len(ch.weights) != len(names) {
+			return nil, fmt.Errorf("expected %d weights, got %d", len(names), len(ch.weights))
+		}
+		for _, weight := range ch.weights {
+			if weight < 0 {
+				return nil, fmt.Errorf("invalid weight %d, weights cannot be negative", weight)
+			}
+			ch.total += weight
+		}
+	default:
+		return nil, fmt.Errorf("unknown strategy '%s'", ch.strategy)
+	}
+
+	return ch, nil
+}
+
+// first returns the index of the provider to be tried first
+func (ch *chain) first() int {
+	switch ch.strategy {
+	case RoundRobin:
+		return int((atomic.AddUint64(&ch.next, 1) - 1) % uint64(len(ch.names)))
+	case Weighted:
+		if ch.total == 0 {
+			return 0
+		}
+		ch.mu.Lock()
+		n := ch.rand.Intn(ch.total)
+		ch.mu.Unlock()
+		for idx, weight := range ch.weights {
+			if n < weight {
+				return idx
+			}
+			n -= weight
+		}
+	}
+	return 0
+}
+
+// send tries the providers starting with the first as per the strategy, till a provider sends or
+// fails with an error which is not retryable
+func (ch *chain) send(ctx context.Context, sendFn func(ctx context.Context, idx int) (interface{}, error)) (interface{}, error) {
+	first := ch.first()
+	attempts := make([]verifier.SendAttempt, 0, len(ch.names))
+
+	var err error
+	for i := 0; i < len(ch.names); i++ {
+		// after the first provider, the rest are tried in the order provided
+		idx := first
+		if i > 0 {
+			idx = i - 1
+			if idx >= first {
+				idx = i
+			}
+		}
+
+		now := ch.nowFn()
+		var status interface{}
+		status, err = sendFn(ctx, idx)
+		attempt := verifier.SendAttempt{
+			Provider:  ch.names[idx],
+			CreatedAt: &now,
+		}
+		if err == nil {
+			attempt.Status = status
+			attempts = append(attempts, attempt)
+			return &Result{Provider: ch.names[idx], Status: status, Attempts: attempts}, nil
+		}
+
+		attempt.Error = err.Error()
+		attempts = append(attempts, attempt)
+		if !ch.retryable(err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, &Error{Attempts: attempts, Err: err}
+}
+
+// Email sends emails using the first provider which succeeds, it's safe for concurrent use
+type Email struct {
+	providers []EmailService
+	chain     *chain
+}
+
+// Name returns the name of the provider, used in metrics. The providers attempted are recorded
+// in the CommStatus of the request
+func (em *Email) Name() string {
+	return "failover"
+}
+
+// Send sends the email, and returns *Result if any of the providers sent it. Otherwise *Error is
+// returned, with the error of the last provider tried
+func (em *Email) Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error) {
+	return em.chain.send(ctx, func(ctx context.Context, idx int) (interface{}, error) {
+		return em.providers[idx].Send(ctx, sender, recipient, subject, body)
+	})
+}
+
+// SendMultipart is same as Send, with the plain text alternative of the HTML body. Only the HTML
+// body is sent using providers which do not support multipart emails
+func (em *Email) SendMultipart(ctx context.Context, sender, recipient, subject, htmlBody, textBody string) (interface{}, error) {
+	return em.chain.send(ctx, func(ctx context.Context, idx int) (interface{}, error) {
+		multipart, ok := em.providers[idx].(multipartEmailService)
+		if !ok {
+			return em.providers[idx].Send(ctx, sender, recipient, subject, htmlBody)
+		}
+		return multipart.SendMultipart(ctx, sender, recipient, subject, htmlBody, textBody)
+	})
+}
+
+// Close closes the providers which need to be closed, e.g. smtp.SMTP
+func (em *Email) Close() error {
+	errs := make([]error, 0, len(em.providers))
+	for _, provider := range em.providers {
+		closer, ok := provider.(io.Closer)
+		if ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewEmail returns an email service, which sends using the providers as per the configuration
+func NewEmail(cfg *Config, providers ...EmailService) (*Email, error) {
+	names := make([]string, 0, len(providers))
+	for idx, provider := range providers {
+		names = append(names, name(provider, idx))
+	}
+
+	ch, err := newChain(cfg, names)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Email{providers: providers, chain: ch}, nil
+}
+
+// Mobile sends text messages using the first provider which succeeds, it's safe for concurrent use
+type Mobile struct {
+	providers []MobileService
+	chain     *chain
+}
+
+// Name returns the name of the provider, used in metrics. The providers attempted are recorded
+// in the CommStatus of the request
+func (mob *Mobile) Name() string {
+	return "failover"
+}
+
+// Send sends the text message, and returns *Result if any of the providers sent it. Otherwise
+// *Error is returned, with the error of the last provider tried
+func (mob *Mobile) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	return mob.chain.send(ctx, func(ctx context.Context, idx int) (interface{}, error) {
+		return mob.providers[idx].Send(ctx, recipient, body)
+	})
+}
+
+// NewMobile returns a mobile service, which sends using the providers as per the configuration
+func NewMobile(cfg *Config, providers ...MobileService) (*Mobile, error) {
+	names := make([]string, 0, len(providers))
+	for idx, provider := range providers {
+		names = append(names, name(provider, idx))
+	}
+
+	ch, err := newChain(cfg, names)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mobile{providers: providers, chain: ch}, nil
+}
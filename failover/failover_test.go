@@ -0,0 +1,280 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+type retryableErr bool
+
+func (re retryableErr) Error() string {
+	return "provider failed"
+}
+
+func (re retryableErr) Retryable() bool {
+	return bool(re)
+}
+
+type mockmobile struct {
+	name string
+	err  error
+	sent int
+}
+
+func (mm *mockmobile) Name() string {
+	return mm.name
+}
+
+func (mm *mockmobile) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	if mm.err != nil {
+		return nil, mm.err
+	}
+	mm.sent++
+	return mm.name + " sent", nil
+}
+
+type mockemail struct {
+	sent string
+}
+
+func (me *mockemail) Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error) {
+	me.sent = body
+	return "sent", nil
+}
+
+type mockmultipart struct {
+	mockemail
+	text string
+}
+
+func (me *mockmultipart) SendMultipart(ctx context.Context, sender, recipient, subject, htmlBody, textBody string) (interface{}, error) {
+	me.sent, me.text = htmlBody, textBody
+	return "sent", nil
+}
+
+func TestMobile_Send(t *testing.T) {
+	tests := []struct {
+		name         string
+		errs         []error
+		wantProvider string
+		wantAttempts []string
+		wantErr      error
+	}{
+		{
+			name:         "first provider",
+			errs:         []error{nil, nil},
+			wantProvider: "primary",
+			wantAttempts: []string{"primary"},
+		},
+		{
+			name:         "falls through on error",
+			errs:         []error{errors.New("unavailable"), nil},
+			wantProvider: "secondary",
+			wantAttempts: []string{"primary", "secondary"},
+		},
+		{
+			name:         "falls through on retryable error",
+			errs:         []error{retryableErr(true), nil},
+			wantProvider: "secondary",
+			wantAttempts: []string{"primary", "secondary"},
+		},
+		{
+			name:         "stops on non retryable error",
+			errs:         []error{retryableErr(false), nil},
+			wantAttempts: []string{"primary"},
+			wantErr:      retryableErr(false),
+		},
+		{
+			name:         "stops on context cancellation",
+			errs:         []error{context.Canceled, nil},
+			wantAttempts: []string{"primary"},
+			wantErr:      context.Canceled,
+		},
+		{
+			name:         "all providers fail",
+			errs:         []error{errors.New("unavailable"), retryableErr(true)},
+			wantAttempts: []string{"primary", "secondary"},
+			wantErr:      retryableErr(true),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mob, err := NewMobile(
+				nil,
+				&mockmobile{name: "primary", err: tt.errs[0]},
+				&mockmobile{name: "secondary", err: tt.errs[1]},
+			)
+			if err != nil {
+				t.Fatalf("NewMobile() error = %v", err)
+			}
+
+			status, err := mob.Send(context.Background(), "+919876543210", "123456")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+
+			var attempts []string
+			if err != nil {
+				ferr := &Error{}
+				if !errors.As(err, &ferr) {
+					t.Fatalf("expected error of type *Error, got %v", err)
+				}
+				for _, attempt := range ferr.SendAttempts() {
+					if attempt.Error == "" {
+						t.Fatalf("expected error of failed attempt to be recorded")
+					}
+					attempts = append(attempts, attempt.Provider)
+				}
+			} else {
+				res, ok := status.(*Result)
+				if !ok {
+					t.Fatalf("expected status of type *Result, got %T", status)
+				}
+				if res.Provider != tt.wantProvider || res.Status != tt.wantProvider+" sent" {
+					t.Fatalf("expected sent by %s, got %+v", tt.wantProvider, res)
+				}
+				for _, attempt := range res.SendAttempts() {
+					attempts = append(attempts, attempt.Provider)
+				}
+			}
+
+			if len(attempts) != len(tt.wantAttempts) {
+				t.Fatalf("expected attempts %v, got %v", tt.wantAttempts, attempts)
+			}
+			for i := range attempts {
+				if attempts[i] != tt.wantAttempts[i] {
+					t.Fatalf("expected attempts %v, got %v", tt.wantAttempts, attempts)
+				}
+			}
+		})
+	}
+}
+
+func TestMobile_distribution(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *Config
+		errs     []error
+		wantSent []int
+	}{
+		{
+			name:     "priority",
+			cfg:      &Config{},
+			errs:     []error{nil, nil, nil},
+			wantSent: []int{60, 0, 0},
+		},
+		{
+			name:     "round robin",
+			cfg:      &Config{Strategy: RoundRobin},
+			errs:     []error{nil, nil, nil},
+			wantSent: []int{20, 20, 20},
+		},
+		{
+			name:     "round robin falls through in order",
+			cfg:      &Config{Strategy: RoundRobin},
+			errs:     []error{nil, errors.New("unavailable"), nil},
+			wantSent: []int{40, 0, 20},
+		},
+		{
+			name:     "weighted",
+			cfg:      &Config{Strategy: Weighted, Weights: []int{3, 1, 0}},
+			errs:     []error{nil, nil, nil},
+			wantSent: []int{41, 19, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providers := []*mockmobile{
+				{name: "first", err: tt.errs[0]},
+				{name: "second", err: tt.errs[1]},
+				{name: "third", err: tt.errs[2]},
+			}
+			mob, err := NewMobile(tt.cfg, providers[0], providers[1], providers[2])
+			if err != nil {
+				t.Fatalf("NewMobile() error = %v", err)
+			}
+			// fixed seed, so that the weighted distribution is deterministic
+			mob.chain.rand = rand.New(rand.NewSource(1))
+
+			for i := 0; i < 60; i++ {
+				_, err = mob.Send(context.Background(), "+919876543210", "123456")
+				if err != nil {
+					t.Fatalf("Mobile.Send() error = %v", err)
+				}
+			}
+
+			for i, provider := range providers {
+				if provider.sent != tt.wantSent[i] {
+					t.Fatalf("expected %s to send %d, got %d", provider.name, tt.wantSent[i], provider.sent)
+				}
+			}
+		})
+	}
+}
+
+func TestEmail_SendMultipart(t *testing.T) {
+	multipart := &mockmultipart{}
+	single := &mockemail{}
+	tests := []struct {
+		name     string
+		provider EmailService
+		wantHTML string
+		wantText string
+	}{
+		{name: "multipart", provider: multipart, wantHTML: "<p>123456</p>", wantText: "123456"},
+		{name: "html only", provider: single, wantHTML: "<p>123456</p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			em, err := NewEmail(nil, tt.provider)
+			if err != nil {
+				t.Fatalf("NewEmail() error = %v", err)
+			}
+
+			_, err = em.SendMultipart(
+				context.Background(),
+				"noreply@example.com",
+				"jane@example.com",
+				"Verify",
+				"<p>123456</p>",
+				"123456",
+			)
+			if err != nil {
+				t.Fatalf("Email.SendMultipart() error = %v", err)
+			}
+
+			html, text := single.sent, ""
+			if tt.provider == multipart {
+				html, text = multipart.sent, multipart.text
+			}
+			if html != tt.wantHTML || text != tt.wantText {
+				t.Fatalf("expected html '%s' & text '%s', got '%s' & '%s'", tt.wantHTML, tt.wantText, html, text)
+			}
+		})
+	}
+}
+
+func TestNewMobile(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       *Config
+		providers []MobileService
+		wantErr   bool
+	}{
+		{name: "valid", providers: []MobileService{&mockmobile{}}},
+		{name: "no providers", wantErr: true},
+		{name: "unknown strategy", cfg: &Config{Strategy: "random"}, providers: []MobileService{&mockmobile{}}, wantErr: true},
+		{name: "weights missing", cfg: &Config{Strategy: Weighted}, providers: []MobileService{&mockmobile{}}, wantErr: true},
+		{name: "negative weight", cfg: &Config{Strategy: Weighted, Weights: []int{-1}}, providers: []MobileService{&mockmobile{}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMobile(tt.cfg, tt.providers...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewMobile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
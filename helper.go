@@ -1,8 +1,8 @@
 package verifier
 
 import (
-	"fmt"
-	"math/rand"
+	"crypto/rand"
+	"io"
 	"net/url"
 	"regexp"
 	"strings"
@@ -13,52 +13,81 @@ var (
 	regexMobile = regexp.MustCompile(`^(\+)?([0-9]){7,24}$`)
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 var (
-	// DefaultEmailOTPPayload is the default email body used
-	DefaultEmailOTPPayload = `
-    <html style="background: #fefefe; font-size: 14px; font-family: sans-serif; color: #333;">
-    <body style="max-width: 780px; margin: 0 auto; padding: 2rem;">
-      <div>Hello,</div>
-      <p>
-        Please click
-        <a href="%s" style="font-weight: 700; text-decoration: underline">here</a>
-        to verify your email.
-      </p>
-  
-      <h5>Note: This link is valid only for %s.</h5>
-      <p style="margin-top: 3rem; color: #999;"><em>
-          Disclaimer: This is a system generated email, please do not reply to this address.
-      </em></p>
-    </body></html>
-  `
-	// DefaultSMSOTPPayload is the default text message body
-	DefaultSMSOTPPayload = "%s is the OTP to verify your mobile number. It is valid only for %s."
+	// DefaultEmailOTPPayload is the default email body, with the callback URL & expiry as its
+	// format verbs (in that order)
+	//
+	// Deprecated: verification emails are rendered using Config.Templates, refer DefaultTemplates
+	DefaultEmailOTPPayload = defaultPayload(TemplateEmailHTML, CommTypeEmail)
+	// DefaultSMSOTPPayload is the default text message body, with the secret & expiry as its format
+	// verbs (in that order)
+	//
+	// Deprecated: verification messages are rendered using Config.Templates, refer DefaultTemplates
+	DefaultSMSOTPPayload = defaultPayload(TemplateSMS, CommTypeMobile)
+)
+
+const (
+	// payloadPlaceholder (of the secret or callback URL) & payloadExpiry are rendered in the
+	// default templates, and replaced with the format verbs of the deprecated payloads
+	payloadPlaceholder = "https://verifier.invalid/payload-secret"
+	payloadExpiry      = time.Hour * 9999
 )
 
+// defaultPayload renders the default template of the name, as a format string with the verbs of
+// the secret (the callback URL for emails) & expiry
+func defaultPayload(name string, ctype CommType) string {
+	data := &TemplateData{Type: ctype, Expiry: payloadExpiry}
+	if ctype == CommTypeEmail {
+		data.CallbackURL = payloadPlaceholder
+	} else {
+		data.Secret = payloadPlaceholder
+	}
+
+	body, err := DefaultTemplates().Render(name, data)
+	if err != nil {
+		panic(err)
+	}
+
+	body = strings.ReplaceAll(body, "%", "%%")
+	body = strings.Replace(body, payloadPlaceholder, "%s", 1)
+	return strings.Replace(body, HumanizeDuration(payloadExpiry), "%s", 1)
+}
+
 var (
 	alphaNumericList = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0987654321")
 	numericList      = []rune("0123456789")
 )
 
-func randRune(runes []rune, n int) string {
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = runes[rand.Intn(len(runes))]
+// randRune returns a string of length n, with runes picked at random from the list using the
+// random source r. Random bytes which would bias the pick towards the beginning of the list
+// (i.e. bytes >= the largest multiple of len(runes) within 256) are discarded.
+func randRune(r io.Reader, runes []rune, n int) (string, error) {
+	limit := 256 - (256 % len(runes))
+	b := make([]rune, 0, n)
+	buf := make([]byte, n+n/2)
+	for len(b) < n {
+		_, err := io.ReadFull(r, buf)
+		if err != nil {
+			return "", err
+		}
+
+		for _, rb := range buf {
+			if int(rb) >= limit {
+				continue
+			}
+			b = append(b, runes[int(rb)%len(runes)])
+			if len(b) == n {
+				break
+			}
+		}
 	}
-	return string(b)
-}
 
-// randomString returns a random alpha numeric string of length n
-func randomString(n int) string {
-	return randRune(alphaNumericList, n)
+	return string(b), nil
 }
 
-func randomNumericString(n int) string {
-	return randRune(numericList, n)
+// randomString returns a random alpha numeric string of length n
+func randomString(n int) (string, error) {
+	return randRune(rand.Reader, alphaNumericList, n)
 }
 
 // validateEmailAddress offline validation of email.
@@ -96,19 +125,18 @@ func EmailCallbackURL(baseurl, email, secret string) (string, error) {
 	return callbackURL.String(), nil
 }
 
-// emailBody if body is an empty string it parses and sends back the default email body
-func emailBody(callbackURL, expiry string) string {
-	return fmt.Sprintf(
-		DefaultEmailOTPPayload,
-		callbackURL,
-		expiry,
-	)
-}
+// EmailCallbackURLWithID adds the relevant query string parameters to the email callback URL,
+// with the verification request ID instead of the email address
+func EmailCallbackURLWithID(baseurl, id, secret string) (string, error) {
+	callbackURL, err := url.Parse(baseurl)
+	if err != nil {
+		return "", err
+	}
+
+	queryParms := callbackURL.Query()
+	queryParms.Add("id", id)
+	queryParms.Add("secret", secret)
+	callbackURL.RawQuery = queryParms.Encode()
 
-func smsBody(secret, expiry string) string {
-	return fmt.Sprintf(
-		DefaultSMSOTPPayload,
-		secret,
-		expiry,
-	)
+	return callbackURL.String(), nil
 }
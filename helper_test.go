@@ -4,41 +4,9 @@ import (
 	"fmt"
 	"regexp"
 	"testing"
+	"time"
 )
 
-func Test_randomNumericString(t *testing.T) {
-	type args struct {
-		n int
-	}
-	tests := []struct {
-		name string
-		args args
-	}{
-		// TODO: Add test cases.
-		{
-			name: "10 digits",
-			args: args{
-				n: 10,
-			},
-		},
-		{
-			name: "5 digits",
-			args: args{
-				n: 5,
-			},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			regexNumeric := regexp.MustCompile(fmt.Sprintf("^([0-9]+){%d}", tt.args.n))
-			got := randomNumericString(tt.args.n)
-			if !regexNumeric.MatchString(got) {
-				t.Fatalf("Expected %d character numeric string, got '%s'", tt.args.n, got)
-			}
-		})
-	}
-}
-
 func Test_randomString(t *testing.T) {
 	type args struct {
 		n int
@@ -64,7 +32,10 @@ func Test_randomString(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			regexAlphaNumeric := regexp.MustCompile(fmt.Sprintf("^([0-9a-zA-Z]+){%d}", tt.args.n))
-			got := randomString(tt.args.n)
+			got, err := randomString(tt.args.n)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 			if !regexAlphaNumeric.MatchString(got) {
 				t.Fatalf("Expected %d character alpha numeric string, got '%s'", tt.args.n, got)
 			}
@@ -144,6 +115,52 @@ func TestEmailCallbackURL(t *testing.T) {
 	}
 }
 
+func TestEmailCallbackURLWithID(t *testing.T) {
+	type args struct {
+		baseurl string
+		id      string
+		secret  string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Valid callback",
+			args: args{
+				baseurl: "https://example.com/verify?source=email",
+				id:      "abc123",
+				secret:  "secret",
+			},
+			want:    "https://example.com/verify?id=abc123&secret=secret&source=email",
+			wantErr: false,
+		},
+		{
+			name: "Invalid base URL",
+			args: args{
+				baseurl: "://example.com",
+				id:      "abc123",
+				secret:  "secret",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EmailCallbackURLWithID(tt.args.baseurl, tt.args.id, tt.args.secret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EmailCallbackURLWithID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("EmailCallbackURLWithID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_validateMobile(t *testing.T) {
 	type args struct {
 		mobile string
@@ -199,67 +216,38 @@ func Test_validateMobile(t *testing.T) {
 	}
 }
 
-func Test_emailBody(t *testing.T) {
-	type args struct {
-		callbackURL string
-		expiry      string
-	}
+func TestDefaultPayloads(t *testing.T) {
 	tests := []struct {
-		name string
-		args args
-		want string
+		name    string
+		payload string
+		want    func() (string, error)
 	}{
-		// TODO: Add test cases.
 		{
-			name: "valid mail body",
-			args: args{
-				callbackURL: "https://example.com",
-				expiry:      "expiry_date",
+			name:    "email",
+			payload: fmt.Sprintf(DefaultEmailOTPPayload, "https://example.com/verify?secret=abc", "1 minute"),
+			want: func() (string, error) {
+				return DefaultTemplates().Render(TemplateEmailHTML, &TemplateData{
+					CallbackURL: "https://example.com/verify?secret=abc",
+					Expiry:      time.Minute,
+				})
 			},
-			want: fmt.Sprintf(
-				DefaultEmailOTPPayload,
-				"https://example.com",
-				"expiry_date",
-			),
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := emailBody(tt.args.callbackURL, tt.args.expiry); got != tt.want {
-				t.Errorf("emailBody() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func Test_smsBody(t *testing.T) {
-	type args struct {
-		secret string
-		expiry string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
-		// TODO: Add test cases.
 		{
-			name: "valid body",
-			args: args{
-				secret: "<otp>",
-				expiry: "[expires at]",
+			name:    "sms",
+			payload: fmt.Sprintf(DefaultSMSOTPPayload, "123456", "1 minute"),
+			want: func() (string, error) {
+				return DefaultTemplates().Render(TemplateSMS, &TemplateData{Secret: "123456", Expiry: time.Minute})
 			},
-			want: fmt.Sprintf(
-				DefaultSMSOTPPayload,
-				"<otp>",
-				"[expires at]",
-			),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := smsBody(tt.args.secret, tt.args.expiry); got != tt.want {
-				t.Errorf("smsBody() = %v, want %v", got, tt.want)
+			want, err := tt.want()
+			if err != nil {
+				t.Fatalf("Templates.Render() error = %v", err)
+			}
+			if tt.payload != want {
+				t.Fatalf("expected payload '%s', got '%s'", want, tt.payload)
 			}
 		})
 	}
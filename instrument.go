@@ -0,0 +1,94 @@
+package verifier
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentedStore traces & logs every call to the store, and records its duration & error if
+// metrics are configured
+type instrumentedStore struct {
+	store   store
+	tracer  trace.Tracer
+	metrics Metrics
+	logger  *slog.Logger
+}
+
+// start starts the span of the store operation, the returned function ends the span, logs the
+// operation & records its metrics
+func (is *instrumentedStore) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := is.tracer.Start(ctx, "verifier.store."+operation, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		duration := time.Since(start)
+		endSpan(span, outcome(err), err)
+		logStoreCall(ctx, is.logger, operation, duration, err)
+		if is.metrics != nil {
+			is.metrics.StoreCall(operation, duration, err)
+		}
+	}
+}
+
+func (is *instrumentedStore) Create(ctx context.Context, ver *Request) (*Request, error) {
+	ctx, end := is.start(
+		ctx,
+		"create",
+		AttrRequestID.String(ver.ID),
+		AttrCommType.String(string(ver.Type)),
+		AttrRecipient.String(RedactRecipient(ver.Recipient)),
+	)
+	verreq, err := is.store.Create(ctx, ver)
+	end(err)
+	return verreq, err
+}
+
+func (is *instrumentedStore) ReadLastPending(ctx context.Context, ctype CommType, recipient string) (*Request, error) {
+	ctx, end := is.start(
+		ctx,
+		"read_last_pending",
+		AttrCommType.String(string(ctype)),
+		AttrRecipient.String(RedactRecipient(recipient)),
+	)
+	verreq, err := is.store.ReadLastPending(ctx, ctype, recipient)
+	end(err)
+	return verreq, err
+}
+
+func (is *instrumentedStore) ReadByID(ctx context.Context, verID string) (*Request, error) {
+	ctx, end := is.start(ctx, "read_by_id", AttrRequestID.String(verID))
+	verreq, err := is.store.ReadByID(ctx, verID)
+	end(err)
+	return verreq, err
+}
+
+func (is *instrumentedStore) Update(ctx context.Context, verID string, ver *Request) (*Request, error) {
+	ctx, end := is.start(ctx, "update", AttrRequestID.String(verID))
+	verreq, err := is.store.Update(ctx, verID, ver)
+	end(err)
+	return verreq, err
+}
+
+func (is *instrumentedStore) IncrementAttempts(ctx context.Context, verID string) (*Request, error) {
+	ctx, end := is.start(ctx, "increment_attempts", AttrRequestID.String(verID))
+	verreq, err := is.store.IncrementAttempts(ctx, verID)
+	end(err)
+	return verreq, err
+}
+
+func (is *instrumentedStore) IncrementResends(ctx context.Context, verID string, now time.Time, interval time.Duration, maxResends int) (*Request, error) {
+	ctx, end := is.start(ctx, "increment_resends", AttrRequestID.String(verID))
+	verreq, err := is.store.IncrementResends(ctx, verID, now, interval, maxResends)
+	end(err)
+	return verreq, err
+}
+
+func (is *instrumentedStore) List(ctx context.Context, filter *ListFilter) ([]*Request, error) {
+	ctx, end := is.start(ctx, "list")
+	reqs, err := is.store.List(ctx, filter)
+	end(err)
+	return reqs, err
+}
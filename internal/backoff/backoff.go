@@ -0,0 +1,23 @@
+// Package backoff has the backoff of retries, shared by the send workers & the webhook dispatcher
+package backoff
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Exponential returns the duration to wait before the next attempt, after the given number of
+// failed attempts. The duration is initial doubled for every failed attempt after the first, up to
+// max; with jitter of up to half of it, so that retries of attempts which failed together (e.g.
+// during an outage) are spread out
+func Exponential(attempts int, initial, max time.Duration) time.Duration {
+	backoff := max
+	if shift := attempts - 1; shift >= 0 && shift < 32 {
+		if exp := initial << shift; exp > 0 && exp < backoff {
+			backoff = exp
+		}
+	}
+
+	half := backoff / 2
+	return half + rand.N(half+1)
+}
@@ -0,0 +1,31 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponential(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		min      time.Duration
+		max      time.Duration
+	}{
+		{name: "first retry", attempts: 1, min: time.Millisecond * 500, max: time.Second},
+		{name: "second retry", attempts: 2, min: time.Second, max: time.Second * 2},
+		{name: "third retry", attempts: 3, min: time.Second * 2, max: time.Second * 4},
+		{name: "max backoff", attempts: 4, min: time.Second * 2, max: time.Second * 4},
+		{name: "overflow", attempts: 100, min: time.Second * 2, max: time.Second * 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := Exponential(tt.attempts, time.Second, time.Second*4)
+				if got < tt.min || got > tt.max {
+					t.Fatalf("expected backoff between %v & %v, got %v", tt.min, tt.max, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+// Package redisutil has the helpers shared by the Redis store & rate limiter
+package redisutil
+
+import (
+	"context"
+
+	"github.com/go-redis/redis"
+)
+
+// WithContext returns the client to be used for the commands, with the context set.
+// Context is supported only by the standalone, cluster & ring clients
+func WithContext(ctx context.Context, client redis.UniversalClient) redis.Cmdable {
+	if ctx == nil {
+		return client
+	}
+
+	switch cli := client.(type) {
+	case *redis.Client:
+		return cli.WithContext(ctx)
+	case *redis.ClusterClient:
+		return cli.WithContext(ctx)
+	case *redis.Ring:
+		return cli.WithContext(ctx)
+	}
+
+	return client
+}
@@ -0,0 +1,168 @@
+package verifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type localeCtxKey struct{}
+
+// WithLocale returns a copy of ctx with the locale (e.g. 'pt-BR'), which is set as the locale of
+// the verification requests created using the context
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeCtxKey{}, locale)
+}
+
+// LocaleFromContext returns the locale set in the context using WithLocale
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeCtxKey{}).(string)
+	return locale
+}
+
+// LocaleResolver resolves the locale of a recipient, for requests created without a locale
+type LocaleResolver interface {
+	// Locale returns the locale of the recipient, or an empty string if it's not known
+	Locale(ctype CommType, recipient string) string
+}
+
+// CallingCodeLocales resolves the locale of mobile numbers by their country calling code,
+// e.g. CallingCodeLocales{"+55": "pt-BR", "+33": "fr"}
+type CallingCodeLocales map[string]string
+
+// Locale returns the locale of the country calling code of a mobile number
+func (ccl CallingCodeLocales) Locale(ctype CommType, recipient string) string {
+	if ctype != CommTypeMobile {
+		return ""
+	}
+	return ccl[CountryCallingCode(recipient)]
+}
+
+// locale returns the locale set in the context, or the locale resolved for the recipient
+func (ver *Verifier) locale(ctx context.Context, ctype CommType, recipient string) string {
+	locale := LocaleFromContext(ctx)
+	if locale == "" && ver.cfg.LocaleResolver != nil {
+		locale = ver.cfg.LocaleResolver.Locale(ctype, recipient)
+	}
+	return locale
+}
+
+// normalizeLocale returns the locale in lower case, with '-' as the separator (e.g. 'pt_BR' is
+// normalized as 'pt-br')
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// LocaleFallbacks returns the locales to look up for the locale, from the most specific to the
+// least, followed by the fallback chain of fallback. e.g. ("pt-BR", "en") returns
+// ["pt-br", "pt", "en"]. Locales are normalized to lower case
+func LocaleFallbacks(locale, fallback string) []string {
+	chain := make([]string, 0, 4)
+	for _, loc := range []string{locale, fallback} {
+		loc = normalizeLocale(loc)
+		for loc != "" {
+			if !containsString(chain, loc) {
+				chain = append(chain, loc)
+			}
+			idx := strings.LastIndex(loc, "-")
+			if idx < 0 {
+				break
+			}
+			loc = loc[:idx]
+		}
+	}
+	return chain
+}
+
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
+
+// durationParts returns the days, hours, minutes & seconds of the duration, rounded to seconds
+func durationParts(d time.Duration) (days, hours, minutes, seconds int) {
+	d = d.Round(time.Second)
+	days = int(d / (time.Hour * 24))
+	hours = int(d % (time.Hour * 24) / time.Hour)
+	minutes = int(d % time.Hour / time.Minute)
+	seconds = int(d % time.Minute / time.Second)
+	return days, hours, minutes, seconds
+}
+
+// durationUnits are the singular & plural words of days, hours, minutes & seconds, by language
+var durationUnits = map[string][4][2]string{
+	"en": {{"day", "days"}, {"hour", "hours"}, {"minute", "minutes"}, {"second", "seconds"}},
+	"de": {{"Tag", "Tage"}, {"Stunde", "Stunden"}, {"Minute", "Minuten"}, {"Sekunde", "Sekunden"}},
+	"es": {{"día", "días"}, {"hora", "horas"}, {"minuto", "minutos"}, {"segundo", "segundos"}},
+	"fr": {{"jour", "jours"}, {"heure", "heures"}, {"minute", "minutes"}, {"seconde", "secondes"}},
+	"it": {{"giorno", "giorni"}, {"ora", "ore"}, {"minuto", "minuti"}, {"secondo", "secondi"}},
+	"nl": {{"dag", "dagen"}, {"uur", "uur"}, {"minuut", "minuten"}, {"seconde", "seconden"}},
+	"pt": {{"dia", "dias"}, {"hora", "horas"}, {"minuto", "minutos"}, {"segundo", "segundos"}},
+}
+
+// HumanizeDuration returns the duration in words in English, e.g. 12h is '12 hours', and 90m is
+// '1 hour 30 minutes'
+func HumanizeDuration(d time.Duration) string {
+	return HumanizeDurationLocale(d, "en")
+}
+
+// HumanizeDurationLocale returns the duration in words in the language of the locale, e.g. 12h is
+// '12 horas' in 'pt-BR'. English is used for the languages which are not available. It's available
+// as the function 'humanize' in the templates, in the locale of the templates
+func HumanizeDurationLocale(d time.Duration, locale string) string {
+	units := durationUnits["en"]
+	for _, loc := range LocaleFallbacks(locale, "") {
+		if u, ok := durationUnits[loc]; ok {
+			units = u
+			break
+		}
+	}
+
+	days, hours, minutes, seconds := durationParts(d)
+	parts := make([]string, 0, 4)
+	for i, value := range []int{days, hours, minutes, seconds} {
+		switch value {
+		case 0:
+		case 1:
+			parts = append(parts, "1 "+units[i][0])
+		default:
+			parts = append(parts, fmt.Sprintf("%d %s", value, units[i][1]))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "0 " + units[3][1]
+	}
+	return strings.Join(parts, " ")
+}
+
+// templateFuncs returns the functions available in the templates of the locale. Besides 'humanize',
+// the parts of a duration are available to be worded otherwise, e.g. '{{hours .Expiry}}h'
+func templateFuncs(locale string) map[string]interface{} {
+	return map[string]interface{}{
+		"humanize": func(d time.Duration) string {
+			return HumanizeDurationLocale(d, locale)
+		},
+		"days": func(d time.Duration) int {
+			days, _, _, _ := durationParts(d)
+			return days
+		},
+		"hours": func(d time.Duration) int {
+			_, hours, _, _ := durationParts(d)
+			return hours
+		},
+		"minutes": func(d time.Duration) int {
+			_, _, minutes, _ := durationParts(d)
+			return minutes
+		},
+		"seconds": func(d time.Duration) int {
+			_, _, _, seconds := durationParts(d)
+			return seconds
+		},
+	}
+}
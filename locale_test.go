@@ -0,0 +1,334 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLocaleFallbacks(t *testing.T) {
+	tests := []struct {
+		name     string
+		locale   string
+		fallback string
+		want     []string
+	}{
+		{
+			name:     "region",
+			locale:   "pt-BR",
+			fallback: "en",
+			want:     []string{"pt-br", "pt", "en"},
+		},
+		{
+			name:     "underscore",
+			locale:   "zh_Hant_TW",
+			fallback: "en-US",
+			want:     []string{"zh-hant-tw", "zh-hant", "zh", "en-us", "en"},
+		},
+		{
+			name:     "same as fallback",
+			locale:   "en-GB",
+			fallback: "en",
+			want:     []string{"en-gb", "en"},
+		},
+		{
+			name:     "no locale",
+			fallback: "en",
+			want:     []string{"en"},
+		},
+		{
+			name: "none",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LocaleFallbacks(tt.locale, tt.fallback)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("LocaleFallbacks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHumanizeDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		d    time.Duration
+		want string
+	}{
+		{name: "zero", d: 0, want: "0 seconds"},
+		{name: "seconds", d: time.Second * 45, want: "45 seconds"},
+		{name: "minute", d: time.Minute, want: "1 minute"},
+		{name: "minutes", d: time.Minute * 10, want: "10 minutes"},
+		{name: "hours", d: time.Hour * 12, want: "12 hours"},
+		{name: "hour & minutes", d: time.Minute * 90, want: "1 hour 30 minutes"},
+		{name: "days", d: time.Hour * 49, want: "2 days 1 hour"},
+		{name: "rounded", d: time.Minute*5 + time.Millisecond*600, want: "5 minutes 1 second"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HumanizeDuration(tt.d)
+			if got != tt.want {
+				t.Fatalf("HumanizeDuration() = '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHumanizeDurationLocale(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		d      time.Duration
+		want   string
+	}{
+		{name: "language", locale: "pt", d: time.Minute * 90, want: "1 hora 30 minutos"},
+		{name: "region", locale: "pt_BR", d: time.Hour * 12, want: "12 horas"},
+		{name: "zero", locale: "de", d: 0, want: "0 Sekunden"},
+		{name: "days", locale: "fr", d: time.Hour * 25, want: "1 jour 1 heure"},
+		{name: "unknown", locale: "ja", d: time.Minute * 10, want: "10 minutes"},
+		{name: "no locale", d: time.Second, want: "1 second"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HumanizeDurationLocale(tt.d, tt.locale)
+			if got != tt.want {
+				t.Fatalf("HumanizeDurationLocale() = '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallingCodeLocales(t *testing.T) {
+	resolver := CallingCodeLocales{"+55": "pt-BR", "+33": "fr"}
+	tests := []struct {
+		name      string
+		ctype     CommType
+		recipient string
+		want      string
+	}{
+		{name: "matching", ctype: CommTypeMobile, recipient: "+5511987654321", want: "pt-BR"},
+		{name: "not matching", ctype: CommTypeMobile, recipient: "+919876543210", want: ""},
+		{name: "email", ctype: CommTypeEmail, recipient: "john.doe@example.com", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolver.Locale(tt.ctype, tt.recipient)
+			if got != tt.want {
+				t.Fatalf("CallingCodeLocales.Locale() = '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+}
+
+var localizedTemplatesFS = fstest.MapFS{
+	"email.html":           {Data: []byte("default {{.CallbackURL}}")},
+	"sms.txt":              {Data: []byte("default {{.Secret}}")},
+	"en/sms.txt":           {Data: []byte("{{.Secret}} is your OTP, valid for {{humanize .Expiry}}")},
+	"pt/sms.txt":           {Data: []byte("{{.Secret}} é o seu código, válido por {{humanize .Expiry}}")},
+	"pt/email.html":        {Data: []byte("pt {{.CallbackURL}}")},
+	"pt/email.subject.txt": {Data: []byte("Verifique o seu email")},
+	"pt-BR/sms.txt":        {Data: []byte("{{.Secret}} é o seu código (BR)")},
+	"fr/email.html":        {Data: []byte("fr {{.CallbackURL}}")},
+	"fr/README.json":       {Data: []byte("{}")},
+}
+
+func TestParseLocalizedTemplates(t *testing.T) {
+	tmpls, err := ParseLocalizedTemplates(localizedTemplatesFS, "en")
+	if err != nil {
+		t.Fatalf("ParseLocalizedTemplates() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		locale    string
+		wantSMS   string
+		wantEmail string
+	}{
+		{
+			name:      "exact",
+			locale:    "pt-BR",
+			wantSMS:   "123 é o seu código (BR)",
+			wantEmail: "pt https://example.com",
+		},
+		{
+			name:      "language",
+			locale:    "pt_PT",
+			wantSMS:   "123 é o seu código, válido por 2 horas",
+			wantEmail: "pt https://example.com",
+		},
+		{
+			name:      "fallback",
+			locale:    "fr",
+			wantSMS:   "123 is your OTP, valid for 2 hours",
+			wantEmail: "fr https://example.com",
+		},
+		{
+			name:      "unknown",
+			locale:    "de",
+			wantSMS:   "123 is your OTP, valid for 2 hours",
+			wantEmail: "default https://example.com",
+		},
+		{
+			name:      "no locale",
+			wantSMS:   "123 is your OTP, valid for 2 hours",
+			wantEmail: "default https://example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &TemplateData{
+				Locale:      tt.locale,
+				CallbackURL: "https://example.com",
+				Secret:      "123",
+				Expiry:      time.Hour * 2,
+			}
+			sms, err := tmpls.SMS(data)
+			if err != nil {
+				t.Fatalf("Templates.SMS() error = %v", err)
+			}
+			if sms != tt.wantSMS {
+				t.Fatalf("expected SMS '%s', got '%s'", tt.wantSMS, sms)
+			}
+
+			msg, err := tmpls.Email(data)
+			if err != nil {
+				t.Fatalf("Templates.Email() error = %v", err)
+			}
+			if msg.HTML != tt.wantEmail {
+				t.Fatalf("expected email '%s', got '%s'", tt.wantEmail, msg.HTML)
+			}
+		})
+	}
+
+	_, err = ParseLocalizedTemplates(fstest.MapFS{}, "en")
+	if !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", ErrTemplateNotFound, err)
+	}
+}
+
+func TestVerifier_locale(t *testing.T) {
+	tmpls, err := ParseLocalizedTemplates(localizedTemplatesFS, "en")
+	if err != nil {
+		t.Fatalf("ParseLocalizedTemplates() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		recipient  string
+		wantLocale string
+		wantText   string
+	}{
+		{
+			name:       "context",
+			ctx:        WithLocale(context.Background(), "pt-BR"),
+			recipient:  "+919876543210",
+			wantLocale: "pt-BR",
+			wantText:   "é o seu código (BR)",
+		},
+		{
+			name:       "resolver",
+			ctx:        context.Background(),
+			recipient:  "+33612345678",
+			wantLocale: "fr",
+			wantText:   "is your OTP, valid for 10 minutes",
+		},
+		{
+			name:       "context takes precedence",
+			ctx:        WithLocale(context.Background(), "pt"),
+			recipient:  "+33612345679",
+			wantLocale: "pt",
+			wantText:   "é o seu código, válido por 10 minutos",
+		},
+		{
+			name:       "unresolved",
+			ctx:        context.Background(),
+			recipient:  "+919876543211",
+			wantLocale: "",
+			wantText:   "is your OTP, valid for 10 minutes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mobile := &mockmobile{}
+			verstore := &mockstore{data: map[string]*Request{}}
+			ver, err := New(
+				&Config{
+					MobileOTPExpiry: time.Minute * 10,
+					Templates:       tmpls,
+					LocaleResolver:  CallingCodeLocales{"+33": "fr"},
+				},
+				verstore,
+				nil,
+				mobile,
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			err = ver.NewMobileContext(tt.ctx, tt.recipient)
+			if err != nil {
+				t.Fatalf("Verifier.NewMobileContext() error = %v", err)
+			}
+
+			verreq := verstore.data["mobile-"+tt.recipient]
+			if verreq.Locale != tt.wantLocale {
+				t.Fatalf("expected locale '%s', got '%s'", tt.wantLocale, verreq.Locale)
+			}
+			want := verreq.Secret + " " + tt.wantText
+			if mobile.body != want {
+				t.Fatalf("expected '%s', got '%s'", want, mobile.body)
+			}
+		})
+	}
+}
+
+func TestVerifier_localizedSubject(t *testing.T) {
+	tmpls, err := ParseLocalizedTemplates(localizedTemplatesFS, "en")
+	if err != nil {
+		t.Fatalf("ParseLocalizedTemplates() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		locale      string
+		subject     string
+		wantSubject string
+	}{
+		{name: "localized", locale: "pt-BR", wantSubject: "Verifique o seu email"},
+		{name: "not localized", locale: "fr", wantSubject: "Welcome"},
+		{name: "subject", locale: "pt-BR", subject: "Verify", wantSubject: "Verify"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := &mockmultipartemail{}
+			ver, err := New(
+				&Config{
+					EmailOTPExpiry:   time.Minute,
+					EmailCallbackURL: "https://example.com/verify",
+					DefaultEmailSub:  "Welcome",
+					Templates:        tmpls,
+				},
+				&mockstore{data: map[string]*Request{}},
+				email,
+				nil,
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			err = ver.NewEmailContext(WithLocale(context.Background(), tt.locale), "john.doe@example.com", tt.subject)
+			if err != nil {
+				t.Fatalf("Verifier.NewEmailContext() error = %v", err)
+			}
+			if email.subject != tt.wantSubject {
+				t.Fatalf("expected subject '%s', got '%s'", tt.wantSubject, email.subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package verifier
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// discardHandler discards all the logs, it's used if Config.Logger is not set
+type discardHandler struct{}
+
+func (dh discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (dh discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (dh discardHandler) WithAttrs([]slog.Attr) slog.Handler        { return dh }
+func (dh discardHandler) WithGroup(string) slog.Handler             { return dh }
+
+// RecipientAttr returns the log attribute 'recipient', with the recipient redacted using
+// RedactRecipient
+func RecipientAttr(recipient string) slog.Attr {
+	return slog.String("recipient", RedactRecipient(recipient))
+}
+
+// LogValue implements slog.LogValuer, so that a request is logged with its recipient redacted,
+// and without its secret
+func (v *Request) LogValue() slog.Value {
+	if v == nil {
+		return slog.Value{}
+	}
+
+	return slog.GroupValue(
+		slog.String("id", v.ID),
+		slog.String("type", string(v.Type)),
+		RecipientAttr(v.Recipient),
+		slog.String("status", string(v.Status)),
+		slog.Int("attempts", v.Attempts),
+	)
+}
+
+// logSend logs the result of sending the secret of the request using the provider
+func (ver *Verifier) logSend(ctx context.Context, verreq *Request, provider interface{}, start time.Time, err error) {
+	attrs := []slog.Attr{
+		slog.Any("request", verreq),
+		slog.String("provider", providerName(provider)),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		ver.cfg.Logger.LogAttrs(ctx, slog.LevelError, "failed sending verification secret", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	ver.cfg.Logger.LogAttrs(ctx, slog.LevelInfo, "verification secret sent", attrs...)
+}
+
+// logVerification logs the outcome of a verification. Verifications which fail for expected reasons
+// (e.g. an invalid secret) are logged as info, & the others as errors
+func (ver *Verifier) logVerification(ctx context.Context, outcome string, err error, attrs ...slog.Attr) {
+	attrs = append(attrs, slog.String("outcome", outcome))
+	switch {
+	case err == nil:
+		ver.cfg.Logger.LogAttrs(ctx, slog.LevelInfo, "verification succeeded", attrs...)
+	case expectedOutcomes[outcome]:
+		ver.cfg.Logger.LogAttrs(ctx, slog.LevelInfo, "verification failed", append(attrs, slog.Any("error", err))...)
+	default:
+		ver.cfg.Logger.LogAttrs(ctx, slog.LevelError, "verification failed", append(attrs, slog.Any("error", err))...)
+	}
+}
+
+// logStoreCall logs the call to the store, failed calls are logged as errors except the expected
+// outcomes, e.g. ErrNotFound
+func logStoreCall(ctx context.Context, logger *slog.Logger, operation string, duration time.Duration, err error) {
+	attrs := []slog.Attr{
+		slog.String("operation", operation),
+		slog.Duration("duration", duration),
+	}
+	if err != nil && !expectedOutcomes[outcome(err)] {
+		logger.LogAttrs(ctx, slog.LevelError, "store call failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "store call", attrs...)
+}
@@ -0,0 +1,138 @@
+package verifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequest_LogValue(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+	logger.Info("test", "request", &Request{
+		ID:        "1",
+		Type:      CommTypeEmail,
+		Recipient: "john.doe@example.com",
+		Secret:    "hashed-secret",
+		Status:    VerStatusPending,
+		secret:    "plain-secret",
+	})
+
+	line := buf.String()
+	for _, leaked := range []string{"john.doe", "hashed-secret", "plain-secret"} {
+		if strings.Contains(line, leaked) {
+			t.Fatalf("expected '%s' not to be logged, got %s", leaked, line)
+		}
+	}
+
+	got := struct {
+		Request map[string]interface{} `json:"request"`
+	}{}
+	err := json.Unmarshal(buf.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("failed decoding log line: %v", err)
+	}
+	if got.Request["recipient"] != "j***@example.com" || got.Request["id"] != "1" {
+		t.Fatalf("expected request '1' with recipient 'j***@example.com', got %v", got.Request)
+	}
+}
+
+func TestVerifier_logging(t *testing.T) {
+	recipient := "+919876543210"
+	tests := []struct {
+		name    string
+		sendErr error
+		secret  func(verreq *Request) string
+		// wantMessages are the messages expected to be logged, in order
+		wantMessages []string
+		wantLevel    string
+	}{
+		{
+			name:         "verified",
+			secret:       func(verreq *Request) string { return verreq.PlainSecret() },
+			wantMessages: []string{"verification secret sent", "verification succeeded"},
+			wantLevel:    "INFO",
+		},
+		{
+			name:         "rejected",
+			secret:       func(verreq *Request) string { return "wrong" },
+			wantMessages: []string{"verification secret sent", "verification failed"},
+			wantLevel:    "INFO",
+		},
+		{
+			name:         "send failed",
+			sendErr:      errors.New("provider unavailable"),
+			wantMessages: []string{"failed sending verification secret"},
+			wantLevel:    "ERROR",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			ver, err := New(
+				&Config{
+					MobileOTPExpiry: time.Minute,
+					Logger:          slog.New(slog.NewJSONHandler(buf, nil)),
+				},
+				&mockstore{data: map[string]*Request{}},
+				nil,
+				&mockmobile{err: tt.sendErr},
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			ctx := context.Background()
+			verreq, err := ver.NewRequestContext(ctx, CommTypeMobile, recipient)
+			if err != nil {
+				t.Fatalf("Verifier.NewRequestContext() error = %v", err)
+			}
+			plainSecret := verreq.PlainSecret()
+			secret := ""
+			if tt.secret != nil {
+				secret = tt.secret(verreq)
+			}
+
+			err = ver.NewMobileWithReqContext(ctx, verreq, "your OTP is "+plainSecret)
+			if !errors.Is(err, tt.sendErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.sendErr, err)
+			}
+			if secret != "" {
+				_ = ver.VerifyMobileSecretContext(ctx, recipient, secret)
+			}
+
+			logs := buf.String()
+			for _, leaked := range []string{recipient, plainSecret} {
+				if strings.Contains(logs, leaked) {
+					t.Fatalf("expected '%s' not to be logged, got %s", leaked, logs)
+				}
+			}
+
+			lines := strings.Split(strings.TrimSpace(logs), "\n")
+			if len(lines) != len(tt.wantMessages) {
+				t.Fatalf("expected %d log lines, got %d: %s", len(tt.wantMessages), len(lines), logs)
+			}
+			for i, line := range lines {
+				got := struct {
+					Msg   string `json:"msg"`
+					Level string `json:"level"`
+				}{}
+				err = json.Unmarshal([]byte(line), &got)
+				if err != nil {
+					t.Fatalf("failed decoding log line: %v", err)
+				}
+				if got.Msg != tt.wantMessages[i] {
+					t.Fatalf("expected message '%s', got '%s'", tt.wantMessages[i], got.Msg)
+				}
+				if i == len(lines)-1 && got.Level != tt.wantLevel {
+					t.Fatalf("expected level '%s', got '%s'", tt.wantLevel, got.Level)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package verifier
+
+import (
+	"time"
+)
+
+// Metrics records the metrics of verification requests, the providers used to send them & the
+// store. A Prometheus implementation is available in the metrics package
+type Metrics interface {
+	// RequestCreated is called when a verification request is created
+	RequestCreated(ctype CommType)
+	// ProviderCall is called after a secret is sent, or fails to be sent, using the provider
+	ProviderCall(ctype CommType, provider string, duration time.Duration, err error)
+	// Verification is called with the outcome of the verification of a request, which is one of
+	// EventVerified, EventRejected, EventExpired or EventAttemptsExceeded
+	Verification(ctype CommType, outcome EventType)
+	// StoreCall is called after every call to the store
+	StoreCall(operation string, duration time.Duration, err error)
+}
+
+// providerName returns the name of an email or mobile service, if it has a method `Name() string`
+func providerName(provider interface{}) string {
+	named, ok := provider.(interface{ Name() string })
+	if !ok {
+		return "custom"
+	}
+	return named.Name()
+}
+
+// recordProviderCall records the call to the provider started at start, if metrics are configured
+func (ver *Verifier) recordProviderCall(ctype CommType, provider interface{}, start time.Time, err error) {
+	if ver.cfg.Metrics == nil {
+		return
+	}
+	ver.cfg.Metrics.ProviderCall(ctype, providerName(provider), time.Since(start), err)
+}
+
+// recordEvent records the metrics of a lifecycle event, if metrics are configured
+func (ver *Verifier) recordEvent(etype EventType, verreq *Request) {
+	if ver.cfg.Metrics == nil {
+		return
+	}
+
+	switch etype {
+	case EventCreated:
+		ver.cfg.Metrics.RequestCreated(verreq.Type)
+	case EventVerified, EventRejected, EventExpired, EventAttemptsExceeded:
+		ver.cfg.Metrics.Verification(verreq.Type, etype)
+	}
+}
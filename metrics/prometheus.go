@@ -0,0 +1,122 @@
+// Package metrics has implementations of verifier.Metrics
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/naughtygopher/verifier"
+)
+
+const namespace = "verifier"
+
+// result returns the value of the 'result' label. Requests which do not exist or are no longer
+// pending are expected, and are not counted as failures
+func result(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, verifier.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, verifier.ErrRequestNotPending):
+		return "not_pending"
+	}
+	return "failure"
+}
+
+// Prometheus records the verifier metrics as Prometheus counters & histograms
+type Prometheus struct {
+	requestsCreated  *prometheus.CounterVec
+	sends            *prometheus.CounterVec
+	providerDuration *prometheus.HistogramVec
+	verifications    *prometheus.CounterVec
+	storeDuration    *prometheus.HistogramVec
+}
+
+// RequestCreated increments verifier_requests_created_total
+func (prom *Prometheus) RequestCreated(ctype verifier.CommType) {
+	prom.requestsCreated.WithLabelValues(string(ctype)).Inc()
+}
+
+// ProviderCall increments verifier_sends_total & observes verifier_provider_call_duration_seconds
+func (prom *Prometheus) ProviderCall(ctype verifier.CommType, provider string, duration time.Duration, err error) {
+	prom.sends.WithLabelValues(string(ctype), provider, result(err)).Inc()
+	prom.providerDuration.WithLabelValues(string(ctype), provider).Observe(duration.Seconds())
+}
+
+// Verification increments verifier_verifications_total
+func (prom *Prometheus) Verification(ctype verifier.CommType, outcome verifier.EventType) {
+	prom.verifications.WithLabelValues(string(ctype), string(outcome)).Inc()
+}
+
+// StoreCall observes verifier_store_call_duration_seconds
+func (prom *Prometheus) StoreCall(operation string, duration time.Duration, err error) {
+	prom.storeDuration.WithLabelValues(operation, result(err)).Observe(duration.Seconds())
+}
+
+// NewPrometheus returns a new Prometheus metrics recorder, with all its collectors registered
+// in reg. e.g. prometheus.DefaultRegisterer
+func NewPrometheus(reg prometheus.Registerer) (*Prometheus, error) {
+	prom := &Prometheus{
+		requestsCreated: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "requests_created_total",
+				Help:      "Number of verification requests created.",
+			},
+			[]string{"type"},
+		),
+		sends: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "sends_total",
+				Help:      "Number of secrets sent, by provider & result.",
+			},
+			[]string{"type", "provider", "result"},
+		),
+		providerDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "provider_call_duration_seconds",
+				Help:      "Duration of the calls to providers to send secrets.",
+				Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			},
+			[]string{"type", "provider"},
+		),
+		verifications: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "verifications_total",
+				Help:      "Number of verifications, by outcome.",
+			},
+			[]string{"type", "outcome"},
+		),
+		storeDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "store_call_duration_seconds",
+				Help:      "Duration of the calls to the store, by operation & result.",
+				Buckets:   []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+			},
+			[]string{"operation", "result"},
+		),
+	}
+
+	collectors := []prometheus.Collector{
+		prom.requestsCreated,
+		prom.sends,
+		prom.providerDuration,
+		prom.verifications,
+		prom.storeDuration,
+	}
+	for _, c := range collectors {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return prom, nil
+}
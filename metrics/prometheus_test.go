@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/naughtygopher/verifier"
+	"github.com/naughtygopher/verifier/stores"
+)
+
+func Test_result(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "success", err: nil, want: "success"},
+		{name: "not found", err: fmt.Errorf("read failed: %w", verifier.ErrNotFound), want: "not_found"},
+		{name: "not pending", err: verifier.ErrRequestNotPending, want: "not_pending"},
+		{name: "failure", err: errors.New("connection refused"), want: "failure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := result(tt.err); got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+type mockmobile struct {
+	err error
+}
+
+func (mm *mockmobile) Name() string {
+	return "mock"
+}
+
+func (mm *mockmobile) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	return "message-id", mm.err
+}
+
+func TestPrometheus(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	prom, err := NewPrometheus(reg)
+	if err != nil {
+		t.Fatalf("failed initializing prometheus metrics: %v", err)
+	}
+
+	mobile := &mockmobile{}
+	ver, err := verifier.New(
+		&verifier.Config{MobileOTPExpiry: time.Minute, Metrics: prom},
+		stores.NewMemory(nil),
+		nil,
+		mobile,
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	ctx := context.Background()
+	recipient := "+919876543210"
+	verreq, err := ver.NewRequestContext(ctx, verifier.CommTypeMobile, recipient)
+	if err != nil {
+		t.Fatalf("Verifier.NewRequestContext() error = %v", err)
+	}
+	secret := verreq.PlainSecret()
+
+	err = ver.NewMobileWithReqContext(ctx, verreq, "your OTP is "+secret)
+	if err != nil {
+		t.Fatalf("Verifier.NewMobileWithReqContext() error = %v", err)
+	}
+
+	mobile.err = errors.New("provider unavailable")
+	_ = ver.NewMobileContext(ctx, "+14155550100")
+
+	_ = ver.VerifyMobileSecretContext(ctx, "+14155550100", "wrong")
+	err = ver.VerifyMobileSecretContext(ctx, recipient, secret)
+	if err != nil {
+		t.Fatalf("Verifier.VerifyMobileSecretContext() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		collector prometheus.Collector
+		want      float64
+	}{
+		{
+			name:      "requests created",
+			collector: prom.requestsCreated.WithLabelValues("mobile"),
+			want:      2,
+		},
+		{
+			name:      "successful sends",
+			collector: prom.sends.WithLabelValues("mobile", "mock", "success"),
+			want:      1,
+		},
+		{
+			name:      "failed sends",
+			collector: prom.sends.WithLabelValues("mobile", "mock", "failure"),
+			want:      1,
+		},
+		{
+			name:      "verified",
+			collector: prom.verifications.WithLabelValues("mobile", string(verifier.EventVerified)),
+			want:      1,
+		},
+		{
+			name:      "rejected",
+			collector: prom.verifications.WithLabelValues("mobile", string(verifier.EventRejected)),
+			want:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testutil.ToFloat64(tt.collector); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// provider latency per provider & store latency per operation & result
+	if got := testutil.CollectAndCount(prom.providerDuration); got != 1 {
+		t.Fatalf("expected 1 provider latency series, got %d", got)
+	}
+	if got := testutil.CollectAndCount(prom.storeDuration); got < 4 {
+		t.Fatalf("expected at least 4 store latency series, got %d", got)
+	}
+}
@@ -0,0 +1,87 @@
+package verifier
+
+import (
+	"context"
+	"time"
+)
+
+// EventType is the type of a verification request lifecycle event
+type EventType string
+
+const (
+	// EventCreated is emitted when a verification request is created
+	EventCreated = EventType("created")
+	// EventEnqueued is emitted when the send of a secret is enqueued, if sends are asynchronous
+	// (Config.SendQueue). EventSent or EventSendFailed is emitted once it's sent, or fails
+	EventEnqueued = EventType("enqueued")
+	// EventSent is emitted when the secret of a verification request is sent (or resent)
+	EventSent = EventType("sent")
+	// EventSendFailed is emitted when the secret of a verification request could not be sent
+	EventSendFailed = EventType("send-failed")
+	// EventVerified is emitted when a verification request is verified
+	EventVerified = EventType("verified")
+	// EventRejected is emitted when verification fails because of an invalid secret
+	EventRejected = EventType("rejected")
+	// EventExpired is emitted when verification fails because the secret has expired
+	EventExpired = EventType("expired")
+	// EventAttemptsExceeded is emitted when verification fails because the maximum attempts are exceeded
+	EventAttemptsExceeded = EventType("attempts-exceeded")
+	// EventCancelled is emitted when a verification request is cancelled
+	EventCancelled = EventType("cancelled")
+)
+
+// Event is a verification request lifecycle event
+type Event struct {
+	Type EventType
+	// Request is the verification request, without the secret
+	Request *Request
+	// Err is the reason of failure, for events of failures (e.g. EventSendFailed, EventRejected)
+	Err  error
+	Time time.Time
+}
+
+// Observer is notified of all the verification request lifecycle events
+type Observer interface {
+	// Observe is called synchronously, after the request is updated in the store. Observers
+	// doing slow work (e.g. network calls) are expected to do it asynchronously
+	Observe(ctx context.Context, event Event)
+}
+
+// ObserverFunc is an adapter to use a function as an Observer
+type ObserverFunc func(ctx context.Context, event Event)
+
+// Observe calls fn(ctx, event)
+func (fn ObserverFunc) Observe(ctx context.Context, event Event) {
+	fn(ctx, event)
+}
+
+// AddObserver registers observers, which are notified of all events in the order of registration
+func (ver *Verifier) AddObserver(observers ...Observer) {
+	ver.observersMu.Lock()
+	defer ver.observersMu.Unlock()
+	ver.observers = append(ver.observers, observers...)
+}
+
+// emit notifies all the observers of the event
+func (ver *Verifier) emit(ctx context.Context, etype EventType, verreq *Request, err error) {
+	// metrics are recorded for the same lifecycle events which observers are notified of
+	ver.recordEvent(etype, verreq)
+
+	ver.observersMu.RLock()
+	observers := ver.observers
+	ver.observersMu.RUnlock()
+
+	if len(observers) == 0 {
+		return
+	}
+
+	event := Event{
+		Type:    etype,
+		Request: sanitized(verreq),
+		Err:     err,
+		Time:    time.Now(),
+	}
+	for _, obs := range observers {
+		obs.Observe(ctx, event)
+	}
+}
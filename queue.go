@@ -0,0 +1,544 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/naughtygopher/verifier/internal/backoff"
+)
+
+const (
+	// DefaultSendConcurrency is the default maximum number of concurrent sends by the send workers
+	DefaultSendConcurrency = 4
+	// DefaultSendMaxAttempts is the default number of attempts of a queued send, before it's failed
+	DefaultSendMaxAttempts = 5
+	// DefaultSendInitialBackoff is the default duration to wait before the first retry of a send
+	DefaultSendInitialBackoff = time.Second
+	// DefaultSendMaxBackoff is the default maximum duration to wait between retries of a send
+	DefaultSendMaxBackoff = time.Minute
+	// DefaultSendTimeout is the default timeout of a single attempt of a queued send
+	DefaultSendTimeout = time.Second * 30
+	// DefaultSendPollInterval is the default interval at which the queue is checked for due sends
+	DefaultSendPollInterval = time.Second
+)
+
+var (
+	// ErrNoSendQueue is the error returned when starting the send workers, without Config.SendQueue
+	ErrNoSendQueue = errors.New("send queue is not configured")
+	// ErrJobNotFound is the error returned by send queues when the job does not exist
+	ErrJobNotFound = errors.New("send job not found")
+)
+
+// SendJob is a queued send of the secret of a verification request. It has only the ID & type of
+// the request, and not the secret or the rendered message; which are generated & rendered by the
+// send workers at the time of sending. Jobs are deleted once they're sent, or all attempts fail
+type SendJob struct {
+	ID        string   `json:"id"`
+	RequestID string   `json:"requestId"`
+	Type      CommType `json:"type"`
+	// Subject is the subject of the email, if set explicitly while sending it
+	Subject string `json:"subject,omitempty"`
+
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	LastError     string    `json:"lastError,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// SendQueue persists the queued sends, till they're sent by the send workers. Implementations are
+// available in the stores package
+type SendQueue interface {
+	// Enqueue persists a new job
+	Enqueue(ctx context.Context, job *SendJob) error
+	// Claim returns at most limit jobs due to be attempted at now, oldest first. Claimed jobs are
+	// not returned again till the lease expires, so that jobs claimed by a worker which stopped
+	// abruptly are attempted again
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*SendJob, error)
+	// Retry updates a claimed job with its attempts, next attempt time & last error, and releases
+	// it to be claimed again at NextAttemptAt
+	Retry(ctx context.Context, job *SendJob) error
+	// Delete removes a job, once it's sent or all its attempts fail
+	Delete(ctx context.Context, id string) error
+}
+
+// SendWorkersConfig is the configuration of the send workers, all the fields are optional
+type SendWorkersConfig struct {
+	// Concurrency is the maximum number of concurrent sends
+	Concurrency int `json:"concurrency,omitempty"`
+	// MaxAttempts is the number of attempts of a send, after which the send is failed. A send is
+	// failed without further attempts if the error has a method `Retryable() bool` which returns
+	// false, or if the secret expires
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// InitialBackoff is the duration to wait before the first retry, it's doubled for every
+	// subsequent retry till MaxBackoff
+	InitialBackoff time.Duration `json:"initialBackoff,omitempty"`
+	MaxBackoff     time.Duration `json:"maxBackoff,omitempty"`
+	// Timeout is the timeout of a single attempt. Jobs are leased for twice the timeout once
+	// claimed, so that they're not claimed again while being attempted
+	Timeout      time.Duration `json:"timeout,omitempty"`
+	PollInterval time.Duration `json:"pollInterval,omitempty"`
+}
+
+func (swc *SendWorkersConfig) init() {
+	if swc.Concurrency <= 0 {
+		swc.Concurrency = DefaultSendConcurrency
+	}
+	if swc.MaxAttempts <= 0 {
+		swc.MaxAttempts = DefaultSendMaxAttempts
+	}
+	if swc.InitialBackoff <= 0 {
+		swc.InitialBackoff = DefaultSendInitialBackoff
+	}
+	if swc.MaxBackoff <= 0 {
+		swc.MaxBackoff = DefaultSendMaxBackoff
+	}
+	if swc.Timeout <= 0 {
+		swc.Timeout = DefaultSendTimeout
+	}
+	if swc.PollInterval <= 0 {
+		swc.PollInterval = DefaultSendPollInterval
+	}
+}
+
+// sendWorkers is the pool of workers sending the queued jobs
+type sendWorkers struct {
+	mu      sync.Mutex
+	started bool
+
+	// cancel cancels the context of the sends, if the workers are not stopped within the deadline
+	// of StopSendWorkers, so that the sends in progress are aborted
+	cancel  context.CancelFunc
+	wake    chan struct{}
+	stop    chan struct{}
+	workers sync.WaitGroup
+	slots   chan struct{}
+
+	// secrets are the plain text secrets of the jobs, which are hashed in the store, by job ID. They
+	// are kept only in memory, so that a job's secret is not rotated on every attempt
+	secretsMu sync.Mutex
+	secrets   map[string]queuedSecret
+}
+
+// queuedSecret is the plain text secret of a job, till the secret expires
+type queuedSecret struct {
+	secret string
+	expiry time.Time
+}
+
+// setSecret keeps the plain text secret of the job in memory, till the secret expires. Secrets of
+// the jobs which are sent by other instances are removed once they expire
+func (sw *sendWorkers) setSecret(jobID, secret string, expiry time.Time) {
+	sw.secretsMu.Lock()
+	defer sw.secretsMu.Unlock()
+
+	now := time.Now()
+	for id, js := range sw.secrets {
+		if js.expiry.Before(now) {
+			delete(sw.secrets, id)
+		}
+	}
+	sw.secrets[jobID] = queuedSecret{secret: secret, expiry: expiry}
+}
+
+// secret returns the plain text secret of the job, if it's in memory
+func (sw *sendWorkers) secret(jobID string) (string, bool) {
+	sw.secretsMu.Lock()
+	defer sw.secretsMu.Unlock()
+	js, ok := sw.secrets[jobID]
+	return js.secret, ok
+}
+
+func (sw *sendWorkers) deleteSecret(jobID string) {
+	sw.secretsMu.Lock()
+	defer sw.secretsMu.Unlock()
+	delete(sw.secrets, jobID)
+}
+
+// notify wakes up the workers to check for due jobs, without waiting for the poll interval
+func (sw *sendWorkers) notify() {
+	select {
+	case sw.wake <- struct{}{}:
+	default:
+	}
+}
+
+// StartSendWorkers starts sending the queued jobs in the background, including the ones queued
+// before a restart. StopSendWorkers should be called to stop them
+func (ver *Verifier) StartSendWorkers() error {
+	if ver.cfg.SendQueue == nil {
+		return ErrNoSendQueue
+	}
+
+	sw := ver.sendWorkers
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.started {
+		return nil
+	}
+	sw.started = true
+	ctx, cancel := context.WithCancel(context.Background())
+	sw.cancel = cancel
+	sw.stop = make(chan struct{})
+
+	sw.workers.Add(1)
+	go ver.sendLoop(ctx, sw.stop)
+	return nil
+}
+
+// StopSendWorkers stops claiming jobs, and waits for the sends in progress to complete. If ctx is
+// done before they complete, the sends are aborted & ctx's error is returned. Jobs which are not
+// sent remain in the queue, and are sent once the workers are started again
+func (ver *Verifier) StopSendWorkers(ctx context.Context) error {
+	sw := ver.sendWorkers
+	sw.mu.Lock()
+	started, stop, cancel := sw.started, sw.stop, sw.cancel
+	sw.started = false
+	sw.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	close(stop)
+	done := make(chan struct{})
+	go func() {
+		sw.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		cancel()
+		return nil
+	case <-ctx.Done():
+		cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (ver *Verifier) sendLoop(ctx context.Context, stop chan struct{}) {
+	sw := ver.sendWorkers
+	defer sw.workers.Done()
+
+	ticker := time.NewTicker(ver.cfg.SendWorkers.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		ver.sendDue(ctx)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-sw.wake:
+		}
+	}
+}
+
+// sendDue claims as many due jobs as there are free slots, and starts sending them
+func (ver *Verifier) sendDue(ctx context.Context) {
+	sw := ver.sendWorkers
+	free := cap(sw.slots) - len(sw.slots)
+	if free == 0 {
+		return
+	}
+
+	cfg := ver.cfg.SendWorkers
+	jobs, err := ver.cfg.SendQueue.Claim(ctx, time.Now(), cfg.Timeout*2, free)
+	if err != nil {
+		ver.cfg.Logger.LogAttrs(ctx, slog.LevelError, "failed claiming queued sends", slog.Any("error", err))
+		return
+	}
+
+	for _, job := range jobs {
+		// slots are acquired only by this loop, so there's a free slot for every job claimed
+		sw.slots <- struct{}{}
+		sw.workers.Add(1)
+		go func(job *SendJob) {
+			defer func() {
+				<-sw.slots
+				sw.workers.Done()
+				sw.notify()
+			}()
+			ver.sendJob(ctx, job)
+		}(job)
+	}
+}
+
+// enqueue records the send in the request's CommStatus, persists the request, and then enqueues a
+// job to send its secret. It's used instead of sending, if Config.SendQueue is set
+func (ver *Verifier) enqueue(ctx context.Context, verreq *Request, subject string) error {
+	id, err := ver.cfg.SecretGenerator.ID()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	secret := verreq.secret
+	verreq.secret = ""
+	verreq.CommStatus = append(verreq.CommStatus, CommStatus{
+		Status:    "enqueued",
+		Data:      map[string]interface{}{"job": id},
+		CreatedAt: &now,
+	})
+
+	// the request is persisted before the job is enqueued, so that the job never has a request
+	// which is not up to date
+	verreq, err = ver.store.Update(ctx, verreq.ID, verreq)
+	if err != nil {
+		return err
+	}
+
+	if ver.cfg.SecretHasher != nil && secret != "" && verreq.SecretExpiry != nil {
+		// the plain text secret is not persisted, it's kept in memory for the send workers
+		ver.sendWorkers.setSecret(id, secret, *verreq.SecretExpiry)
+	}
+
+	err = ver.cfg.SendQueue.Enqueue(ctx, &SendJob{
+		ID:            id,
+		RequestID:     verreq.ID,
+		Type:          verreq.Type,
+		Subject:       subject,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		ver.sendWorkers.deleteSecret(id)
+		err = fmt.Errorf("failed enqueuing send: %w", err)
+		verreq.setStatus(nil, err)
+		updated, uerr := ver.store.Update(context.WithoutCancel(ctx), verreq.ID, verreq)
+		if uerr == nil {
+			verreq = updated
+		}
+		ver.emit(ctx, EventSendFailed, verreq, err)
+		return err
+	}
+
+	ver.emit(ctx, EventEnqueued, verreq, nil)
+	ver.sendWorkers.notify()
+
+	return nil
+}
+
+// sendJob makes a single attempt of the job, records it in the request's CommStatus, and retries
+// or deletes the job as per the result
+func (ver *Verifier) sendJob(ctx context.Context, job *SendJob) {
+	// the outcome should be persisted even if the attempt is aborted
+	bgctx := context.WithoutCancel(ctx)
+	logger := ver.cfg.Logger.With(slog.String("job", job.ID))
+
+	verreq, err := ver.store.ReadByID(bgctx, job.RequestID)
+	if errors.Is(err, ErrNotFound) || (err == nil && verreq.Status != VerStatusPending) {
+		// the request was verified, cancelled or removed after the job was queued
+		ver.deleteJob(bgctx, logger, job)
+		return
+	}
+	if err != nil {
+		logger.LogAttrs(bgctx, slog.LevelError, "failed reading request of queued send", slog.Any("error", err))
+		ver.failedJobStore(bgctx, logger, job, err)
+		return
+	}
+
+	var (
+		status  interface{}
+		sendErr error
+	)
+	if verreq.SecretExpiry != nil && verreq.SecretExpiry.Before(time.Now()) {
+		sendErr = ErrSecretExpired
+	} else {
+		verreq, err = ver.jobSecret(bgctx, verreq, job)
+		if errors.Is(err, ErrRequestNotPending) {
+			// the request was verified or cancelled after it was read
+			ver.deleteJob(bgctx, logger, job)
+			return
+		}
+		if err != nil {
+			logger.LogAttrs(bgctx, slog.LevelError, "failed rotating secret of queued send", slog.Any("error", err))
+			ver.failedJobStore(bgctx, logger, job, err)
+			return
+		}
+		status, sendErr = ver.attemptJob(ctx, verreq, job)
+	}
+
+	// plain text secret is not required once it's sent
+	verreq.secret = ""
+	job.Attempts++
+	verreq.setAttemptStatus(status, sendErr, job.Attempts)
+	if job.Type == CommTypeMobile {
+		verreq.setProvider(providerName(ver.mobileHandler))
+	} else {
+		verreq.setProvider(providerName(ver.emailHandler))
+	}
+
+	retry := sendErr != nil && ver.retryable(ctx, job, sendErr)
+	updated, err := ver.store.Update(bgctx, verreq.ID, verreq)
+	switch {
+	case err == nil:
+		verreq = updated
+	case errors.Is(err, ErrRequestNotPending):
+		// the request was verified or cancelled while it was being sent, which is expected if the
+		// recipient verified soon after receiving the secret
+	default:
+		logger.LogAttrs(bgctx, slog.LevelError, "failed updating request of queued send", slog.Any("error", err))
+	}
+
+	switch {
+	case retry:
+		ver.retryJob(bgctx, logger, job, sendErr)
+	case sendErr != nil:
+		ver.deleteJob(bgctx, logger, job)
+		ver.emit(bgctx, EventSendFailed, verreq, sendErr)
+	default:
+		ver.deleteJob(bgctx, logger, job)
+		ver.emit(bgctx, EventSent, verreq, nil)
+	}
+}
+
+// failedJobStore retries the job which could not be attempted because of the store, or fails it
+// if all its attempts are exhausted. Since the request is not available, the failure is emitted
+// with a request which has only the ID & type of the job
+func (ver *Verifier) failedJobStore(ctx context.Context, logger *slog.Logger, job *SendJob, cause error) {
+	job.Attempts++
+	if job.Attempts < ver.cfg.SendWorkers.MaxAttempts {
+		ver.retryJob(ctx, logger, job, cause)
+		return
+	}
+
+	ver.deleteJob(ctx, logger, job)
+	ver.emit(ctx, EventSendFailed, &Request{ID: job.RequestID, Type: job.Type}, cause)
+}
+
+// jobSecret sets the plain text secret of the request to be sent by a queued send. If secrets are
+// hashed, the secret kept in memory when the job was enqueued is sent. If it's not available (e.g.
+// the job was enqueued by another instance, or before a restart) a new secret is generated &
+// persisted before it's sent, with the existing expiry; and is kept in memory for the retries
+func (ver *Verifier) jobSecret(ctx context.Context, verreq *Request, job *SendJob) (*Request, error) {
+	if ver.cfg.SecretHasher == nil {
+		verreq.secret = verreq.Secret
+		return verreq, nil
+	}
+
+	secret, ok := ver.sendWorkers.secret(job.ID)
+	if ok {
+		verreq.secret = secret
+		return verreq, nil
+	}
+
+	// the expiry is not extended, so that retries do not keep a secret valid beyond its expiry
+	expiry := verreq.SecretExpiry
+	err := ver.rotateSecret(verreq, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	verreq.SecretExpiry = expiry
+
+	secret = verreq.secret
+	updated, err := ver.store.Update(ctx, verreq.ID, verreq)
+	if err != nil {
+		return nil, err
+	}
+	updated.secret = secret
+	if expiry != nil {
+		ver.sendWorkers.setSecret(job.ID, secret, *expiry)
+	}
+
+	return updated, nil
+}
+
+// attemptJob renders the message of the job, and sends it using the email or mobile handler
+func (ver *Verifier) attemptJob(ctx context.Context, verreq *Request, job *SendJob) (interface{}, error) {
+	provider := interface{}(ver.emailHandler)
+	if job.Type == CommTypeMobile {
+		provider = ver.mobileHandler
+	}
+
+	var (
+		msg *Message
+		err error
+	)
+	if job.Type == CommTypeMobile {
+		msg = &Message{}
+		msg.Text, err = ver.mobileBody(verreq)
+	} else {
+		msg, err = ver.emailMessage(verreq, job.Subject)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ver.cfg.SendWorkers.Timeout)
+	defer cancel()
+
+	sendCtx, span := ver.startSendSpan(ctx, verreq, provider)
+	start := time.Now()
+	var (
+		status  interface{}
+		sendErr error
+	)
+	if job.Type == CommTypeMobile {
+		status, sendErr = ver.mobileHandler.Send(sendCtx, verreq.Recipient, msg.Text)
+	} else {
+		status, sendErr = ver.sendEmailMessage(sendCtx, verreq.Recipient, msg.Subject, msg)
+	}
+	ver.recordProviderCall(job.Type, provider, start, sendErr)
+	ver.logSend(ctx, verreq, provider, start, sendErr)
+	endSpan(span, outcome(sendErr), sendErr)
+
+	return status, sendErr
+}
+
+// retryable reports whether the job should be attempted again after the error. Jobs aborted
+// because the workers are stopping are attempted again, unless all their attempts are exhausted
+func (ver *Verifier) retryable(ctx context.Context, job *SendJob, err error) bool {
+	if job.Attempts >= ver.cfg.SendWorkers.MaxAttempts {
+		return false
+	}
+	if ctx.Err() != nil {
+		return true
+	}
+	if errors.Is(err, ErrSecretExpired) {
+		return false
+	}
+
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+
+	return true
+}
+
+func (ver *Verifier) retryJob(ctx context.Context, logger *slog.Logger, job *SendJob, cause error) {
+	job.LastError = cause.Error()
+	cfg := ver.cfg.SendWorkers
+	job.NextAttemptAt = time.Now().Add(backoff.Exponential(job.Attempts, cfg.InitialBackoff, cfg.MaxBackoff))
+	err := ver.cfg.SendQueue.Retry(ctx, job)
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelError, "failed retrying queued send", slog.Any("error", err))
+	}
+}
+
+func (ver *Verifier) deleteJob(ctx context.Context, logger *slog.Logger, job *SendJob) {
+	ver.sendWorkers.deleteSecret(job.ID)
+	err := ver.cfg.SendQueue.Delete(ctx, job.ID)
+	if err != nil && !errors.Is(err, ErrJobNotFound) {
+		logger.LogAttrs(ctx, slog.LevelError, "failed deleting queued send", slog.Any("error", err))
+	}
+}
+
+// setAttemptStatus records the status of an attempt of a queued send. Attempts are not counted as
+// resends, since they're recorded with the attempt number
+func (v *Request) setAttemptStatus(status interface{}, err error, attempt int) {
+	count := len(v.CommStatus)
+	v.setStatus(status, err)
+	if len(v.CommStatus) == count {
+		// providers may not return a status, the attempt is recorded nonetheless
+		now := time.Now()
+		v.CommStatus = append(v.CommStatus, CommStatus{Status: "queued", CreatedAt: &now})
+	}
+	v.CommStatus[len(v.CommStatus)-1].Attempt = attempt
+}
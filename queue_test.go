@@ -0,0 +1,556 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockqueue struct {
+	mu   sync.Mutex
+	jobs map[string]*SendJob
+	// claimed is the set of jobs claimed, and not yet retried or deleted
+	claimed map[string]bool
+}
+
+func (mq *mockqueue) Enqueue(ctx context.Context, job *SendJob) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	clone := *job
+	mq.jobs[job.ID] = &clone
+	return nil
+}
+
+func (mq *mockqueue) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*SendJob, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	jobs := make([]*SendJob, 0, limit)
+	for id, job := range mq.jobs {
+		if len(jobs) == limit {
+			break
+		}
+		if mq.claimed[id] || job.NextAttemptAt.After(now) {
+			continue
+		}
+		mq.claimed[id] = true
+		clone := *job
+		jobs = append(jobs, &clone)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+func (mq *mockqueue) Retry(ctx context.Context, job *SendJob) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	if _, ok := mq.jobs[job.ID]; !ok {
+		return ErrJobNotFound
+	}
+	clone := *job
+	mq.jobs[job.ID] = &clone
+	delete(mq.claimed, job.ID)
+	return nil
+}
+
+func (mq *mockqueue) Delete(ctx context.Context, id string) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	if _, ok := mq.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	delete(mq.jobs, id)
+	delete(mq.claimed, id)
+	return nil
+}
+
+func (mq *mockqueue) list() []*SendJob {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	jobs := make([]*SendJob, 0, len(mq.jobs))
+	for _, job := range mq.jobs {
+		clone := *job
+		jobs = append(jobs, &clone)
+	}
+	return jobs
+}
+
+type retryableError struct {
+	retryable bool
+}
+
+func (re *retryableError) Error() string {
+	return "send failed"
+}
+
+func (re *retryableError) Retryable() bool {
+	return re.retryable
+}
+
+// mockqueuedmobile fails the sends with errs in order, and succeeds once they're exhausted. If block
+// is set, sends wait till the context is done
+type mockqueuedmobile struct {
+	mu    sync.Mutex
+	errs  []error
+	block bool
+	sends int
+	body  string
+	// bodies are the bodies of all the sends
+	bodies []string
+}
+
+func (mm *mockqueuedmobile) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	mm.mu.Lock()
+	mm.sends++
+	mm.body = body
+	mm.bodies = append(mm.bodies, body)
+	block := mm.block
+	var err error
+	if len(mm.errs) > 0 {
+		err, mm.errs = mm.errs[0], mm.errs[1:]
+	}
+	mm.mu.Unlock()
+
+	if block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return "message-id", nil
+}
+
+func TestVerifier_sendQueue(t *testing.T) {
+	const recipient = "+919876543210"
+	tests := []struct {
+		name         string
+		errs         []error
+		wantEvent    EventType
+		wantAttempts int
+	}{
+		{
+			name:         "sent",
+			wantEvent:    EventSent,
+			wantAttempts: 1,
+		},
+		{
+			name:         "sent after retries",
+			errs:         []error{&retryableError{retryable: true}, errors.New("timeout")},
+			wantEvent:    EventSent,
+			wantAttempts: 3,
+		},
+		{
+			name:         "not retryable",
+			errs:         []error{&retryableError{retryable: false}},
+			wantEvent:    EventSendFailed,
+			wantAttempts: 1,
+		},
+		{
+			name:         "max attempts",
+			errs:         []error{errors.New("timeout"), errors.New("timeout"), errors.New("timeout")},
+			wantEvent:    EventSendFailed,
+			wantAttempts: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mobile := &mockqueuedmobile{errs: tt.errs}
+			verstore := &mockstore{data: map[string]*Request{}}
+			queue := &mockqueue{jobs: map[string]*SendJob{}, claimed: map[string]bool{}}
+			ver, err := New(
+				&Config{
+					MobileOTPExpiry: time.Minute,
+					SendQueue:       queue,
+					SendWorkers: SendWorkersConfig{
+						MaxAttempts:    3,
+						InitialBackoff: time.Millisecond,
+						MaxBackoff:     time.Millisecond * 5,
+						PollInterval:   time.Millisecond,
+					},
+				},
+				verstore,
+				nil,
+				mobile,
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			events := make(chan Event, 10)
+			ver.AddObserver(ObserverFunc(func(ctx context.Context, event Event) {
+				events <- event
+			}))
+
+			err = ver.NewMobile(recipient)
+			if err != nil {
+				t.Fatalf("Verifier.NewMobile() error = %v", err)
+			}
+			verreq := verstore.data["mobile-"+recipient]
+			if verreq.PlainSecret() != "" {
+				t.Fatalf("expected plain secret to be cleared once enqueued")
+			}
+			jobs := queue.list()
+			if len(jobs) != 1 || jobs[0].RequestID != verreq.ID || jobs[0].Type != CommTypeMobile {
+				t.Fatalf("expected a job of the request to be enqueued, got %+v", jobs)
+			}
+			for _, want := range []EventType{EventCreated, EventEnqueued} {
+				if event := <-events; event.Type != want {
+					t.Fatalf("expected event '%s', got '%s'", want, event.Type)
+				}
+			}
+
+			err = ver.StartSendWorkers()
+			if err != nil {
+				t.Fatalf("Verifier.StartSendWorkers() error = %v", err)
+			}
+
+			select {
+			case event := <-events:
+				if event.Type != tt.wantEvent {
+					t.Fatalf("expected event '%s', got '%s'", tt.wantEvent, event.Type)
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatalf("timed out waiting for event '%s'", tt.wantEvent)
+			}
+
+			err = ver.StopSendWorkers(context.Background())
+			if err != nil {
+				t.Fatalf("Verifier.StopSendWorkers() error = %v", err)
+			}
+
+			if len(queue.list()) != 0 {
+				t.Fatalf("expected job to be deleted")
+			}
+			// the message is rendered at the time of sending
+			if mobile.sends != tt.wantAttempts || !strings.HasPrefix(mobile.body, verreq.Secret+" ") {
+				t.Fatalf("expected %d sends of the secret, got %d of '%s'", tt.wantAttempts, mobile.sends, mobile.body)
+			}
+
+			last := verreq.CommStatus[len(verreq.CommStatus)-1]
+			if last.Attempt != tt.wantAttempts {
+				t.Fatalf("expected last status of attempt %d, got %d", tt.wantAttempts, last.Attempt)
+			}
+			// attempts of a queued send are not resends
+			if verreq.Resends != 0 {
+				t.Fatalf("expected 0 resends, got %d", verreq.Resends)
+			}
+		})
+	}
+}
+
+func TestVerifier_sendQueue_hashedSecret(t *testing.T) {
+	const recipient = "+919876543210"
+	hasher, err := NewHMACHasher([]byte("pepper"))
+	if err != nil {
+		t.Fatalf("NewHMACHasher() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		// otherInstance if set, sends the job using another verifier, which does not have the plain
+		// text secret in memory
+		otherInstance bool
+		wantRotated   bool
+	}{
+		{name: "same instance"},
+		{name: "other instance", otherInstance: true, wantRotated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the first attempt fails, so that the secret of the retry is checked
+			mobile := &mockqueuedmobile{errs: []error{errors.New("timeout")}}
+			verstore := &mockstore{data: map[string]*Request{}}
+			queue := &mockqueue{jobs: map[string]*SendJob{}, claimed: map[string]bool{}}
+			newVerifier := func() *Verifier {
+				ver, err := New(
+					&Config{
+						MobileOTPExpiry: time.Minute,
+						SecretHasher:    hasher,
+						SendQueue:       queue,
+						SendWorkers: SendWorkersConfig{
+							InitialBackoff: time.Millisecond,
+							MaxBackoff:     time.Millisecond * 5,
+							PollInterval:   time.Millisecond,
+						},
+					},
+					verstore,
+					nil,
+					mobile,
+				)
+				if err != nil {
+					t.Fatalf("failed initializing verifier: %v", err)
+				}
+				return ver
+			}
+
+			ver := newVerifier()
+			err = ver.NewMobile(recipient)
+			if err != nil {
+				t.Fatalf("Verifier.NewMobile() error = %v", err)
+			}
+			verreq := verstore.data["mobile-"+recipient]
+			hash, expiry := verreq.Secret, *verreq.SecretExpiry
+
+			sender := ver
+			if tt.otherInstance {
+				sender = newVerifier()
+			}
+			events := make(chan Event, 10)
+			sender.AddObserver(ObserverFunc(func(ctx context.Context, event Event) {
+				if event.Type == EventSent {
+					events <- event
+				}
+			}))
+			err = sender.StartSendWorkers()
+			if err != nil {
+				t.Fatalf("Verifier.StartSendWorkers() error = %v", err)
+			}
+			defer sender.StopSendWorkers(context.Background())
+
+			select {
+			case event := <-events:
+				if event.Request.PlainSecret() != "" {
+					t.Fatalf("expected plain secret to be cleared once sent")
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatalf("timed out waiting for event '%s'", EventSent)
+			}
+			_ = sender.StopSendWorkers(context.Background())
+
+			// the secret is rotated at most once per job, and its expiry is not extended
+			if len(mobile.bodies) != 2 || mobile.bodies[0] != mobile.bodies[1] {
+				t.Fatalf("expected the same secret sent on retry, got %v", mobile.bodies)
+			}
+			if rotated := verreq.Secret != hash; rotated != tt.wantRotated {
+				t.Fatalf("expected secret rotated %v, got %v", tt.wantRotated, rotated)
+			}
+			if !verreq.SecretExpiry.Equal(expiry) {
+				t.Fatalf("expected expiry '%v', got '%v'", expiry, verreq.SecretExpiry)
+			}
+
+			secret, _, _ := strings.Cut(mobile.body, " ")
+			err = ver.VerifyMobileSecret(recipient, secret)
+			if err != nil {
+				t.Fatalf("Verifier.VerifyMobileSecret() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifier_retryable(t *testing.T) {
+	ver, err := New(&Config{SendWorkers: SendWorkersConfig{MaxAttempts: 3}}, &mockstore{data: map[string]*Request{}}, nil, &mockmobile{})
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+	aborted, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		attempts int
+		err      error
+		want     bool
+	}{
+		{name: "failed", ctx: context.Background(), attempts: 1, err: errors.New("timeout"), want: true},
+		{name: "not retryable", ctx: context.Background(), attempts: 1, err: &retryableError{}, want: false},
+		{name: "expired", ctx: context.Background(), attempts: 1, err: ErrSecretExpired, want: false},
+		{name: "attempts exhausted", ctx: context.Background(), attempts: 3, err: errors.New("timeout"), want: false},
+		{name: "aborted", ctx: aborted, attempts: 1, err: &retryableError{}, want: true},
+		{name: "aborted with attempts exhausted", ctx: aborted, attempts: 3, err: context.Canceled, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ver.retryable(tt.ctx, &SendJob{Attempts: tt.attempts}, tt.err)
+			if got != tt.want {
+				t.Fatalf("expected retryable %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// failingqueue fails all the jobs enqueued
+type failingqueue struct {
+	*mockqueue
+}
+
+func (fq *failingqueue) Enqueue(ctx context.Context, job *SendJob) error {
+	return errors.New("connection refused")
+}
+
+func TestVerifier_enqueueFailed(t *testing.T) {
+	const recipient = "+919876543210"
+	verstore := &mockstore{data: map[string]*Request{}}
+	ver, err := New(
+		&Config{
+			MobileOTPExpiry: time.Minute,
+			SendQueue:       &failingqueue{mockqueue: &mockqueue{jobs: map[string]*SendJob{}, claimed: map[string]bool{}}},
+		},
+		verstore,
+		nil,
+		&mockqueuedmobile{},
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	events := make([]EventType, 0, 2)
+	ver.AddObserver(ObserverFunc(func(ctx context.Context, event Event) {
+		events = append(events, event.Type)
+	}))
+
+	err = ver.NewMobile(recipient)
+	if err == nil {
+		t.Fatalf("expected error enqueuing send")
+	}
+
+	// the request is persisted before the job is enqueued, and the failure is recorded
+	verreq := verstore.data["mobile-"+recipient]
+	if len(verreq.CommStatus) != 2 || verreq.CommStatus[0].Status != "enqueued" || verreq.CommStatus[1].Status != "failed" {
+		t.Fatalf("expected enqueued & failed statuses, got %+v", verreq.CommStatus)
+	}
+	if len(events) != 2 || events[1] != EventSendFailed {
+		t.Fatalf("expected event '%s', got %v", EventSendFailed, events)
+	}
+}
+
+// readfailingstore fails reading the requests by ID
+type readfailingstore struct {
+	*mockstore
+}
+
+func (rfs *readfailingstore) ReadByID(ctx context.Context, verID string) (*Request, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestVerifier_sendQueue_readFailed(t *testing.T) {
+	const recipient = "+919876543210"
+	queue := &mockqueue{jobs: map[string]*SendJob{}, claimed: map[string]bool{}}
+	ver, err := New(
+		&Config{
+			MobileOTPExpiry: time.Minute,
+			SendQueue:       queue,
+			SendWorkers: SendWorkersConfig{
+				MaxAttempts:    2,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond * 5,
+				PollInterval:   time.Millisecond,
+			},
+		},
+		&readfailingstore{mockstore: &mockstore{data: map[string]*Request{}}},
+		nil,
+		&mockqueuedmobile{},
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	events := make(chan Event, 10)
+	ver.AddObserver(ObserverFunc(func(ctx context.Context, event Event) {
+		if event.Type == EventSendFailed {
+			events <- event
+		}
+	}))
+
+	err = ver.NewMobile(recipient)
+	if err != nil {
+		t.Fatalf("Verifier.NewMobile() error = %v", err)
+	}
+	jobs := queue.list()
+	err = ver.StartSendWorkers()
+	if err != nil {
+		t.Fatalf("Verifier.StartSendWorkers() error = %v", err)
+	}
+	defer ver.StopSendWorkers(context.Background())
+
+	select {
+	case event := <-events:
+		if event.Request.ID != jobs[0].RequestID || event.Err == nil {
+			t.Fatalf("expected failure of request %s, got %+v", jobs[0].RequestID, event)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("timed out waiting for event '%s'", EventSendFailed)
+	}
+
+	_ = ver.StopSendWorkers(context.Background())
+	if len(queue.list()) != 0 {
+		t.Fatalf("expected job to be deleted")
+	}
+}
+
+func TestVerifier_StopSendWorkers(t *testing.T) {
+	const recipient = "+919876543210"
+	mobile := &mockqueuedmobile{block: true}
+	verstore := &mockstore{data: map[string]*Request{}}
+	queue := &mockqueue{jobs: map[string]*SendJob{}, claimed: map[string]bool{}}
+	ver, err := New(
+		&Config{
+			MobileOTPExpiry: time.Minute,
+			SendQueue:       queue,
+			SendWorkers:     SendWorkersConfig{PollInterval: time.Millisecond},
+		},
+		verstore,
+		nil,
+		mobile,
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	err = ver.NewMobile(recipient)
+	if err != nil {
+		t.Fatalf("Verifier.NewMobile() error = %v", err)
+	}
+	err = ver.StartSendWorkers()
+	if err != nil {
+		t.Fatalf("Verifier.StartSendWorkers() error = %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		mobile.mu.Lock()
+		sends := mobile.sends
+		mobile.mu.Unlock()
+		if sends > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the send")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	err = ver.StopSendWorkers(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected error '%v', got '%v'", context.DeadlineExceeded, err)
+	}
+
+	// aborted sends remain in the queue, to be sent once the workers are started again
+	jobs := queue.list()
+	if len(jobs) != 1 || jobs[0].Attempts != 1 || jobs[0].LastError == "" {
+		t.Fatalf("expected the aborted job to be retried, got %+v", jobs)
+	}
+
+	err = ver.StopSendWorkers(context.Background())
+	if err != nil {
+		t.Fatalf("expected stopping stopped workers to be a no-op, got '%v'", err)
+	}
+}
+
+func TestVerifier_StartSendWorkers(t *testing.T) {
+	ver, err := New(&Config{}, &mockstore{data: map[string]*Request{}}, nil, &mockmobile{})
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	err = ver.StartSendWorkers()
+	if !errors.Is(err, ErrNoSendQueue) {
+		t.Fatalf("expected error '%v', got '%v'", ErrNoSendQueue, err)
+	}
+}
@@ -0,0 +1,173 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrRateLimited is the error returned when a verification request is not sent since a rate
+// limit is reached. The error returned is a *RateLimitError, which has the scope of the limit &
+// the duration after which it can be retried
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimitScope is the scope to which a rate limit applies
+type RateLimitScope string
+
+const (
+	// RateLimitScopeRecipient limits the requests sent to an email address or mobile number
+	RateLimitScopeRecipient = RateLimitScope("recipient")
+	// RateLimitScopeCountry limits the requests sent to mobile numbers of a country calling code
+	RateLimitScopeCountry = RateLimitScope("country")
+	// RateLimitScopeClient limits the requests made by a client, identified by the client key in
+	// the context. Refer WithClientKey
+	RateLimitScopeClient = RateLimitScope("client")
+	// RateLimitScopeGlobal limits all the requests of a communication type
+	RateLimitScopeGlobal = RateLimitScope("global")
+)
+
+// RateLimitError is the error returned when a rate limit is reached
+type RateLimitError struct {
+	Scope RateLimitScope
+	// RetryAfter is the duration after which the request would be allowed
+	RetryAfter time.Duration
+}
+
+func (rle *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: %s limit reached, retry after %s", ErrRateLimited, rle.Scope, rle.RetryAfter)
+}
+
+// Is reports whether target is ErrRateLimited, so that errors.Is(err, ErrRateLimited) can be used
+func (rle *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimitHit is a hit of a key, which is allowed only if there are lesser than Limit.Max hits of
+// the key within the last Limit.Window
+type RateLimitHit struct {
+	Key   string
+	Limit RateLimit
+}
+
+// RateLimiter keeps track of hits of keys within a sliding window. Memory & Redis implementations
+// are available in the ratelimit package
+type RateLimiter interface {
+	// Allow records all the hits atomically, if every one of them is allowed. If the limit of any
+	// of them is reached, none of the hits are recorded; and the index of the first hit which is
+	// not allowed is returned, along with the duration after which it would be allowed
+	Allow(ctx context.Context, hits []RateLimitHit) (denied int, retryAfter time.Duration, err error)
+}
+
+// RateLimit is the maximum number of requests allowed within a sliding window
+type RateLimit struct {
+	Max    int           `json:"max,omitempty"`
+	Window time.Duration `json:"window,omitempty"`
+}
+
+func (rl RateLimit) enabled() bool {
+	return rl.Max > 0 && rl.Window > 0
+}
+
+// RateLimits are the limits of each scope, a limit is not applied if it's not set
+type RateLimits struct {
+	Recipient RateLimit `json:"recipient,omitempty"`
+	// Country is applied only to mobile numbers, refer CountryCallingCode
+	Country RateLimit `json:"country,omitempty"`
+	Client  RateLimit `json:"client,omitempty"`
+	Global  RateLimit `json:"global,omitempty"`
+}
+
+type clientKeyCtx struct{}
+
+// WithClientKey returns a child context of ctx with the client key set, which is used to rate
+// limit requests made by a client (e.g. IP address or user ID)
+func WithClientKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, clientKeyCtx{}, key)
+}
+
+// ClientKey returns the client key set in the context using WithClientKey
+func ClientKey(ctx context.Context) string {
+	key, _ := ctx.Value(clientKeyCtx{}).(string)
+	return key
+}
+
+// countryCodes2 are all the 2 digit country calling codes. Calling codes are prefix free, so a
+// number which does not start with a 1 or 2 digit calling code has a 3 digit calling code
+var countryCodes2 = map[string]bool{
+	"20": true, "27": true, "30": true, "31": true, "32": true, "33": true, "34": true, "36": true,
+	"39": true, "40": true, "41": true, "43": true, "44": true, "45": true, "46": true, "47": true,
+	"48": true, "49": true, "51": true, "52": true, "53": true, "54": true, "55": true, "56": true,
+	"57": true, "58": true, "60": true, "61": true, "62": true, "63": true, "64": true, "65": true,
+	"66": true, "81": true, "82": true, "84": true, "86": true, "90": true, "91": true, "92": true,
+	"93": true, "94": true, "95": true, "98": true,
+}
+
+// CountryCallingCode returns the country calling code (e.g. "+91") of a mobile number in the
+// international format, or an empty string if the number is not in the international format
+func CountryCallingCode(mobile string) string {
+	if !strings.HasPrefix(mobile, "+") || len(mobile) < 4 {
+		return ""
+	}
+
+	digits := mobile[1:]
+	switch {
+	case digits[0] == '1' || digits[0] == '7':
+		return "+" + digits[:1]
+	case countryCodes2[digits[:2]]:
+		return "+" + digits[:2]
+	}
+
+	return "+" + digits[:3]
+}
+
+// rateLimit applies all the configured rate limits for a request to be sent to the recipient.
+// The hits of all the limits are recorded atomically, so that a request denied by one limit
+// (e.g. global) is not counted towards the others (e.g. of a single recipient)
+func (ver *Verifier) rateLimit(ctx context.Context, ctype CommType, recipient string) error {
+	if ver.cfg.RateLimiter == nil {
+		return nil
+	}
+
+	limits := ver.cfg.RateLimits
+	rules := []struct {
+		scope RateLimitScope
+		key   string
+		limit RateLimit
+	}{
+		{scope: RateLimitScopeRecipient, key: recipient, limit: limits.Recipient},
+		{scope: RateLimitScopeClient, key: ClientKey(ctx), limit: limits.Client},
+		{scope: RateLimitScopeCountry, limit: limits.Country},
+		{scope: RateLimitScopeGlobal, key: "all", limit: limits.Global},
+	}
+	if ctype == CommTypeMobile {
+		rules[2].key = CountryCallingCode(recipient)
+	}
+
+	scopes := make([]RateLimitScope, 0, len(rules))
+	hits := make([]RateLimitHit, 0, len(rules))
+	for _, rule := range rules {
+		if rule.key == "" || !rule.limit.enabled() {
+			continue
+		}
+		scopes = append(scopes, rule.scope)
+		hits = append(hits, RateLimitHit{
+			Key:   fmt.Sprintf("%s:%s:%s", rule.scope, ctype, rule.key),
+			Limit: rule.limit,
+		})
+	}
+	if len(hits) == 0 {
+		return nil
+	}
+
+	denied, retryAfter, err := ver.cfg.RateLimiter.Allow(ctx, hits)
+	if err != nil {
+		return err
+	}
+	if retryAfter > 0 {
+		return &RateLimitError{Scope: scopes[denied], RetryAfter: retryAfter}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// sweepInterval is the minimum interval between removal of keys with no hits within their window
+const sweepInterval = time.Minute
+
+type memoryLog struct {
+	window time.Duration
+	// hits are the times of all the hits within the window, in ascending order
+	hits []time.Time
+}
+
+// prune removes the hits which are outside the window
+func (ml *memoryLog) prune(now time.Time) {
+	start := now.Add(-ml.window)
+	i := 0
+	for i < len(ml.hits) && !ml.hits[i].After(start) {
+		i++
+	}
+	ml.hits = ml.hits[i:]
+}
+
+// Memory is a rate limiter which keeps all the hits in memory. It is safe for concurrent use,
+// though limits are applied only within a single process
+type Memory struct {
+	mu        sync.Mutex
+	logs      map[string]*memoryLog
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// Allow records all the hits, if every one of them is allowed. If the limit of any of them is
+// reached, none of the hits are recorded; and the index of the first hit which is not allowed is
+// returned, along with the duration after which it would be allowed
+func (mem *Memory) Allow(ctx context.Context, hits []verifier.RateLimitHit) (int, time.Duration, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	now := mem.now()
+	mem.sweep(now)
+
+	logs := make([]*memoryLog, 0, len(hits))
+	for i, hit := range hits {
+		log, ok := mem.logs[hit.Key]
+		if !ok {
+			log = &memoryLog{}
+			mem.logs[hit.Key] = log
+		}
+		log.window = hit.Limit.Window
+		log.prune(now)
+
+		if len(log.hits) >= hit.Limit.Max {
+			return i, retryAfter(log.hits[0], now, hit.Limit.Window), nil
+		}
+		logs = append(logs, log)
+	}
+
+	for _, log := range logs {
+		log.hits = append(log.hits, now)
+	}
+	return 0, 0, nil
+}
+
+// sweep removes all the keys which have no hits within their window
+func (mem *Memory) sweep(now time.Time) {
+	if now.Sub(mem.lastSweep) < sweepInterval {
+		return
+	}
+	mem.lastSweep = now
+
+	for key, log := range mem.logs {
+		log.prune(now)
+		if len(log.hits) == 0 {
+			delete(mem.logs, key)
+		}
+	}
+}
+
+// NewMemory returns a new in-memory rate limiter
+func NewMemory() *Memory {
+	return &Memory{
+		logs: map[string]*memoryLog{},
+		now:  time.Now,
+	}
+}
@@ -0,0 +1,19 @@
+// Package ratelimit has sliding window rate limiters, which are used by verifier to limit the
+// number of verification requests sent. Every hit within the window is logged, and a hit is
+// allowed only if the number of hits within the last window is lesser than the limit
+package ratelimit
+
+import (
+	"time"
+)
+
+// retryAfter returns the duration after which a hit would be allowed, given the time of the oldest
+// hit within the window
+func retryAfter(oldest, now time.Time, window time.Duration) time.Duration {
+	wait := oldest.Add(window).Sub(now)
+	if wait <= 0 {
+		// the oldest hit is outside the window by the time it's computed
+		return time.Millisecond
+	}
+	return wait
+}
@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// clock is a manually advanced clock, so that windows can be tested without sleeping. The time of
+// miniredis is also set, if it's used
+type clock struct {
+	now time.Time
+	mr  *miniredis.Miniredis
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Set(now time.Time) {
+	c.now = now
+	if c.mr != nil {
+		c.mr.SetTime(now)
+	}
+}
+
+func newTestRedis(t *testing.T, c *clock) *Redis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{mr.Addr()}})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	c.mr = mr
+	c.Set(c.now)
+	return NewRedis(client)
+}
+
+func newTestMemory(t *testing.T, c *clock) *Memory {
+	mem := NewMemory()
+	mem.now = c.Now
+	return mem
+}
+
+func TestAllow(t *testing.T) {
+	const (
+		limit  = 3
+		window = time.Minute
+	)
+
+	backends := []struct {
+		name    string
+		limiter func(t *testing.T, c *clock) verifier.RateLimiter
+	}{
+		{
+			name:    "memory",
+			limiter: func(t *testing.T, c *clock) verifier.RateLimiter { return newTestMemory(t, c) },
+		},
+		{
+			name:    "redis",
+			limiter: func(t *testing.T, c *clock) verifier.RateLimiter { return newTestRedis(t, c) },
+		},
+	}
+
+	tests := []struct {
+		name string
+		// hits are the offsets from the start, at which hits are made
+		hits []time.Duration
+		// want are the expected retry after durations of every hit
+		want []time.Duration
+	}{
+		{
+			name: "within limit",
+			hits: []time.Duration{0, time.Second, time.Second * 2},
+			want: []time.Duration{0, 0, 0},
+		},
+		{
+			name: "limit exceeded",
+			hits: []time.Duration{0, time.Second, time.Second * 2, time.Second * 3},
+			want: []time.Duration{0, 0, 0, time.Second * 57},
+		},
+		{
+			name: "denied hits are not recorded",
+			hits: []time.Duration{0, time.Second, time.Second * 2, time.Second * 3, time.Second * 30, window + time.Second},
+			want: []time.Duration{0, 0, 0, time.Second * 57, time.Second * 30, 0},
+		},
+		{
+			name: "sliding window",
+			hits: []time.Duration{0, time.Second * 20, time.Second * 40, window, window + time.Second, window + time.Second*20},
+			want: []time.Duration{0, 0, 0, 0, time.Second * 19, 0},
+		},
+	}
+	for _, backend := range backends {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				start := time.Now().Truncate(time.Second)
+				c := &clock{now: start}
+				lim := backend.limiter(t, c)
+				hits := []verifier.RateLimitHit{{Key: "key", Limit: verifier.RateLimit{Max: limit, Window: window}}}
+
+				for i, hit := range tt.hits {
+					c.Set(start.Add(hit))
+					_, got, err := lim.Allow(context.Background(), hits)
+					if err != nil {
+						t.Fatalf("Allow() error = %v", err)
+					}
+					if got != tt.want[i] {
+						t.Fatalf("hit %d: expected retry after %v, got %v", i, tt.want[i], got)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestAllow_keys(t *testing.T) {
+	c := &clock{now: time.Now()}
+	mem := newTestMemory(t, c)
+
+	limit := verifier.RateLimit{Max: 1, Window: time.Minute}
+	for _, key := range []string{"recipient:a", "recipient:b"} {
+		_, got, err := mem.Allow(context.Background(), []verifier.RateLimitHit{{Key: key, Limit: limit}})
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		if got != 0 {
+			t.Fatalf("expected hit of key '%s' to be allowed, got retry after %v", key, got)
+		}
+	}
+
+	// keys with no hits within the window are removed
+	c.now = c.now.Add(time.Hour)
+	_, _, _ = mem.Allow(context.Background(), []verifier.RateLimitHit{{Key: "recipient:c", Limit: limit}})
+	if len(mem.logs) != 1 {
+		t.Fatalf("expected 1 key, got %d", len(mem.logs))
+	}
+}
+
+func TestAllow_multiple(t *testing.T) {
+	backends := []struct {
+		name    string
+		limiter func(t *testing.T, c *clock) verifier.RateLimiter
+	}{
+		{
+			name:    "memory",
+			limiter: func(t *testing.T, c *clock) verifier.RateLimiter { return newTestMemory(t, c) },
+		},
+		{
+			name:    "redis",
+			limiter: func(t *testing.T, c *clock) verifier.RateLimiter { return newTestRedis(t, c) },
+		},
+	}
+	recipient := verifier.RateLimitHit{Key: "recipient", Limit: verifier.RateLimit{Max: 2, Window: time.Minute}}
+	global := verifier.RateLimitHit{Key: "global", Limit: verifier.RateLimit{Max: 1, Window: time.Minute}}
+
+	tests := []struct {
+		name       string
+		hits       []verifier.RateLimitHit
+		wantDenied int
+		wantRetry  time.Duration
+	}{
+		{name: "all allowed", hits: []verifier.RateLimitHit{recipient, global}},
+		{name: "second denied", hits: []verifier.RateLimitHit{recipient, global}, wantDenied: 1, wantRetry: time.Minute},
+		// the hit of the recipient denied by the global limit should not have been recorded
+		{name: "first allowed", hits: []verifier.RateLimitHit{recipient}},
+		{name: "first denied", hits: []verifier.RateLimitHit{recipient, global}, wantRetry: time.Minute},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			c := &clock{now: time.Now().Truncate(time.Second)}
+			lim := backend.limiter(t, c)
+
+			for _, tt := range tests {
+				denied, retryAfter, err := lim.Allow(context.Background(), tt.hits)
+				if err != nil {
+					t.Fatalf("%s: Allow() error = %v", tt.name, err)
+				}
+				if denied != tt.wantDenied || retryAfter != tt.wantRetry {
+					t.Fatalf(
+						"%s: expected hit %d denied with retry after %v, got %d with %v",
+						tt.name, tt.wantDenied, tt.wantRetry, denied, retryAfter,
+					)
+				}
+			}
+		})
+	}
+}
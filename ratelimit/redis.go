@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/naughtygopher/verifier"
+	"github.com/naughtygopher/verifier/internal/redisutil"
+)
+
+// redisAllowScript maintains the log of hits of every key in a sorted set scored by the time of the
+// hit (in milliseconds), using the time of Redis so that the clocks of the app instances don't
+// matter. ARGV[1] is the member of the hits, followed by the limit & window (in milliseconds) of
+// every key. The hits are recorded only if all of them are allowed, and the index of the first
+// hit which is not allowed is returned along with the milliseconds after which it'd be allowed;
+// or 0 if all the hits are allowed
+var redisAllowScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[i * 2])
+	local window = tonumber(ARGV[i * 2 + 1])
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	if redis.call('ZCARD', key) >= limit then
+		local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+		local wait = tonumber(oldest[2]) + window - now
+		if wait < 1 then
+			wait = 1
+		end
+		return {i - 1, wait}
+	end
+end
+for i, key in ipairs(KEYS) do
+	redis.call('ZADD', key, now, ARGV[1])
+	redis.call('PEXPIRE', key, ARGV[i * 2 + 1])
+end
+return {0, 0}
+`)
+
+// Redis is a rate limiter which keeps the hits in Redis, so that limits are applied across all
+// the instances of the app. All the keys have the same hash tag, so that the hits of a request
+// are recorded atomically when using Redis cluster
+type Redis struct {
+	client redis.UniversalClient
+	prefix string
+	seq    uint64
+}
+
+// Allow records all the hits, if every one of them is allowed. If the limit of any of them is
+// reached, none of the hits are recorded; and the index of the first hit which is not allowed is
+// returned, along with the duration after which it would be allowed
+func (ris *Redis) Allow(ctx context.Context, hits []verifier.RateLimitHit) (int, time.Duration, error) {
+	// every hit should be a unique member of the sorted set, even if they're at the same time
+	member := fmt.Sprintf("%d-%d", time.Now().UnixNano(), atomic.AddUint64(&ris.seq, 1))
+
+	keys := make([]string, 0, len(hits))
+	args := make([]interface{}, 0, len(hits)*2+1)
+	args = append(args, member)
+	for _, hit := range hits {
+		keys = append(keys, ris.prefix+hit.Key)
+		args = append(args, hit.Limit.Max, hit.Limit.Window.Milliseconds())
+	}
+
+	result, err := redisAllowScript.Run(redisutil.WithContext(ctx, ris.client), keys, args...).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	values, _ := result.([]interface{})
+	if len(values) != 2 {
+		return 0, 0, fmt.Errorf("unexpected result of rate limit script: %v", result)
+	}
+	denied, _ := values[0].(int64)
+	wait, _ := values[1].(int64)
+
+	return int(denied), time.Duration(wait) * time.Millisecond, nil
+}
+
+// NewRedis returns a rate limiter using the client. All the keys are prefixed with
+// '{verifier:ratelimit}:'
+func NewRedis(client redis.UniversalClient) *Redis {
+	return &Redis{
+		client: client,
+		prefix: "{verifier:ratelimit}:",
+	}
+}
@@ -0,0 +1,193 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCountryCallingCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		mobile string
+		want   string
+	}{
+		{name: "1 digit", mobile: "+14155550100", want: "+1"},
+		{name: "2 digit", mobile: "+919876543210", want: "+91"},
+		{name: "3 digit", mobile: "+2348012345678", want: "+234"},
+		{name: "not international", mobile: "9876543210", want: ""},
+		{name: "too short", mobile: "+91", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CountryCallingCode(tt.mobile); got != tt.want {
+				t.Fatalf("expected '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestVerifier_rateLimit(t *testing.T) {
+	limit := RateLimit{Max: 1, Window: time.Hour}
+	tests := []struct {
+		name   string
+		limits RateLimits
+		// first & second are the recipient & client key of the requests made
+		first     [2]string
+		second    [2]string
+		wantScope RateLimitScope
+	}{
+		{
+			name:      "recipient",
+			limits:    RateLimits{Recipient: limit},
+			first:     [2]string{"+919876543210", "10.0.0.1"},
+			second:    [2]string{"+919876543210", "10.0.0.2"},
+			wantScope: RateLimitScopeRecipient,
+		},
+		{
+			name:   "different recipients",
+			limits: RateLimits{Recipient: limit},
+			first:  [2]string{"+919876543210", "10.0.0.1"},
+			second: [2]string{"+919876543211", "10.0.0.1"},
+		},
+		{
+			name:      "client",
+			limits:    RateLimits{Client: limit},
+			first:     [2]string{"+919876543210", "10.0.0.1"},
+			second:    [2]string{"+919876543211", "10.0.0.1"},
+			wantScope: RateLimitScopeClient,
+		},
+		{
+			name:      "country",
+			limits:    RateLimits{Country: limit},
+			first:     [2]string{"+919876543210", "10.0.0.1"},
+			second:    [2]string{"+919876543211", "10.0.0.2"},
+			wantScope: RateLimitScopeCountry,
+		},
+		{
+			name:   "different countries",
+			limits: RateLimits{Country: limit},
+			first:  [2]string{"+919876543210", "10.0.0.1"},
+			second: [2]string{"+14155550100", "10.0.0.2"},
+		},
+		{
+			name:      "global",
+			limits:    RateLimits{Global: limit},
+			first:     [2]string{"+919876543210", "10.0.0.1"},
+			second:    [2]string{"+14155550100", "10.0.0.2"},
+			wantScope: RateLimitScopeGlobal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ver, err := New(
+				&Config{
+					MobileOTPExpiry: time.Minute,
+					RateLimiter:     &mocklimiter{},
+					RateLimits:      tt.limits,
+				},
+				&mockstore{data: map[string]*Request{}},
+				nil,
+				&mockmobile{},
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			err = ver.NewMobileContext(WithClientKey(context.Background(), tt.first[1]), tt.first[0])
+			if err != nil {
+				t.Fatalf("Verifier.NewMobileContext() error = %v", err)
+			}
+
+			err = ver.NewMobileContext(WithClientKey(context.Background(), tt.second[1]), tt.second[0])
+			if tt.wantScope == "" {
+				if err != nil {
+					t.Fatalf("Verifier.NewMobileContext() error = %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrRateLimited) {
+				t.Fatalf("expected error '%v', got '%v'", ErrRateLimited, err)
+			}
+			rlErr := &RateLimitError{}
+			if !errors.As(err, &rlErr) {
+				t.Fatalf("expected error of type %T, got %T", rlErr, err)
+			}
+			if rlErr.Scope != tt.wantScope {
+				t.Fatalf("expected scope '%s', got '%s'", tt.wantScope, rlErr.Scope)
+			}
+			if rlErr.RetryAfter <= 0 || rlErr.RetryAfter > limit.Window {
+				t.Fatalf("expected retry after within (0, %v], got %v", limit.Window, rlErr.RetryAfter)
+			}
+		})
+	}
+}
+
+// mocklimiter allows Limit.Max hits of a key irrespective of the window, and records the keys of
+// all the hits allowed
+type mocklimiter struct {
+	mu      sync.Mutex
+	hits    map[string]int
+	allowed []string
+}
+
+func (ml *mocklimiter) Allow(ctx context.Context, hits []RateLimitHit) (int, time.Duration, error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	if ml.hits == nil {
+		ml.hits = map[string]int{}
+	}
+
+	for i, hit := range hits {
+		if ml.hits[hit.Key] >= hit.Limit.Max {
+			return i, hit.Limit.Window, nil
+		}
+	}
+	for _, hit := range hits {
+		ml.hits[hit.Key]++
+		ml.allowed = append(ml.allowed, hit.Key)
+	}
+	return 0, 0, nil
+}
+
+func TestVerifier_rateLimit_denied(t *testing.T) {
+	limit := RateLimit{Max: 1, Window: time.Hour}
+	limiter := &mocklimiter{}
+	ver, err := New(
+		&Config{
+			MobileOTPExpiry: time.Minute,
+			RateLimiter:     limiter,
+			RateLimits:      RateLimits{Recipient: limit, Global: limit},
+		},
+		&mockstore{data: map[string]*Request{}},
+		nil,
+		&mockmobile{},
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	err = ver.NewMobile("+919876543210")
+	if err != nil {
+		t.Fatalf("Verifier.NewMobile() error = %v", err)
+	}
+
+	err = ver.NewMobile("+919876543211")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected error '%v', got '%v'", ErrRateLimited, err)
+	}
+
+	// the request denied by the global limit should not be counted towards the recipient's limit
+	want := []string{"recipient:mobile:+919876543210", "global:mobile:all"}
+	if len(limiter.allowed) != len(want) {
+		t.Fatalf("expected hits %v, got %v", want, limiter.allowed)
+	}
+	for i := range want {
+		if limiter.allowed[i] != want[i] {
+			t.Fatalf("expected hits %v, got %v", want, limiter.allowed)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package verifier
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// DefaultEmailSecretLength is the length of the alpha numeric secret generated for emails
+	DefaultEmailSecretLength = 256
+	// DefaultMobileSecretLength is the length of the numeric secret (OTP) generated for mobile numbers
+	DefaultMobileSecretLength = 6
+
+	idLength = 32
+)
+
+const (
+	// DefaultArgon2idTime is the default number of passes over the memory, of Argon2idHasher
+	DefaultArgon2idTime = 3
+	// DefaultArgon2idMemory is the default size of the memory in KiB, of Argon2idHasher
+	DefaultArgon2idMemory = 64 * 1024
+	// DefaultArgon2idThreads is the default number of threads used by Argon2idHasher
+	DefaultArgon2idThreads = 4
+	// DefaultArgon2idKeyLength is the default length of the hash generated by Argon2idHasher
+	DefaultArgon2idKeyLength = 32
+	// DefaultArgon2idSaltLength is the default length of the random salt of Argon2idHasher
+	DefaultArgon2idSaltLength = 16
+)
+
+// SecretGenerator generates the secrets & IDs of verification requests
+type SecretGenerator interface {
+	// Secret returns a new secret for the communication type
+	Secret(ctype CommType) (string, error)
+	// ID returns a new unique ID for a verification request
+	ID() (string, error)
+}
+
+// RandomSecretGenerator generates secrets by uniformly sampling characters using the
+// random source Reader
+type RandomSecretGenerator struct {
+	// Reader is the source of entropy, crypto/rand.Reader is used if not set
+	Reader io.Reader
+	// EmailSecretLength is the length of alpha numeric secrets generated for emails.
+	// DefaultEmailSecretLength is used if not set
+	EmailSecretLength int
+	// MobileSecretLength is the length of numeric secrets generated for mobile numbers.
+	// DefaultMobileSecretLength is used if not set
+	MobileSecretLength int
+}
+
+func (rsg *RandomSecretGenerator) reader() io.Reader {
+	if rsg.Reader == nil {
+		return rand.Reader
+	}
+	return rsg.Reader
+}
+
+// Secret returns a new alpha numeric secret for emails, and a numeric secret for mobile numbers
+func (rsg *RandomSecretGenerator) Secret(ctype CommType) (string, error) {
+	if ctype == CommTypeMobile {
+		length := rsg.MobileSecretLength
+		if length < 1 {
+			length = DefaultMobileSecretLength
+		}
+		return randRune(rsg.reader(), numericList, length)
+	}
+
+	length := rsg.EmailSecretLength
+	if length < 1 {
+		length = DefaultEmailSecretLength
+	}
+	return randRune(rsg.reader(), alphaNumericList, length)
+}
+
+// ID returns a new 32 character long alpha numeric ID
+func (rsg *RandomSecretGenerator) ID() (string, error) {
+	return randRune(rsg.reader(), alphaNumericList, idLength)
+}
+
+// SecretHasher hashes the secrets of verification requests before they're persisted, so that
+// the store never has the plain text secret
+type SecretHasher interface {
+	// Hash returns the hash of the secret, which is persisted in the store
+	Hash(secret string) (string, error)
+	// Compare reports whether the secret matches the hashed secret. The comparison is
+	// expected to be done in constant time
+	Compare(hashed, secret string) (bool, error)
+}
+
+// HMACHasher hashes secrets using HMAC-SHA256, keyed with a server side pepper
+type HMACHasher struct {
+	pepper []byte
+}
+
+// Hash returns the hex encoded HMAC-SHA256 of the secret
+func (hh *HMACHasher) Hash(secret string) (string, error) {
+	mac := hmac.New(sha256.New, hh.pepper)
+	_, err := mac.Write([]byte(secret))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Compare reports whether the HMAC of secret matches the hashed secret, in constant time
+func (hh *HMACHasher) Compare(hashed, secret string) (bool, error) {
+	want, err := hex.DecodeString(hashed)
+	if err != nil {
+		return false, ErrInvalidSecretHash
+	}
+
+	mac := hmac.New(sha256.New, hh.pepper)
+	_, err = mac.Write([]byte(secret))
+	if err != nil {
+		return false, err
+	}
+
+	return hmac.Equal(want, mac.Sum(nil)), nil
+}
+
+// NewHMACHasher returns an HMACHasher using the pepper as the key. The pepper should be a
+// random value of at least 32 bytes, and should not be persisted along with the requests
+func NewHMACHasher(pepper []byte) (*HMACHasher, error) {
+	if len(pepper) == 0 {
+		return nil, ErrEmptyPepper
+	}
+
+	return &HMACHasher{
+		pepper: pepper,
+	}, nil
+}
+
+// Argon2idHasher hashes secrets using argon2id, with a random salt per secret. The defaults are
+// used for the parameters which are not set, so the zero value is ready to use
+type Argon2idHasher struct {
+	// Time is the number of passes over the memory
+	Time uint32
+	// Memory is the size of the memory in KiB
+	Memory uint32
+	// Threads is the number of threads used
+	Threads uint8
+	// KeyLength is the length of the hash generated
+	KeyLength uint32
+	// SaltLength is the length of the random salt generated per secret
+	SaltLength uint32
+}
+
+// Hash returns the argon2id hash of the secret, encoded in the PHC string format
+// i.e. $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+func (ah *Argon2idHasher) Hash(secret string) (string, error) {
+	params := ah.withDefaults()
+	salt := make([]byte, params.SaltLength)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(secret), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Time,
+		params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// withDefaults returns the parameters of the hasher, with the defaults for the ones not set
+func (ah *Argon2idHasher) withDefaults() Argon2idHasher {
+	params := *ah
+	if params.Time == 0 {
+		params.Time = DefaultArgon2idTime
+	}
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2idMemory
+	}
+	if params.Threads == 0 {
+		params.Threads = DefaultArgon2idThreads
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = DefaultArgon2idKeyLength
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = DefaultArgon2idSaltLength
+	}
+	return params
+}
+
+// limits returns the highest parameters of the hashes compared, which are the parameters of the
+// hasher or the defaults; whichever are higher
+func (ah *Argon2idHasher) limits() Argon2idHasher {
+	limits := ah.withDefaults()
+	limits.Time = max(limits.Time, DefaultArgon2idTime)
+	limits.Memory = max(limits.Memory, DefaultArgon2idMemory)
+	limits.Threads = max(limits.Threads, DefaultArgon2idThreads)
+	limits.KeyLength = max(limits.KeyLength, DefaultArgon2idKeyLength)
+	return limits
+}
+
+// Compare reports whether the argon2id hash of secret matches the hashed secret, in constant time.
+// The parameters encoded in hashed are used, so that hashes continue to work after the parameters
+// of the hasher are changed. Parameters (or hash length) higher than both the hasher's & the
+// defaults are rejected, so that a tampered hash cannot exhaust the memory or CPU
+func (ah *Argon2idHasher) Compare(hashed, secret string) (bool, error) {
+	limits := ah.limits()
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrInvalidSecretHash
+	}
+
+	version := 0
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return false, ErrInvalidSecretHash
+	}
+
+	var (
+		memory, time uint32
+		threads      uint8
+	)
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads)
+	if err != nil || time < 1 || threads < 1 {
+		return false, ErrInvalidSecretHash
+	}
+	if time > limits.Time || memory > limits.Memory || threads > limits.Threads {
+		return false, ErrInvalidSecretHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidSecretHash
+	}
+
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 || len(want) > int(limits.KeyLength) {
+		return false, ErrInvalidSecretHash
+	}
+
+	key := argon2.IDKey([]byte(secret), salt, time, memory, threads, uint32(len(want)))
+
+	return subtle.ConstantTimeCompare(want, key) == 1, nil
+}
+
+// NewArgon2idHasher returns an Argon2idHasher with the parameters recommended by RFC 9106
+// for memory constrained environments. Every verification attempt would use 64 MiB of memory
+// with these parameters
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Time:       DefaultArgon2idTime,
+		Memory:     DefaultArgon2idMemory,
+		Threads:    DefaultArgon2idThreads,
+		KeyLength:  DefaultArgon2idKeyLength,
+		SaltLength: DefaultArgon2idSaltLength,
+	}
+}
@@ -0,0 +1,333 @@
+package verifier
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type errReader struct{}
+
+func (er errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("no entropy")
+}
+
+func Test_randRune(t *testing.T) {
+	type args struct {
+		r     io.Reader
+		runes []rune
+		n     int
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "biased bytes are discarded",
+			args: args{
+				// 250 & above are discarded for a list of 10 runes
+				r:     bytes.NewReader([]byte{255, 3, 250, 17, 0, 0}),
+				runes: numericList,
+				n:     2,
+			},
+			want: "37",
+		},
+		{
+			name: "reads more when not enough unbiased bytes",
+			args: args{
+				r:     bytes.NewReader([]byte{255, 254, 253, 9, 0, 0}),
+				runes: numericList,
+				n:     1,
+			},
+			want: "9",
+		},
+		{
+			name: "random source error",
+			args: args{
+				r:     errReader{},
+				runes: numericList,
+				n:     6,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := randRune(tt.args.r, tt.args.runes, tt.args.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("randRune() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("randRune() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomSecretGenerator_Secret(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator *RandomSecretGenerator
+		ctype     CommType
+		want      *regexp.Regexp
+		wantErr   bool
+	}{
+		{
+			name:      "email",
+			generator: &RandomSecretGenerator{},
+			ctype:     CommTypeEmail,
+			want:      regexp.MustCompile("^[0-9a-zA-Z]{256}$"),
+		},
+		{
+			name:      "mobile",
+			generator: &RandomSecretGenerator{},
+			ctype:     CommTypeMobile,
+			want:      regexp.MustCompile("^[0-9]{6}$"),
+		},
+		{
+			name:      "custom length",
+			generator: &RandomSecretGenerator{MobileSecretLength: 8},
+			ctype:     CommTypeMobile,
+			want:      regexp.MustCompile("^[0-9]{8}$"),
+		},
+		{
+			name:      "custom entropy source",
+			generator: &RandomSecretGenerator{Reader: errReader{}},
+			ctype:     CommTypeEmail,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.generator.Secret(tt.ctype)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RandomSecretGenerator.Secret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !tt.want.MatchString(got) {
+				t.Fatalf("expected secret matching '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSecretHasher(t *testing.T) {
+	hmacHasher, err := NewHMACHasher([]byte("pepper"))
+	if err != nil {
+		t.Fatalf("failed initializing hmac hasher: %v", err)
+	}
+
+	otherHMACHasher, err := NewHMACHasher([]byte("another-pepper"))
+	if err != nil {
+		t.Fatalf("failed initializing hmac hasher: %v", err)
+	}
+
+	argonHasher := &Argon2idHasher{
+		Time:       1,
+		Memory:     64,
+		Threads:    1,
+		KeyLength:  32,
+		SaltLength: 16,
+	}
+
+	tests := []struct {
+		name      string
+		hasher    SecretHasher
+		comparer  SecretHasher
+		secret    string
+		candidate string
+		want      bool
+	}{
+		{
+			name:      "hmac match",
+			hasher:    hmacHasher,
+			comparer:  hmacHasher,
+			secret:    "123456",
+			candidate: "123456",
+			want:      true,
+		},
+		{
+			name:      "hmac mismatch",
+			hasher:    hmacHasher,
+			comparer:  hmacHasher,
+			secret:    "123456",
+			candidate: "123457",
+		},
+		{
+			name:      "hmac different pepper",
+			hasher:    hmacHasher,
+			comparer:  otherHMACHasher,
+			secret:    "123456",
+			candidate: "123456",
+		},
+		{
+			name:      "argon2id match",
+			hasher:    argonHasher,
+			comparer:  argonHasher,
+			secret:    "123456",
+			candidate: "123456",
+			want:      true,
+		},
+		{
+			name:      "argon2id match after parameters change",
+			hasher:    argonHasher,
+			comparer:  &Argon2idHasher{},
+			secret:    "123456",
+			candidate: "123456",
+			want:      true,
+		},
+		{
+			name:      "argon2id zero value",
+			hasher:    &Argon2idHasher{},
+			comparer:  argonHasher,
+			secret:    "123456",
+			candidate: "123456",
+			want:      true,
+		},
+		{
+			name:      "argon2id partial parameters",
+			hasher:    &Argon2idHasher{Time: 1, Memory: 64, Threads: 1},
+			comparer:  argonHasher,
+			secret:    "123456",
+			candidate: "123456",
+			want:      true,
+		},
+		{
+			name:      "argon2id parameters above the defaults",
+			hasher:    &Argon2idHasher{Time: 1, Memory: 64, Threads: DefaultArgon2idThreads * 2},
+			comparer:  &Argon2idHasher{Time: 1, Memory: 64, Threads: DefaultArgon2idThreads * 2},
+			secret:    "123456",
+			candidate: "123456",
+			want:      true,
+		},
+		{
+			name:      "argon2id mismatch",
+			hasher:    argonHasher,
+			comparer:  argonHasher,
+			secret:    "123456",
+			candidate: "654321",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashed, err := tt.hasher.Hash(tt.secret)
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+			if hashed == tt.secret {
+				t.Fatalf("expected secret to be hashed")
+			}
+
+			got, err := tt.comparer.Compare(hashed, tt.candidate)
+			if err != nil {
+				t.Fatalf("Compare() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Compare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgon2idHasher_Compare(t *testing.T) {
+	tests := []struct {
+		name   string
+		hashed string
+	}{
+		{
+			name:   "not argon2id",
+			hashed: "$argon2i$v=19$m=64,t=1,p=1$c2FsdA$a2V5",
+		},
+		{
+			name:   "invalid version",
+			hashed: "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+		},
+		{
+			name:   "invalid parameters",
+			hashed: "$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5",
+		},
+		{
+			name:   "invalid salt",
+			hashed: "$argon2id$v=19$m=64,t=1,p=1$!$a2V5",
+		},
+		{
+			name:   "empty hash",
+			hashed: "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+		},
+		{
+			name:   "memory exceeds the limit",
+			hashed: "$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdA$a2V5",
+		},
+		{
+			name:   "time exceeds the limit",
+			hashed: "$argon2id$v=19$m=64,t=4294967295,p=1$c2FsdA$a2V5",
+		},
+		{
+			name:   "threads exceed the limit",
+			hashed: "$argon2id$v=19$m=64,t=1,p=255$c2FsdA$a2V5",
+		},
+		{
+			name:   "hash exceeds the limit",
+			hashed: "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$" + strings.Repeat("a2V5", 1000),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewArgon2idHasher().Compare(tt.hashed, "secret")
+			if !errors.Is(err, ErrInvalidSecretHash) {
+				t.Fatalf("expected error '%v', got '%v'", ErrInvalidSecretHash, err)
+			}
+		})
+	}
+}
+
+func TestVerifier_hashedSecret(t *testing.T) {
+	hasher, err := NewHMACHasher([]byte("pepper"))
+	if err != nil {
+		t.Fatalf("failed initializing hmac hasher: %v", err)
+	}
+
+	verstore := &mockstore{data: map[string]*Request{}}
+	mobile := &mockmobile{}
+	ver, err := New(
+		&Config{MobileOTPExpiry: time.Minute, SecretHasher: hasher},
+		verstore,
+		nil,
+		mobile,
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	const recipient = "+919876543210"
+	verreq, err := ver.NewRequest(CommTypeMobile, recipient)
+	if err != nil {
+		t.Fatalf("Verifier.NewRequest() error = %v", err)
+	}
+
+	secret := verreq.PlainSecret()
+	if secret == "" || verreq.Secret == secret {
+		t.Fatalf("expected only the hashed secret to be stored, got '%s'", verreq.Secret)
+	}
+
+	err = ver.NewMobileWithReq(verreq, secret)
+	if err != nil {
+		t.Fatalf("Verifier.NewMobileWithReq() error = %v", err)
+	}
+	if verreq.PlainSecret() != "" {
+		t.Fatalf("expected plain text secret to be cleared after sending")
+	}
+
+	err = ver.VerifyMobileSecret(recipient, secret)
+	if err != nil {
+		t.Fatalf("Verifier.VerifyMobileSecret() error = %v", err)
+	}
+}
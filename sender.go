@@ -0,0 +1,38 @@
+package verifier
+
+import "context"
+
+type senderIDCtxKey struct{}
+
+// WithSenderID returns a copy of ctx with the sender ID (e.g. an alphanumeric sender ID or a phone
+// number), which is used instead of the configured sender by the mobile services supporting it
+func WithSenderID(ctx context.Context, senderID string) context.Context {
+	return context.WithValue(ctx, senderIDCtxKey{}, senderID)
+}
+
+// SenderIDFromContext returns the sender ID set in the context using WithSenderID
+func SenderIDFromContext(ctx context.Context) string {
+	senderID, _ := ctx.Value(senderIDCtxKey{}).(string)
+	return senderID
+}
+
+// smsTemplateRouter is implemented by mobile services which choose the template of the text
+// messages by the recipient, e.g. smsrouter.Router
+type smsTemplateRouter interface {
+	// SMSTemplate returns the name of the template, or an empty string for the default template
+	SMSTemplate(recipient string) string
+}
+
+// smsTemplate returns the name of the template of text messages sent to the recipient
+func (ver *Verifier) smsTemplate(recipient string) string {
+	router, ok := ver.mobileHandler.(smsTemplateRouter)
+	if !ok {
+		return TemplateSMS
+	}
+
+	name := router.SMSTemplate(recipient)
+	if name == "" {
+		return TemplateSMS
+	}
+	return name
+}
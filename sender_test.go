@@ -0,0 +1,79 @@
+package verifier
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type mockroutedmobile struct {
+	mockmobile
+	templates map[string]string
+	senderID  string
+}
+
+func (mm *mockroutedmobile) SMSTemplate(recipient string) string {
+	return mm.templates[CountryCallingCode(recipient)]
+}
+
+func (mm *mockroutedmobile) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	mm.senderID = SenderIDFromContext(ctx)
+	return mm.mockmobile.Send(ctx, recipient, body)
+}
+
+func TestVerifier_smsTemplate(t *testing.T) {
+	tmpls, err := ParseTemplates(fstest.MapFS{
+		"sms.txt":    {Data: []byte("{{.Secret}} is your OTP")},
+		"sms.in.txt": {Data: []byte("{{.Secret}} is your OTP for Example. Do not share it - EXMPL")},
+	})
+	if err != nil {
+		t.Fatalf("ParseTemplates() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		recipient string
+		wantText  string
+	}{
+		{
+			name:      "routed template",
+			recipient: "+919876543210",
+			wantText:  "is your OTP for Example. Do not share it - EXMPL",
+		},
+		{
+			name:      "default template",
+			recipient: "+12025550123",
+			wantText:  "is your OTP",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mobile := &mockroutedmobile{templates: map[string]string{"+91": "sms.in.txt", "+1": ""}}
+			verstore := &mockstore{data: map[string]*Request{}}
+			ver, err := New(
+				&Config{MobileOTPExpiry: time.Minute, Templates: tmpls},
+				verstore,
+				nil,
+				mobile,
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			err = ver.NewMobileContext(WithSenderID(context.Background(), "EXMPL"), tt.recipient)
+			if err != nil {
+				t.Fatalf("Verifier.NewMobileContext() error = %v", err)
+			}
+
+			verreq := verstore.data["mobile-"+tt.recipient]
+			want := verreq.Secret + " " + tt.wantText
+			if mobile.body != want {
+				t.Fatalf("expected '%s', got '%s'", want, mobile.body)
+			}
+			if mobile.senderID != "EXMPL" {
+				t.Fatalf("expected sender ID 'EXMPL', got '%s'", mobile.senderID)
+			}
+		})
+	}
+}
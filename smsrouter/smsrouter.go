@@ -0,0 +1,250 @@
+// Package smsrouter provides a mobile service which sends text messages using the provider routed
+// by the country calling code of the recipient, with per-country sender IDs & templates. e.g. to
+// send to India using a provider with registered DLT templates, and to the US using 10DLC numbers
+package smsrouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// ErrNoRoute is the error returned when there's no route for the recipient, and no default route
+var ErrNoRoute = errors.New("no route for the recipient")
+
+// MobileService is a provider used to send text messages, e.g. awssns.AWSSNS or twilio.Twilio
+type MobileService interface {
+	Send(ctx context.Context, recipient, body string) (interface{}, error)
+}
+
+// Route is the provider, sender ID & template used to send text messages
+type Route struct {
+	// Provider is the name of the provider, as in the providers the router is initialized with
+	Provider string `json:"provider"`
+	// SenderID is set in the context using verifier.WithSenderID, so that it's used instead of
+	// the configured sender of the provider
+	SenderID string `json:"senderId,omitempty"`
+	// Template is the name of the template of the messages, the default template (sms.txt) is
+	// used if not set
+	Template string `json:"template,omitempty"`
+}
+
+// Table is the routing table, it can be configured from JSON. e.g.
+//
+//	{
+//		"default": {"provider": "awssns"},
+//		"routes": {
+//			"+91": {"provider": "awssns", "senderId": "VERIFY", "template": "sms.in.txt"},
+//			"+1": {"provider": "twilio"}
+//		}
+//	}
+type Table struct {
+	// Default is the route of recipients not matching any of the routes, if set
+	Default *Route `json:"default,omitempty"`
+	// Routes are the routes by the country calling code (e.g. '+91'). The longest matching prefix is
+	// used, so that a prefix within a calling code (e.g. '+1876' within '+1') can be routed
+	Routes map[string]Route `json:"routes,omitempty"`
+}
+
+// ParseTable parses the routing table from JSON
+func ParseTable(r io.Reader) (*Table, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	table := &Table{}
+	err := dec.Decode(table)
+	if err != nil {
+		return nil, fmt.Errorf("invalid routing table: %w", err)
+	}
+
+	return table, nil
+}
+
+// LoadTable parses the routing table from the JSON file
+func LoadTable(path string) (*Table, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseTable(file)
+}
+
+// Result is the status returned when sent successfully, with the status returned by the provider
+type Result struct {
+	Provider string      `json:"provider,omitempty"`
+	Status   interface{} `json:"status,omitempty"`
+	// at is the time at which the message was sent
+	at time.Time
+}
+
+// SendAttempts returns the attempt using the provider routed, so that the provider is recorded by
+// verifier
+func (res *Result) SendAttempts() []verifier.SendAttempt {
+	return []verifier.SendAttempt{{Provider: res.Provider, Status: res.Status, CreatedAt: &res.at}}
+}
+
+// Error is the error returned by the provider routed
+type Error struct {
+	Provider string
+	Err      error
+	// at is the time at which the message was attempted
+	at time.Time
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("failed sending using %s: %v", e.Provider, e.Err)
+}
+
+// Unwrap returns the error returned by the provider
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// SendAttempts returns the attempt using the provider routed, so that the provider is recorded by
+// verifier
+func (e *Error) SendAttempts() []verifier.SendAttempt {
+	return []verifier.SendAttempt{{Provider: e.Provider, Error: e.Err.Error(), CreatedAt: &e.at}}
+}
+
+// attemptsReporter is implemented by the statuses & errors of providers which already report their
+// attempts, e.g. failover.Mobile
+type attemptsReporter interface {
+	SendAttempts() []verifier.SendAttempt
+}
+
+// Router sends text messages using the provider routed by the recipient, it's safe for concurrent
+// use
+type Router struct {
+	providers map[string]MobileService
+	routes    map[string]*Route
+	fallback  *Route
+	// maxPrefix is the length of the longest prefix in routes
+	maxPrefix int
+}
+
+// Name returns the name of the provider, used in metrics. The provider routed is recorded in the
+// CommStatus of the request
+func (router *Router) Name() string {
+	return "smsrouter"
+}
+
+// Route returns the route of the recipient, which should be in E.164 format
+func (router *Router) Route(recipient string) (*Route, error) {
+	if strings.HasPrefix(recipient, "+") {
+		for size := min(router.maxPrefix, len(recipient)); size > 1; size-- {
+			route, ok := router.routes[recipient[:size]]
+			if ok {
+				return route, nil
+			}
+		}
+	}
+
+	if router.fallback != nil {
+		return router.fallback, nil
+	}
+
+	return nil, ErrNoRoute
+}
+
+// SMSTemplate returns the name of the template of the route, it's used by verifier to render the
+// text messages to the recipient
+func (router *Router) SMSTemplate(recipient string) string {
+	route, err := router.Route(recipient)
+	if err != nil {
+		return ""
+	}
+	return route.Template
+}
+
+// Send sends the text message using the provider routed, with the sender ID of the route
+func (router *Router) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	route, err := router.Route(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	if route.SenderID != "" {
+		ctx = verifier.WithSenderID(ctx, route.SenderID)
+	}
+
+	now := time.Now()
+	status, err := router.providers[route.Provider].Send(ctx, recipient, body)
+	if err != nil {
+		var reporter attemptsReporter
+		if errors.As(err, &reporter) {
+			return nil, err
+		}
+		return nil, &Error{Provider: route.Provider, Err: err, at: now}
+	}
+
+	if _, ok := status.(attemptsReporter); ok {
+		return status, nil
+	}
+
+	return &Result{Provider: route.Provider, Status: status, at: now}, nil
+}
+
+// normalizePrefix returns the prefix with the leading '+', e.g. '91' & '+91' are normalized as
+// '+91', and an error if it's not a numeric prefix
+func normalizePrefix(prefix string) (string, error) {
+	digits := strings.TrimPrefix(strings.TrimSpace(prefix), "+")
+	if digits == "" {
+		return "", fmt.Errorf("invalid calling code '%s'", prefix)
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("invalid calling code '%s'", prefix)
+		}
+	}
+	return "+" + digits, nil
+}
+
+// New returns a router, which sends using the providers as per the routing table. The providers
+// are referred by their names (keys) in the routing table
+func New(table *Table, providers map[string]MobileService) (*Router, error) {
+	if table == nil || (table.Default == nil && len(table.Routes) == 0) {
+		return nil, errors.New("routing table has no routes")
+	}
+
+	router := &Router{
+		providers: providers,
+		routes:    make(map[string]*Route, len(table.Routes)),
+	}
+
+	if table.Default != nil {
+		if providers[table.Default.Provider] == nil {
+			return nil, fmt.Errorf("unknown provider '%s' of the default route", table.Default.Provider)
+		}
+		fallback := *table.Default
+		router.fallback = &fallback
+	}
+
+	for prefix, route := range table.Routes {
+		if providers[route.Provider] == nil {
+			return nil, fmt.Errorf("unknown provider '%s' of the route '%s'", route.Provider, prefix)
+		}
+
+		normalized, err := normalizePrefix(prefix)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := router.routes[normalized]; ok {
+			return nil, fmt.Errorf("duplicate route '%s'", prefix)
+		}
+
+		route := route
+		router.routes[normalized] = &route
+		router.maxPrefix = max(router.maxPrefix, len(normalized))
+	}
+
+	return router, nil
+}
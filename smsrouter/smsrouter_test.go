@@ -0,0 +1,194 @@
+package smsrouter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/naughtygopher/verifier"
+)
+
+type mockmobile struct {
+	err      error
+	senderID string
+	sent     int
+}
+
+func (mm *mockmobile) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	if mm.err != nil {
+		return nil, mm.err
+	}
+	mm.senderID = verifier.SenderIDFromContext(ctx)
+	mm.sent++
+	return "message-id", nil
+}
+
+const table = `{
+	"default": {"provider": "awssns"},
+	"routes": {
+		"+91": {"provider": "india", "senderId": "VERIFY", "template": "sms.in.txt"},
+		"1": {"provider": "twilio"},
+		"+1876": {"provider": "awssns", "senderId": "JAMAICA"}
+	}
+}`
+
+func TestRouter_Send(t *testing.T) {
+	tests := []struct {
+		name         string
+		table        string
+		recipient    string
+		wantProvider string
+		wantSenderID string
+		wantTemplate string
+		wantErr      error
+	}{
+		{
+			name:         "calling code",
+			table:        table,
+			recipient:    "+919876543210",
+			wantProvider: "india",
+			wantSenderID: "VERIFY",
+			wantTemplate: "sms.in.txt",
+		},
+		{
+			name:         "calling code without a plus",
+			table:        table,
+			recipient:    "+12025550123",
+			wantProvider: "twilio",
+		},
+		{
+			name:         "longest prefix",
+			table:        table,
+			recipient:    "+18765550123",
+			wantProvider: "awssns",
+			wantSenderID: "JAMAICA",
+		},
+		{
+			name:         "default route",
+			table:        table,
+			recipient:    "+447700900123",
+			wantProvider: "awssns",
+		},
+		{
+			name:      "no route",
+			table:     `{"routes": {"+91": {"provider": "india"}}}`,
+			recipient: "+447700900123",
+			wantErr:   ErrNoRoute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providers := map[string]*mockmobile{
+				"awssns": {},
+				"india":  {},
+				"twilio": {},
+			}
+			tbl, err := ParseTable(strings.NewReader(tt.table))
+			if err != nil {
+				t.Fatalf("ParseTable() error = %v", err)
+			}
+			router, err := New(tbl, map[string]MobileService{
+				"awssns": providers["awssns"],
+				"india":  providers["india"],
+				"twilio": providers["twilio"],
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if got := router.SMSTemplate(tt.recipient); got != tt.wantTemplate {
+				t.Fatalf("expected template '%s', got '%s'", tt.wantTemplate, got)
+			}
+
+			status, err := router.Send(context.Background(), tt.recipient, "123456")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			res, ok := status.(*Result)
+			if !ok || res.Provider != tt.wantProvider || res.Status != "message-id" {
+				t.Fatalf("expected sent using %s, got %+v", tt.wantProvider, status)
+			}
+			for name, provider := range providers {
+				wantSent := 0
+				if name == tt.wantProvider {
+					wantSent = 1
+				}
+				if provider.sent != wantSent {
+					t.Fatalf("expected %s to send %d, got %d", name, wantSent, provider.sent)
+				}
+			}
+			if got := providers[tt.wantProvider].senderID; got != tt.wantSenderID {
+				t.Fatalf("expected sender ID '%s', got '%s'", tt.wantSenderID, got)
+			}
+		})
+	}
+}
+
+func TestRouter_SendError(t *testing.T) {
+	errSend := errors.New("throttled")
+	router, err := New(
+		&Table{Default: &Route{Provider: "twilio"}},
+		map[string]MobileService{"twilio": &mockmobile{err: errSend}},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = router.Send(context.Background(), "+919876543210", "123456")
+	if !errors.Is(err, errSend) {
+		t.Fatalf("expected error '%v', got '%v'", errSend, err)
+	}
+
+	rerr := &Error{}
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected error of type *Error, got %v", err)
+	}
+	attempts := rerr.SendAttempts()
+	if len(attempts) != 1 || attempts[0].Provider != "twilio" || attempts[0].Error != errSend.Error() {
+		t.Fatalf("expected failed attempt using twilio, got %+v", attempts)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		table   string
+		wantErr bool
+	}{
+		{name: "valid", table: table},
+		{name: "no routes", table: `{}`, wantErr: true},
+		{name: "unknown provider", table: `{"routes": {"+91": {"provider": "msg91"}}}`, wantErr: true},
+		{name: "unknown default provider", table: `{"default": {"provider": "msg91"}}`, wantErr: true},
+		{name: "invalid calling code", table: `{"routes": {"+IN": {"provider": "india"}}}`, wantErr: true},
+		{name: "duplicate calling code", table: `{"routes": {"+91": {"provider": "india"}, "91": {"provider": "awssns"}}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tbl, err := ParseTable(strings.NewReader(tt.table))
+			if err != nil {
+				t.Fatalf("ParseTable() error = %v", err)
+			}
+
+			_, err = New(tbl, map[string]MobileService{
+				"awssns": &mockmobile{},
+				"india":  &mockmobile{},
+				"twilio": &mockmobile{},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	_, err := ParseTable(strings.NewReader(`{"routes": {"+91": {"provider": "india", "sender": "VERIFY"}}}`))
+	if err == nil {
+		t.Fatalf("expected error for unknown field")
+	}
+}
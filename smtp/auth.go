@@ -0,0 +1,40 @@
+package smtp
+
+import (
+	"fmt"
+	netsmtp "net/smtp"
+	"strings"
+)
+
+// loginAuth implements the LOGIN authentication mechanism, which is not supported by net/smtp
+type loginAuth struct {
+	username string
+	password string
+}
+
+// isLocalhost returns true if the server is on the same host, where authenticating over an
+// unencrypted connection is allowed; the same as netsmtp.PlainAuth
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+func (la *loginAuth) Start(server *netsmtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, ErrUnencryptedAuth
+	}
+	return string(AuthLogin), nil, nil
+}
+
+func (la *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(la.username), nil
+	case "password:":
+		return []byte(la.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge '%s'", fromServer)
+}
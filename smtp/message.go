@@ -0,0 +1,147 @@
+package smtp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// message is an email encoded as per RFC 5322 & MIME
+type message struct {
+	// from & to are the addresses of the envelope
+	from string
+	to   string
+	// id is the Message-ID, without the angle brackets
+	id   string
+	body []byte
+}
+
+// newMessage encodes the email, as multipart/alternative if it has both the HTML & text bodies
+func newMessage(sender, recipient, subject, htmlBody, textBody string, now time.Time) (*message, error) {
+	if sender == "" {
+		return nil, ErrNoSender
+	}
+
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender: %w", err)
+	}
+
+	to, err := mail.ParseAddress(recipient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	id, err := messageID(from.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	writeHeader(buf, "From", from.String())
+	writeHeader(buf, "To", to.String())
+	writeHeader(buf, "Subject", mime.QEncoding.Encode("utf-8", subject))
+	writeHeader(buf, "Date", now.Format(time.RFC1123Z))
+	writeHeader(buf, "Message-ID", "<"+id+">")
+	writeHeader(buf, "MIME-Version", "1.0")
+
+	switch {
+	case htmlBody != "" && textBody != "":
+		err = writeAlternative(buf, htmlBody, textBody)
+	case htmlBody != "":
+		err = writeSinglePart(buf, "text/html", htmlBody)
+	default:
+		err = writeSinglePart(buf, "text/plain", textBody)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &message{
+		from: from.Address,
+		to:   to.Address,
+		id:   id,
+		body: buf.Bytes(),
+	}, nil
+}
+
+// messageID returns a unique Message-ID, at the domain of the sender
+func messageID(sender string) (string, error) {
+	domain := sender[strings.LastIndex(sender, "@")+1:]
+	if domain == "" {
+		domain = "localhost"
+	}
+
+	rnd := make([]byte, 16)
+	_, err := rand.Read(rnd)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d.%s@%s", time.Now().UnixNano(), hex.EncodeToString(rnd), domain), nil
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+func writeSinglePart(buf *bytes.Buffer, contentType, body string) error {
+	writeHeader(buf, "Content-Type", contentType+"; charset=utf-8")
+	writeHeader(buf, "Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+	return writeQuotedPrintable(buf, body)
+}
+
+func writeAlternative(buf *bytes.Buffer, htmlBody, textBody string) error {
+	mpw := multipart.NewWriter(buf)
+	writeHeader(buf, "Content-Type", mime.FormatMediaType(
+		"multipart/alternative",
+		map[string]string{"boundary": mpw.Boundary()},
+	))
+	buf.WriteString("\r\n")
+
+	// as per RFC 2046, the preferred alternative (HTML) is the last
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{contentType: "text/plain", body: textBody},
+		{contentType: "text/html", body: htmlBody},
+	} {
+		pw, err := mpw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+
+		err = writeQuotedPrintable(pw, part.body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return mpw.Close()
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qpw := quotedprintable.NewWriter(w)
+	_, err := qpw.Write([]byte(body))
+	if err != nil {
+		return err
+	}
+	return qpw.Close()
+}
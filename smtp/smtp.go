@@ -0,0 +1,448 @@
+// Package smtp sends verification emails using an SMTP server, it's an alternative to awsses for
+// on-premise & air-gapped deployments
+package smtp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	netsmtp "net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// Security is the transport security of the connection to the SMTP server
+type Security string
+
+const (
+	// SecuritySTARTTLS upgrades a plain text connection to TLS using the STARTTLS command, it's
+	// usually on port 587
+	SecuritySTARTTLS = Security("starttls")
+	// SecurityTLS connects to the server using TLS (implicit TLS), it's usually on port 465
+	SecurityTLS = Security("tls")
+	// SecurityNone does not encrypt the connection, and should be used only with local relays.
+	// Authentication is not attempted over an unencrypted connection, except to localhost
+	SecurityNone = Security("none")
+)
+
+// AuthMechanism is the SASL mechanism used to authenticate with the SMTP server
+type AuthMechanism string
+
+const (
+	// AuthPlain is the PLAIN mechanism, RFC 4616
+	AuthPlain = AuthMechanism("PLAIN")
+	// AuthLogin is the LOGIN mechanism, which is not standardized but widely supported
+	AuthLogin = AuthMechanism("LOGIN")
+)
+
+var (
+	// ErrSTARTTLSUnsupported is the error returned if the server does not support STARTTLS, when
+	// using SecuritySTARTTLS
+	ErrSTARTTLSUnsupported = errors.New("smtp server does not support STARTTLS")
+	// ErrAuthUnsupported is the error returned if the server does not support the configured
+	// authentication mechanism, or any of PLAIN & LOGIN
+	ErrAuthUnsupported = errors.New("smtp server does not support the authentication mechanism")
+	// ErrUnencryptedAuth is the error returned when authenticating over an unencrypted connection
+	ErrUnencryptedAuth = errors.New("refusing to authenticate over an unencrypted connection")
+	// ErrNoSender is the error returned if the sender is empty
+	ErrNoSender = errors.New("sender is required")
+	// ErrClosed is the error returned when sending an email after the service is closed
+	ErrClosed = errors.New("smtp service is closed")
+)
+
+// Config holds all the configurations required to send emails using an SMTP server
+type Config struct {
+	Host string
+	// Port is 587 for SecuritySTARTTLS, 465 for SecurityTLS and 25 for SecurityNone, if not set
+	Port     string
+	Username string
+	Password string
+	// Auth is the authentication mechanism used, if Username is set. PLAIN is used if supported
+	// by the server, else LOGIN; if not set
+	Auth AuthMechanism
+	// Security is SecuritySTARTTLS if not set
+	Security Security
+	// TLSConfig is used for both STARTTLS & implicit TLS, its ServerName is set to Host if empty
+	TLSConfig *tls.Config
+	// LocalName is the host name sent in EHLO, 'localhost' is used if not set
+	LocalName string
+
+	// PoolSize is the maximum number of idle connections kept to be reused, 2 if not set.
+	// Connections are not reused if it's negative
+	PoolSize int
+	// IdleTimeout is the duration after which an idle connection is not reused, 30s if not set
+	IdleTimeout time.Duration
+	// Timeout is the timeout of connecting & sending an email, if the context does not have an
+	// earlier deadline. 30s if not set
+	Timeout time.Duration
+
+	// TracerProvider is used to trace the emails sent, the global tracer provider is used if not set
+	TracerProvider trace.TracerProvider
+}
+
+func (cfg *Config) init() {
+	if cfg.Security == "" {
+		cfg.Security = SecuritySTARTTLS
+	}
+
+	if cfg.Port == "" {
+		switch cfg.Security {
+		case SecurityTLS:
+			cfg.Port = "465"
+		case SecurityNone:
+			cfg.Port = "25"
+		default:
+			cfg.Port = "587"
+		}
+	}
+
+	if cfg.LocalName == "" {
+		cfg.LocalName = "localhost"
+	}
+
+	if cfg.PoolSize == 0 {
+		cfg.PoolSize = 2
+	}
+
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = time.Second * 30
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second * 30
+	}
+}
+
+func (cfg *Config) tlsConfig() *tls.Config {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSConfig != nil {
+		tlsCfg = cfg.TLSConfig.Clone()
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = cfg.Host
+	}
+	return tlsCfg
+}
+
+// conn is a connection to the SMTP server
+type conn struct {
+	client *netsmtp.Client
+	// raw is the underlying TCP connection, used to set deadlines
+	raw    net.Conn
+	usedAt time.Time
+}
+
+func (cn *conn) close() {
+	_ = cn.client.Close()
+}
+
+// SMTP sends emails using an SMTP server, it's safe for concurrent use
+type SMTP struct {
+	cfg    *Config
+	tracer trace.Tracer
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+// Name returns the name of the provider, used in metrics
+func (s *SMTP) Name() string {
+	return "smtp"
+}
+
+// Send sends an email with an HTML body, and returns its Message-ID
+func (s *SMTP) Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error) {
+	return s.SendMultipart(ctx, sender, recipient, subject, body, "")
+}
+
+// SendMultipart sends an email with an HTML body & its plain text alternative, and returns its
+// Message-ID. Either of the bodies can be empty
+func (s *SMTP) SendMultipart(ctx context.Context, sender, recipient, subject, htmlBody, textBody string) (_ interface{}, err error) {
+	ctx, span := s.tracer.Start(
+		ctx,
+		"smtp.SendMail",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			verifier.AttrProvider.String(s.Name()),
+			verifier.AttrRecipient.String(verifier.RedactRecipient(recipient)),
+			attribute.String("server.address", s.cfg.Host),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	msg, err := newMessage(sender, recipient, subject, htmlBody, textBody, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	cn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.send(ctx, cn, msg)
+	if err != nil {
+		// the state of the connection is unknown
+		cn.close()
+		return nil, err
+	}
+	s.release(cn)
+
+	return msg.id, nil
+}
+
+func (s *SMTP) send(ctx context.Context, cn *conn, msg *message) error {
+	deadline, _ := ctx.Deadline()
+	err := cn.raw.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	// unblocks reads & writes if the context is cancelled before the deadline
+	stop := context.AfterFunc(ctx, func() {
+		_ = cn.raw.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	err = cn.client.Mail(msg.from)
+	if err != nil {
+		return err
+	}
+
+	err = cn.client.Rcpt(msg.to)
+	if err != nil {
+		return err
+	}
+
+	wc, err := cn.client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = wc.Write(msg.body)
+	if err != nil {
+		_ = wc.Close()
+		return err
+	}
+
+	err = wc.Close()
+	if err != nil {
+		return err
+	}
+
+	return cn.raw.SetDeadline(time.Time{})
+}
+
+// conn returns an idle connection which is still usable, or a new connection
+func (s *SMTP) conn(ctx context.Context) (*conn, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if len(s.idle) == 0 {
+			s.mu.Unlock()
+			return s.dial(ctx)
+		}
+		cn := s.idle[len(s.idle)-1]
+		s.idle = s.idle[:len(s.idle)-1]
+		s.mu.Unlock()
+
+		if time.Since(cn.usedAt) > s.cfg.IdleTimeout {
+			cn.close()
+			continue
+		}
+
+		// RSET verifies that the connection is alive, and clears any state of the previous email
+		deadline, _ := ctx.Deadline()
+		_ = cn.raw.SetDeadline(deadline)
+		if cn.client.Reset() != nil {
+			cn.close()
+			continue
+		}
+
+		return cn, nil
+	}
+}
+
+// release returns the connection to the pool, or closes it if the pool is full
+func (s *SMTP) release(cn *conn) {
+	cn.usedAt = time.Now()
+
+	s.mu.Lock()
+	if !s.closed && len(s.idle) < s.cfg.PoolSize {
+		s.idle = append(s.idle, cn)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	_ = cn.client.Quit()
+}
+
+// dial connects & authenticates with the SMTP server
+func (s *SMTP) dial(ctx context.Context) (*conn, error) {
+	dialer := &net.Dialer{}
+	raw, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, s.cfg.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	_ = raw.SetDeadline(deadline)
+
+	cn, err := s.handshake(ctx, raw)
+	if err != nil {
+		_ = raw.Close()
+		return nil, err
+	}
+
+	_ = raw.SetDeadline(time.Time{})
+	return cn, nil
+}
+
+func (s *SMTP) handshake(ctx context.Context, raw net.Conn) (*conn, error) {
+	netConn := raw
+	if s.cfg.Security == SecurityTLS {
+		tlsConn := tls.Client(raw, s.cfg.tlsConfig())
+		err := tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		netConn = tlsConn
+	}
+
+	client, err := netsmtp.NewClient(netConn, s.cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{client: client, raw: raw}
+
+	err = client.Hello(s.cfg.LocalName)
+	if err != nil {
+		cn.close()
+		return nil, err
+	}
+
+	if s.cfg.Security == SecuritySTARTTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			cn.close()
+			return nil, ErrSTARTTLSUnsupported
+		}
+		err = client.StartTLS(s.cfg.tlsConfig())
+		if err != nil {
+			cn.close()
+			return nil, err
+		}
+	}
+
+	if s.cfg.Username == "" {
+		return cn, nil
+	}
+
+	auth, err := s.auth(client)
+	if err != nil {
+		cn.close()
+		return nil, err
+	}
+
+	err = client.Auth(auth)
+	if err != nil {
+		cn.close()
+		return nil, err
+	}
+
+	return cn, nil
+}
+
+// auth returns the configured authentication mechanism, or the one supported by the server
+func (s *SMTP) auth(client *netsmtp.Client) (netsmtp.Auth, error) {
+	ok, params := client.Extension("AUTH")
+	if !ok {
+		return nil, ErrAuthUnsupported
+	}
+	supported := strings.Fields(strings.ToUpper(params))
+
+	mechanism := s.cfg.Auth
+	if mechanism == "" {
+		mechanism = AuthLogin
+		if contains(supported, string(AuthPlain)) {
+			mechanism = AuthPlain
+		}
+	}
+	if !contains(supported, string(mechanism)) {
+		return nil, fmt.Errorf("%w: %s", ErrAuthUnsupported, mechanism)
+	}
+
+	if mechanism == AuthPlain {
+		return netsmtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host), nil
+	}
+	return &loginAuth{username: s.cfg.Username, password: s.cfg.Password}, nil
+}
+
+func contains(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes all the idle connections, emails cannot be sent once it's closed
+func (s *SMTP) Close() error {
+	s.mu.Lock()
+	idle := s.idle
+	s.idle = nil
+	s.closed = true
+	s.mu.Unlock()
+
+	for _, cn := range idle {
+		_ = cn.client.Quit()
+	}
+	return nil
+}
+
+// NewService returns an instance of SMTP. Connections are made only when sending emails
+func NewService(cfg *Config) (*SMTP, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+	cfg.init()
+
+	switch cfg.Security {
+	case SecuritySTARTTLS, SecurityTLS, SecurityNone:
+	default:
+		return nil, fmt.Errorf("invalid smtp security '%s'", cfg.Security)
+	}
+
+	switch cfg.Auth {
+	case "", AuthPlain, AuthLogin:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrAuthUnsupported, cfg.Auth)
+	}
+
+	return &SMTP{
+		cfg:    cfg,
+		tracer: verifier.Tracer(cfg.TracerProvider, verifier.TracerName+"/smtp"),
+	}, nil
+}
@@ -0,0 +1,475 @@
+package smtp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	netsmtp "net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer is an in-process SMTP server, which supports STARTTLS, implicit TLS and the PLAIN &
+// LOGIN authentication mechanisms
+type testServer struct {
+	listener net.Listener
+	tlsCfg   *tls.Config
+	// starttls advertises STARTTLS on plain text connections
+	starttls bool
+	// auth are the advertised authentication mechanisms
+	auth     []string
+	username string
+	password string
+
+	mu       sync.Mutex
+	conns    int
+	messages []string
+	authed   []string
+}
+
+func newTestServer(t *testing.T, implicitTLS bool) (*testServer, *tls.Config) {
+	t.Helper()
+	serverCfg, clientCfg := testTLSConfigs(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed listening: %v", err)
+	}
+	if implicitTLS {
+		listener = tls.NewListener(listener, serverCfg)
+	}
+
+	srv := &testServer{
+		listener: listener,
+		tlsCfg:   serverCfg,
+		starttls: !implicitTLS,
+		auth:     []string{"PLAIN", "LOGIN"},
+		username: "user",
+		password: "password",
+	}
+	go srv.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+
+	return srv, clientCfg
+}
+
+func (srv *testServer) port() string {
+	_, port, _ := net.SplitHostPort(srv.listener.Addr().String())
+	return port
+}
+
+func (srv *testServer) serve() {
+	for {
+		cn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+		srv.mu.Lock()
+		srv.conns++
+		srv.mu.Unlock()
+		go srv.handle(cn)
+	}
+}
+
+func (srv *testServer) handle(cn net.Conn) {
+	defer cn.Close()
+	_, secure := cn.(*tls.Conn)
+	tc := textproto.NewConn(cn)
+	_ = tc.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			lines := []string{"localhost"}
+			if srv.starttls && !secure {
+				lines = append(lines, "STARTTLS")
+			}
+			if len(srv.auth) > 0 {
+				lines = append(lines, "AUTH "+strings.Join(srv.auth, " "))
+			}
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				_ = tc.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			_ = tc.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(cn, srv.tlsCfg)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			cn, secure = tlsConn, true
+			tc = textproto.NewConn(cn)
+		case "AUTH":
+			srv.authenticate(tc, arg)
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			_ = tc.PrintfLine("250 OK")
+		case "DATA":
+			_ = tc.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			body, err := io.ReadAll(tc.DotReader())
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.messages = append(srv.messages, string(body))
+			srv.mu.Unlock()
+			_ = tc.PrintfLine("250 OK queued")
+		case "QUIT":
+			_ = tc.PrintfLine("221 bye")
+			return
+		default:
+			_ = tc.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+func (srv *testServer) authenticate(tc *textproto.Conn, arg string) {
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	username, password := "", ""
+	switch mechanism {
+	case "PLAIN":
+		decoded, _ := base64.StdEncoding.DecodeString(initial)
+		parts := strings.Split(string(decoded), "\x00")
+		if len(parts) == 3 {
+			username, password = parts[1], parts[2]
+		}
+	case "LOGIN":
+		for _, challenge := range []string{"Username:", "Password:"} {
+			_ = tc.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+			line, _ := tc.ReadLine()
+			decoded, _ := base64.StdEncoding.DecodeString(line)
+			if challenge == "Username:" {
+				username = string(decoded)
+			} else {
+				password = string(decoded)
+			}
+		}
+	}
+
+	if username != srv.username || password != srv.password {
+		_ = tc.PrintfLine("535 authentication failed")
+		return
+	}
+	srv.mu.Lock()
+	srv.authed = append(srv.authed, mechanism)
+	srv.mu.Unlock()
+	_ = tc.PrintfLine("235 authenticated")
+}
+
+func (srv *testServer) stats() (conns int, messages []string, authed []string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.conns, append([]string{}, srv.messages...), append([]string{}, srv.authed...)
+}
+
+// testTLSConfigs returns the TLS configs of the server, with a self signed certificate for
+// 127.0.0.1, and of the client trusting it
+func testTLSConfigs(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed generating key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed parsing certificate: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	serverCfg := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return serverCfg, &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+}
+
+func TestSMTP_SendMultipart(t *testing.T) {
+	tests := []struct {
+		name        string
+		implicitTLS bool
+		security    Security
+		auth        AuthMechanism
+		serverAuth  []string
+		wantAuth    string
+		wantErr     error
+	}{
+		{
+			name:     "starttls with plain auth",
+			security: SecuritySTARTTLS,
+			wantAuth: "PLAIN",
+		},
+		{
+			name:        "implicit tls with login auth",
+			implicitTLS: true,
+			security:    SecurityTLS,
+			auth:        AuthLogin,
+			wantAuth:    "LOGIN",
+		},
+		{
+			name:       "login auth if plain is not supported",
+			security:   SecuritySTARTTLS,
+			serverAuth: []string{"LOGIN"},
+			wantAuth:   "LOGIN",
+		},
+		{
+			name:       "unsupported auth",
+			security:   SecuritySTARTTLS,
+			auth:       AuthPlain,
+			serverAuth: []string{"LOGIN"},
+			wantErr:    ErrAuthUnsupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, clientTLS := newTestServer(t, tt.implicitTLS)
+			if tt.serverAuth != nil {
+				srv.auth = tt.serverAuth
+			}
+
+			svc, err := NewService(&Config{
+				Host:      "127.0.0.1",
+				Port:      srv.port(),
+				Username:  "user",
+				Password:  "password",
+				Auth:      tt.auth,
+				Security:  tt.security,
+				TLSConfig: clientTLS,
+			})
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+			defer svc.Close()
+
+			id, err := svc.SendMultipart(
+				context.Background(),
+				"Verifier <noreply@example.com>",
+				"john.doe@example.com",
+				"Vérifiez votre email",
+				`<a href="https://example.com/verify?a=1&b=2">verify</a>`,
+				"Open https://example.com/verify?a=1&b=2 to verify, it's valid for 12 hours",
+			)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SMTP.SendMultipart() error = %v", err)
+			}
+
+			_, messages, authed := srv.stats()
+			if len(authed) != 1 || authed[0] != tt.wantAuth {
+				t.Fatalf("expected authentication using %s, got %v", tt.wantAuth, authed)
+			}
+			if len(messages) != 1 {
+				t.Fatalf("expected 1 message, got %d", len(messages))
+			}
+			assertMessage(t, messages[0], id.(string))
+		})
+	}
+}
+
+// assertMessage asserts the headers & the multipart/alternative bodies of the message
+func assertMessage(t *testing.T, raw, id string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed reading message: %v", err)
+	}
+
+	if got := msg.Header.Get("Message-ID"); got != "<"+id+">" || !strings.HasSuffix(id, "@example.com") {
+		t.Fatalf("expected Message-ID '<%s>' at example.com, got '%s'", id, got)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Fatalf("invalid Date header: %v", err)
+	}
+	subject, err := (&mime.WordDecoder{}).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Vérifiez votre email" {
+		t.Fatalf("expected subject 'Vérifiez votre email', got '%s' (%v)", subject, err)
+	}
+	if got := msg.Header.Get("From"); got != `"Verifier" <noreply@example.com>` {
+		t.Fatalf("unexpected From header '%s'", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got '%s' (%v)", mediaType, err)
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	wantParts := []struct {
+		contentType string
+		body        string
+	}{
+		{contentType: "text/plain", body: "Open https://example.com/verify?a=1&b=2 to verify, it's valid for 12 hours"},
+		{contentType: "text/html", body: `<a href="https://example.com/verify?a=1&b=2">verify</a>`},
+	}
+	for _, want := range wantParts {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("failed reading part: %v", err)
+		}
+		if !strings.HasPrefix(part.Header.Get("Content-Type"), want.contentType) {
+			t.Fatalf("expected content type '%s', got '%s'", want.contentType, part.Header.Get("Content-Type"))
+		}
+		// the quoted-printable encoding is decoded by the multipart reader
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("failed reading part: %v", err)
+		}
+		if string(body) != want.body {
+			t.Fatalf("expected body '%s', got '%s'", want.body, body)
+		}
+	}
+	if _, err := reader.NextPart(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected only 2 parts, got error %v", err)
+	}
+}
+
+func TestSMTP_pool(t *testing.T) {
+	srv, clientTLS := newTestServer(t, false)
+	svc, err := NewService(&Config{
+		Host:      "127.0.0.1",
+		Port:      srv.port(),
+		Username:  "user",
+		Password:  "password",
+		TLSConfig: clientTLS,
+		PoolSize:  1,
+	})
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = svc.Send(context.Background(), "noreply@example.com", "john.doe@example.com", "subject", "<p>body</p>")
+		if err != nil {
+			t.Fatalf("SMTP.Send() error = %v", err)
+		}
+	}
+
+	conns, messages, _ := srv.stats()
+	if conns != 1 || len(messages) != 3 {
+		t.Fatalf("expected 3 messages over 1 connection, got %d messages over %d connections", len(messages), conns)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0]))
+	if err != nil {
+		t.Fatalf("failed reading message: %v", err)
+	}
+	if got := msg.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Fatalf("expected content type 'text/html; charset=utf-8', got '%s'", got)
+	}
+
+	err = svc.Close()
+	if err != nil {
+		t.Fatalf("SMTP.Close() error = %v", err)
+	}
+	_, err = svc.Send(context.Background(), "noreply@example.com", "john.doe@example.com", "subject", "body")
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected error '%v', got '%v'", ErrClosed, err)
+	}
+}
+
+func TestSMTP_errors(t *testing.T) {
+	srv, clientTLS := newTestServer(t, false)
+	srv.starttls = false
+
+	tests := []struct {
+		name      string
+		cfg       *Config
+		sender    string
+		recipient string
+		wantErr   error
+	}{
+		{
+			name:      "starttls not supported",
+			cfg:       &Config{Security: SecuritySTARTTLS},
+			sender:    "noreply@example.com",
+			recipient: "john.doe@example.com",
+			wantErr:   ErrSTARTTLSUnsupported,
+		},
+		{
+			name:      "no sender",
+			cfg:       &Config{Security: SecurityNone},
+			recipient: "john.doe@example.com",
+			wantErr:   ErrNoSender,
+		},
+		{
+			name:      "wrong password",
+			cfg:       &Config{Security: SecurityNone, Username: "user", Password: "wrong"},
+			sender:    "noreply@example.com",
+			recipient: "john.doe@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Host = "127.0.0.1"
+			tt.cfg.Port = srv.port()
+			tt.cfg.TLSConfig = clientTLS
+			svc, err := NewService(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+
+			_, err = svc.Send(context.Background(), tt.sender, tt.recipient, "subject", "body")
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoginAuth_unencrypted(t *testing.T) {
+	_, err := NewService(&Config{})
+	if err == nil {
+		t.Fatalf("expected error without host")
+	}
+
+	la := &loginAuth{username: "user", password: "password"}
+	_, _, err = la.Start(&netsmtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"LOGIN"}})
+	if !errors.Is(err, ErrUnencryptedAuth) {
+		t.Fatalf("expected error '%v', got '%v'", ErrUnencryptedAuth, err)
+	}
+}
@@ -0,0 +1,331 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// MemoryConfig holds all the configuration required for the in-memory store
+type MemoryConfig struct {
+	// Retention is the duration for which requests are retained after their secret expires, so
+	// that verification of an expired secret is reported as expired. DefaultRetention is used if
+	// not set
+	Retention time.Duration `json:"retention,omitempty"`
+	// JanitorInterval is the interval at which evicted requests are removed from memory. If not set,
+	// the janitor is not started and requests are evicted only when the recipient's requests are read
+	JanitorInterval time.Duration `json:"janitorInterval,omitempty"`
+}
+
+// Memory implements the verifier store functions, keeping all the requests in memory. It is safe
+// for concurrent use, and is meant for tests, local development & single node deployments
+type Memory struct {
+	retention time.Duration
+
+	mu sync.RWMutex
+	// requests has all the requests by their ID
+	requests map[string]*verifier.Request
+	// history has IDs of all the requests of a type + recipient, in the order of creation
+	history map[string][]string
+
+	stopJanitor chan struct{}
+	closeOnce   sync.Once
+}
+
+func memoryKey(ctype verifier.CommType, recipient string) string {
+	return fmt.Sprintf("%s-%s", ctype, recipient)
+}
+
+// cloneRequest returns a deep copy of the request, so that the stored request is not modified
+// by the caller & vice versa
+func cloneRequest(req *verifier.Request) *verifier.Request {
+	clone := *req
+	if req.Data != nil {
+		clone.Data = make(map[string]string, len(req.Data))
+		for key, value := range req.Data {
+			clone.Data[key] = value
+		}
+	}
+
+	if req.CommStatus != nil {
+		clone.CommStatus = make([]verifier.CommStatus, len(req.CommStatus))
+		for i, status := range req.CommStatus {
+			clone.CommStatus[i] = status
+			if status.Attempts != nil {
+				clone.CommStatus[i].Attempts = append([]verifier.SendAttempt(nil), status.Attempts...)
+			}
+			if status.Data == nil {
+				continue
+			}
+			clone.CommStatus[i].Data = make(map[string]interface{}, len(status.Data))
+			for key, value := range status.Data {
+				clone.CommStatus[i].Data[key] = value
+			}
+		}
+	}
+
+	for _, t := range []**time.Time{&clone.SecretExpiry, &clone.LastSentAt, &clone.CreatedAt, &clone.UpdatedAt} {
+		if *t != nil {
+			tt := **t
+			*t = &tt
+		}
+	}
+
+	return &clone
+}
+
+// evicted reports whether the request has passed its retention period
+func (mem *Memory) evicted(req *verifier.Request, now time.Time) bool {
+	if req.SecretExpiry == nil {
+		return false
+	}
+	return now.After(req.SecretExpiry.Add(mem.retention))
+}
+
+// Create creates a new entry of the verification request in the store
+func (mem *Memory) Create(ctx context.Context, req *verifier.Request) (*verifier.Request, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	if _, exists := mem.requests[req.ID]; exists {
+		return nil, ErrDuplicateRequest
+	}
+	mem.requests[req.ID] = cloneRequest(req)
+
+	key := memoryKey(req.Type, req.Recipient)
+	ids := append(mem.history[key], req.ID)
+	// requests are kept sorted by creation time, since they need not be created in order
+	sort.SliceStable(ids, func(i, j int) bool {
+		return createdAt(mem.requests[ids[i]]).Before(createdAt(mem.requests[ids[j]]))
+	})
+	mem.history[key] = ids
+
+	return req, nil
+}
+
+func createdAt(req *verifier.Request) time.Time {
+	if req == nil || req.CreatedAt == nil {
+		return time.Time{}
+	}
+	return *req.CreatedAt
+}
+
+// ReadLastPending reads the last pending verification request of the commtype + recipient
+func (mem *Memory) ReadLastPending(ctx context.Context, ctype verifier.CommType, recipient string) (*verifier.Request, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	now := time.Now()
+	key := memoryKey(ctype, recipient)
+	mem.evictRecipient(key, now)
+
+	ids := mem.history[key]
+	for i := len(ids) - 1; i >= 0; i-- {
+		req := mem.requests[ids[i]]
+		if req.Status == verifier.VerStatusPending {
+			return cloneRequest(req), nil
+		}
+	}
+
+	return nil, verifier.ErrNotFound
+}
+
+// ReadByID reads the verification request of the given ID
+func (mem *Memory) ReadByID(ctx context.Context, verID string) (*verifier.Request, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	req, ok := mem.requests[verID]
+	if !ok || mem.evicted(req, time.Now()) {
+		return nil, verifier.ErrNotFound
+	}
+
+	return cloneRequest(req), nil
+}
+
+// Update updates a pending verification request for the given verification ID & the payload
+func (mem *Memory) Update(ctx context.Context, verID string, req *verifier.Request) (*verifier.Request, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	stored, ok := mem.requests[verID]
+	if !ok {
+		return nil, verifier.ErrNotFound
+	}
+	if stored.Status != verifier.VerStatusPending {
+		return nil, verifier.ErrRequestNotPending
+	}
+
+	updated := cloneRequest(req)
+	// the request is identified by its ID, type & recipient; which cannot be updated
+	updated.ID = stored.ID
+	updated.Type = stored.Type
+	updated.Recipient = stored.Recipient
+	if stored.Attempts > updated.Attempts {
+		updated.Attempts = stored.Attempts
+	}
+	if stored.Resends > updated.Resends {
+		updated.Resends = stored.Resends
+	}
+	if stored.LastSentAt != nil && (updated.LastSentAt == nil || stored.LastSentAt.After(*updated.LastSentAt)) {
+		updated.LastSentAt = stored.LastSentAt
+	}
+	mem.requests[verID] = updated
+
+	return cloneRequest(updated), nil
+}
+
+// IncrementAttempts atomically increments the verification attempts of a pending request, and
+// returns the updated request
+func (mem *Memory) IncrementAttempts(ctx context.Context, verID string) (*verifier.Request, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	stored, ok := mem.requests[verID]
+	if !ok {
+		return nil, verifier.ErrNotFound
+	}
+	if stored.Status != verifier.VerStatusPending {
+		return nil, verifier.ErrRequestNotPending
+	}
+
+	now := time.Now()
+	stored.Attempts++
+	stored.UpdatedAt = &now
+
+	return cloneRequest(stored), nil
+}
+
+// IncrementResends atomically increments the resends of the request if it can be resent, and
+// returns the updated request
+func (mem *Memory) IncrementResends(ctx context.Context, verID string, now time.Time, interval time.Duration, maxResends int) (*verifier.Request, error) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	stored, ok := mem.requests[verID]
+	if !ok {
+		return nil, verifier.ErrNotFound
+	}
+
+	err := stored.CheckResend(now, interval, maxResends)
+	if err != nil {
+		return nil, err
+	}
+
+	stored.Resends++
+	stored.LastSentAt = &now
+	stored.UpdatedAt = &now
+
+	return cloneRequest(stored), nil
+}
+
+// List returns the requests matching the filter, latest first
+func (mem *Memory) List(ctx context.Context, filter *verifier.ListFilter) ([]*verifier.Request, error) {
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	now := time.Now()
+	matched := make([]*verifier.Request, 0, filter.Limit)
+	for _, req := range mem.requests {
+		if mem.evicted(req, now) || !filter.Match(req) {
+			continue
+		}
+		matched = append(matched, req)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		ci, cj := createdAt(matched[i]), createdAt(matched[j])
+		if ci.Equal(cj) {
+			return matched[i].ID > matched[j].ID
+		}
+		return ci.After(cj)
+	})
+
+	page := paginate(matched, filter)
+	for i, req := range page {
+		page[i] = cloneRequest(req)
+	}
+
+	return page, nil
+}
+
+// evictRecipient removes all the requests of the type + recipient which are past their retention
+func (mem *Memory) evictRecipient(key string, now time.Time) {
+	ids := mem.history[key]
+	retained := ids[:0]
+	for _, id := range ids {
+		if mem.evicted(mem.requests[id], now) {
+			delete(mem.requests, id)
+			continue
+		}
+		retained = append(retained, id)
+	}
+
+	if len(retained) == 0 {
+		delete(mem.history, key)
+		return
+	}
+	mem.history[key] = retained
+}
+
+// evict removes all the requests which are past their retention
+func (mem *Memory) evict(now time.Time) {
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	for key := range mem.history {
+		mem.evictRecipient(key, now)
+	}
+}
+
+func (mem *Memory) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mem.stopJanitor:
+			return
+		case now := <-ticker.C:
+			mem.evict(now)
+		}
+	}
+}
+
+// Close stops the janitor, if it was started
+func (mem *Memory) Close() error {
+	mem.closeOnce.Do(func() {
+		close(mem.stopJanitor)
+	})
+	return nil
+}
+
+// NewMemory returns a new in-memory store. If JanitorInterval is configured, Close should be
+// called to stop the janitor once the store is not required
+func NewMemory(cfg *MemoryConfig) *Memory {
+	if cfg == nil {
+		cfg = &MemoryConfig{}
+	}
+
+	retention := cfg.Retention
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	mem := &Memory{
+		retention:   retention,
+		requests:    map[string]*verifier.Request{},
+		history:     map[string][]string{},
+		stopJanitor: make(chan struct{}),
+	}
+
+	if cfg.JanitorInterval > 0 {
+		go mem.janitor(cfg.JanitorInterval)
+	}
+
+	return mem
+}
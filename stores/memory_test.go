@@ -0,0 +1,191 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+func TestMemory_ReadLastPending(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	const recipient = "john.doe@example.com"
+
+	mem := NewMemory(nil)
+	requests := []*verifier.Request{
+		newTestRequest(verifier.CommTypeEmail, recipient, now.Add(-time.Minute)),
+		// created later, but with an earlier creation time
+		newTestRequest(verifier.CommTypeEmail, recipient, now.Add(-time.Minute*2)),
+		newTestRequest(verifier.CommTypeEmail, "jane.doe@example.com", now),
+	}
+	for _, req := range requests {
+		_, err := mem.Create(ctx, req)
+		if err != nil {
+			t.Fatalf("Memory.Create() error = %v", err)
+		}
+	}
+
+	_, err := mem.Create(ctx, requests[0])
+	if !errors.Is(err, ErrDuplicateRequest) {
+		t.Fatalf("expected error '%v', got '%v'", ErrDuplicateRequest, err)
+	}
+
+	got, err := mem.ReadLastPending(ctx, verifier.CommTypeEmail, recipient)
+	if err != nil {
+		t.Fatalf("Memory.ReadLastPending() error = %v", err)
+	}
+	if got.ID != requests[0].ID {
+		t.Fatalf("expected request '%s', got '%s'", requests[0].ID, got.ID)
+	}
+
+	// modifying the returned request should not modify the stored request
+	got.Status = verifier.VerStatusVerified
+	got.CommStatus = append(got.CommStatus, verifier.CommStatus{Status: "queued"})
+	again, err := mem.ReadLastPending(ctx, verifier.CommTypeEmail, recipient)
+	if err != nil {
+		t.Fatalf("Memory.ReadLastPending() error = %v", err)
+	}
+	if again.Status != verifier.VerStatusPending || len(again.CommStatus) != 0 {
+		t.Fatalf("expected stored request to be unmodified, got %+v", again)
+	}
+
+	_, err = mem.Update(ctx, got.ID, got)
+	if err != nil {
+		t.Fatalf("Memory.Update() error = %v", err)
+	}
+
+	got, err = mem.ReadLastPending(ctx, verifier.CommTypeEmail, recipient)
+	if err != nil {
+		t.Fatalf("Memory.ReadLastPending() error = %v", err)
+	}
+	if got.ID != requests[1].ID {
+		t.Fatalf("expected previous pending request '%s', got '%s'", requests[1].ID, got.ID)
+	}
+
+	_, err = mem.Update(ctx, "unknown", got)
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+}
+
+func TestMemory_Update(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	mem := NewMemory(nil)
+
+	req := newTestRequest(verifier.CommTypeMobile, "+919876543210", now.Add(-time.Minute))
+	_, err := mem.Create(ctx, req)
+	if err != nil {
+		t.Fatalf("Memory.Create() error = %v", err)
+	}
+
+	stale := *req
+	_, err = mem.IncrementAttempts(ctx, req.ID)
+	if err != nil {
+		t.Fatalf("Memory.IncrementAttempts() error = %v", err)
+	}
+	_, err = mem.IncrementResends(ctx, req.ID, now, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("Memory.IncrementResends() error = %v", err)
+	}
+
+	// the request returned should be the one stored, with the increments made after it was read
+	got, err := mem.Update(ctx, stale.ID, &stale)
+	if err != nil {
+		t.Fatalf("Memory.Update() error = %v", err)
+	}
+	if got == &stale {
+		t.Fatalf("expected a copy of the stored request, got the request updated")
+	}
+	if got.Attempts != 1 || got.Resends != 1 || got.LastSentAt == nil || !got.LastSentAt.Equal(now) {
+		t.Fatalf("expected 1 attempt & resend sent at '%v', got %+v", now, got)
+	}
+
+	// modifying the returned request should not modify the stored request
+	got.Status = verifier.VerStatusVerified
+	again, err := mem.ReadByID(ctx, req.ID)
+	if err != nil {
+		t.Fatalf("Memory.ReadByID() error = %v", err)
+	}
+	if again.Status != verifier.VerStatusPending {
+		t.Fatalf("expected stored request to be unmodified, got %+v", again)
+	}
+}
+
+func TestMemory_janitor(t *testing.T) {
+	ctx := context.Background()
+	const recipient = "+919876543210"
+
+	mem := NewMemory(&MemoryConfig{
+		Retention:       time.Millisecond,
+		JanitorInterval: time.Millisecond * 5,
+	})
+	defer mem.Close()
+
+	req := newTestRequest(verifier.CommTypeMobile, recipient, time.Now())
+	expiry := time.Now().Add(time.Millisecond * 5)
+	req.SecretExpiry = &expiry
+	_, err := mem.Create(ctx, req)
+	if err != nil {
+		t.Fatalf("Memory.Create() error = %v", err)
+	}
+
+	_, err = mem.ReadLastPending(ctx, verifier.CommTypeMobile, recipient)
+	if err != nil {
+		t.Fatalf("Memory.ReadLastPending() error = %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mem.mu.RLock()
+		count := len(mem.requests)
+		mem.mu.RUnlock()
+		if count == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	t.Fatalf("expected janitor to evict the expired request")
+}
+
+func TestMemory_concurrency(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemory(nil)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recipient := fmt.Sprintf("user-%d@example.com", i%5)
+			req := newTestRequest(verifier.CommTypeEmail, recipient, time.Now())
+			req.ID = fmt.Sprintf("%d", i)
+			_, err := mem.Create(ctx, req)
+			if err != nil {
+				t.Errorf("Memory.Create() error = %v", err)
+				return
+			}
+
+			last, err := mem.ReadLastPending(ctx, verifier.CommTypeEmail, recipient)
+			if err != nil {
+				t.Errorf("Memory.ReadLastPending() error = %v", err)
+				return
+			}
+			last.Attempts++
+			_, err = mem.Update(ctx, last.ID, last)
+			if err != nil {
+				t.Errorf("Memory.Update() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(mem.requests) != 50 {
+		t.Fatalf("expected 50 requests, got %d", len(mem.requests))
+	}
+}
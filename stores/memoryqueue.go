@@ -0,0 +1,102 @@
+package stores
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// memoryJob is a queued job, with the time till which it's claimed
+type memoryJob struct {
+	job          verifier.SendJob
+	claimedUntil time.Time
+}
+
+// MemoryQueue implements verifier.SendQueue, keeping the jobs in memory. Jobs are lost on restart,
+// so it's meant for tests, local development & single node deployments using the Memory store
+type MemoryQueue struct {
+	mu   sync.Mutex
+	jobs map[string]*memoryJob
+}
+
+// Enqueue persists a new job
+func (mq *MemoryQueue) Enqueue(ctx context.Context, job *verifier.SendJob) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	mq.jobs[job.ID] = &memoryJob{job: *job}
+	return nil
+}
+
+// Claim returns at most limit jobs due to be attempted at now, oldest first. Claimed jobs are not
+// returned again till the lease expires
+func (mq *MemoryQueue) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*verifier.SendJob, error) {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	due := make([]*memoryJob, 0, len(mq.jobs))
+	for _, mjob := range mq.jobs {
+		if mjob.job.NextAttemptAt.After(now) || mjob.claimedUntil.After(now) {
+			continue
+		}
+		due = append(due, mjob)
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].job.CreatedAt.Equal(due[j].job.CreatedAt) {
+			return due[i].job.ID < due[j].job.ID
+		}
+		return due[i].job.CreatedAt.Before(due[j].job.CreatedAt)
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	jobs := make([]*verifier.SendJob, 0, len(due))
+	for _, mjob := range due {
+		mjob.claimedUntil = now.Add(lease)
+		job := mjob.job
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// Retry updates a claimed job, and releases it to be claimed again at NextAttemptAt
+func (mq *MemoryQueue) Retry(ctx context.Context, job *verifier.SendJob) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	if _, ok := mq.jobs[job.ID]; !ok {
+		return verifier.ErrJobNotFound
+	}
+	mq.jobs[job.ID] = &memoryJob{job: *job}
+	return nil
+}
+
+// Delete removes a job
+func (mq *MemoryQueue) Delete(ctx context.Context, id string) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+
+	if _, ok := mq.jobs[id]; !ok {
+		return verifier.ErrJobNotFound
+	}
+	delete(mq.jobs, id)
+	return nil
+}
+
+// Len returns the number of jobs in the queue, including the claimed jobs
+func (mq *MemoryQueue) Len() int {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	return len(mq.jobs)
+}
+
+// NewMemoryQueue returns a new in-memory send queue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		jobs: map[string]*memoryJob{},
+	}
+}
@@ -3,13 +3,18 @@ package stores
 import (
 	"context"
 	"database/sql"
+	_ "embed"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/fatih/structs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/naughtygopher/verifier"
 )
@@ -22,6 +27,11 @@ func structToMapStringWithTag(tag string, source interface{}) (map[string]interf
 	return converter.Map(), nil
 }
 
+// PostgresSchema has the SQL statements to create the table & indexes required by the Postgres store
+//
+//go:embed verifier.sql
+var PostgresSchema string
+
 // PostgresConfig holds all configuration required for postgres
 type PostgresConfig struct {
 	Host      string `json:"host,omitempty"`
@@ -38,6 +48,10 @@ type PostgresConfig struct {
 	IdleTimeout  time.Duration `json:"idleTimeoutSecs,omitempty"`
 
 	TableName string `json:"tableName,omitempty"`
+	// QueueTableName is the table of the send queue, DefaultQueueTableName is used if not set
+	QueueTableName string `json:"queueTableName,omitempty"`
+	// TracerProvider is used to trace the queries, the global tracer provider is used if not set
+	TracerProvider trace.TracerProvider `json:"-"`
 }
 
 // ConnURL returns the connection URL
@@ -64,12 +78,18 @@ type Postgres struct {
 	tableName string
 	pqdriver  *pgxpool.Pool
 	qbuilder  squirrel.StatementBuilderType
+	tracer    trace.Tracer
 }
 
+// ctxWithTimeout returns a child context of ctx with the timeout applied. If timeout is not
+// set, the returned context is only cancellable
 func ctxWithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
 	return context.WithTimeout(
 		ctx,
 		timeout,
@@ -77,7 +97,10 @@ func ctxWithTimeout(ctx context.Context, timeout time.Duration) (context.Context
 }
 
 // Create creates a new entry of verifier request
-func (pgs *Postgres) Create(req *verifier.Request) (*verifier.Request, error) {
+func (pgs *Postgres) Create(ctx context.Context, req *verifier.Request) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, pgs.tracer, "postgresql", "Create")
+	defer func() { endSpan(span, err) }()
+
 	reqmap, err := structToMapStringWithTag("json", req)
 	if err != nil {
 		return nil, err
@@ -88,8 +111,12 @@ func (pgs *Postgres) Create(req *verifier.Request) (*verifier.Request, error) {
 		return nil, err
 	}
 
-	ctx, _ := ctxWithTimeout(context.Background(), pgs.cfg.WriteTimeout)
+	ctx, cancel := ctxWithTimeout(ctx, pgs.cfg.WriteTimeout)
+	defer cancel()
 	_, err = pgs.pqdriver.Exec(ctx, query, args...)
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateRequest
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -97,42 +124,32 @@ func (pgs *Postgres) Create(req *verifier.Request) (*verifier.Request, error) {
 	return req, nil
 }
 
-// ReadLastPending reads the last pending verification request of the commtype + recipient
-func (pgs *Postgres) ReadLastPending(ctype verifier.CommType, recipient string) (*verifier.Request, error) {
-	query, args, err := pgs.qbuilder.Select(
-		"id",
-		"type",
-		"sender",
-		"recipient",
-		"data",
-		"secret",
-		"secretExpiry",
-		"attempts",
-		"commStatus",
-		"status",
-		"createdAt",
-		"updatedAt",
-	).From(
-		pgs.tableName,
-	).OrderBy(
-		"autoID DESC",
-	).Limit(
-		1,
-	).Where(squirrel.Eq{
-		"type":   ctype,
-		"status": verifier.VerStatusPending,
-	}).ToSql()
-	if err != nil {
-		return nil, err
-	}
+func isUniqueViolation(err error) bool {
+	pgErr := &pgconn.PgError{}
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
 
-	ctx, _ := ctxWithTimeout(context.Background(), pgs.cfg.ReadTimeout)
-	row := pgs.pqdriver.QueryRow(
-		ctx,
-		query,
-		args...,
-	)
+// requestColumns are the columns read for a verification request, in the order expected by scanRequest
+var requestColumns = []string{
+	"id",
+	"type",
+	"sender",
+	"recipient",
+	"data",
+	"locale",
+	"secret",
+	"secretExpiry",
+	"attempts",
+	"resends",
+	"lastSentAt",
+	"commStatus",
+	"status",
+	"createdAt",
+	"updatedAt",
+}
 
+// scanRequest scans a row with all the requestColumns, to a verification request
+func scanRequest(row pgx.Row) (*verifier.Request, error) {
 	req := &verifier.Request{
 		SecretExpiry: new(time.Time),
 		CreatedAt:    new(time.Time),
@@ -145,23 +162,32 @@ func (pgs *Postgres) ReadLastPending(ctype verifier.CommType, recipient string)
 	commtype := new(sql.NullString)
 	sender := new(sql.NullString)
 	storedRecipient := new(sql.NullString)
+	locale := new(sql.NullString)
 	secret := new(sql.NullString)
 	attempts := new(sql.NullInt32)
+	resends := new(sql.NullInt32)
+	lastSentAt := new(sql.NullTime)
 
-	err = row.Scan(
+	err := row.Scan(
 		id,
 		commtype,
 		sender,
 		storedRecipient,
 		&req.Data,
+		locale,
 		secret,
 		req.SecretExpiry,
 		attempts,
+		resends,
+		lastSentAt,
 		&req.CommStatus,
 		&req.Status,
 		req.CreatedAt,
 		req.UpdatedAt,
 	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, verifier.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -170,50 +196,314 @@ func (pgs *Postgres) ReadLastPending(ctype verifier.CommType, recipient string)
 	req.Type = verifier.CommType(commtype.String)
 	req.Sender = sender.String
 	req.Recipient = storedRecipient.String
+	req.Locale = locale.String
 	req.Secret = secret.String
 	req.Attempts = int(attempts.Int32)
-	req.Sender = sender.String
+	req.Resends = int(resends.Int32)
+	if lastSentAt.Valid {
+		req.LastSentAt = &lastSentAt.Time
+	}
 
 	return req, nil
 }
 
-// Update updates a verification request for the given verification ID & the payload
-func (pgs *Postgres) Update(verID string, req *verifier.Request) (*verifier.Request, error) {
+// ReadLastPending reads the last pending verification request of the commtype + recipient
+func (pgs *Postgres) ReadLastPending(ctx context.Context, ctype verifier.CommType, recipient string) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, pgs.tracer, "postgresql", "ReadLastPending")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := pgs.qbuilder.Select(
+		requestColumns...,
+	).From(
+		pgs.tableName,
+	).OrderBy(
+		"createdAt DESC",
+		"autoID DESC",
+	).Limit(
+		1,
+	).Where(squirrel.Eq{
+		"type":      ctype,
+		"recipient": recipient,
+		"status":    verifier.VerStatusPending,
+	}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ctxWithTimeout(ctx, pgs.cfg.ReadTimeout)
+	defer cancel()
+	row := pgs.pqdriver.QueryRow(
+		ctx,
+		query,
+		args...,
+	)
+
+	return scanRequest(row)
+}
+
+// ReadByID reads the verification request of the given ID
+func (pgs *Postgres) ReadByID(ctx context.Context, verID string) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, pgs.tracer, "postgresql", "ReadByID")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := pgs.qbuilder.Select(
+		requestColumns...,
+	).From(
+		pgs.tableName,
+	).Where(
+		squirrel.Eq{"id": verID},
+	).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ctxWithTimeout(ctx, pgs.cfg.ReadTimeout)
+	defer cancel()
+	row := pgs.pqdriver.QueryRow(
+		ctx,
+		query,
+		args...,
+	)
+
+	return scanRequest(row)
+}
+
+// List returns the requests matching the filter, latest first
+func (pgs *Postgres) List(ctx context.Context, filter *verifier.ListFilter) (_ []*verifier.Request, err error) {
+	ctx, span := startSpan(ctx, pgs.tracer, "postgresql", "List")
+	defer func() { endSpan(span, err) }()
+
+	where := squirrel.And{}
+	if filter.Type != "" {
+		where = append(where, squirrel.Eq{"type": filter.Type})
+	}
+	if filter.Recipient != "" {
+		where = append(where, squirrel.Eq{"recipient": filter.Recipient})
+	}
+	if filter.Status != "" {
+		where = append(where, squirrel.Eq{"status": filter.Status})
+	}
+	if filter.CreatedFrom != nil {
+		where = append(where, squirrel.GtOrEq{"createdAt": *filter.CreatedFrom})
+	}
+	if filter.CreatedTo != nil {
+		where = append(where, squirrel.LtOrEq{"createdAt": *filter.CreatedTo})
+	}
+
+	qbuilder := pgs.qbuilder.Select(
+		requestColumns...,
+	).From(
+		pgs.tableName,
+	).Where(
+		where,
+	).OrderBy(
+		"createdAt DESC",
+		"autoID DESC",
+	).Offset(
+		uint64(filter.Offset),
+	)
+	if filter.Limit > 0 {
+		qbuilder = qbuilder.Limit(uint64(filter.Limit))
+	}
+
+	query, args, err := qbuilder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ctxWithTimeout(ctx, pgs.cfg.ReadTimeout)
+	defer cancel()
+	rows, err := pgs.pqdriver.Query(
+		ctx,
+		query,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reqs := make([]*verifier.Request, 0, filter.Limit)
+	for rows.Next() {
+		req, err := scanRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return reqs, nil
+}
+
+// Update updates a pending verification request for the given verification ID & the payload
+func (pgs *Postgres) Update(ctx context.Context, verID string, req *verifier.Request) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, pgs.tracer, "postgresql", "Update")
+	defer func() { endSpan(span, err) }()
+
 	vermap, err := structToMapStringWithTag("json", req)
 	if err != nil {
 		return nil, err
 	}
+	// attempts & resends might have been incremented concurrently, after this request was read
+	vermap["attempts"] = squirrel.Expr("GREATEST(COALESCE(attempts, 0), ?)", req.Attempts)
+	vermap["resends"] = squirrel.Expr("GREATEST(COALESCE(resends, 0), ?)", req.Resends)
+	if req.LastSentAt != nil {
+		// GREATEST ignores NULLs
+		vermap["lastSentAt"] = squirrel.Expr("GREATEST(lastSentAt, ?)", *req.LastSentAt)
+	}
 
 	query, args, err := pgs.qbuilder.Update(
 		pgs.tableName,
 	).SetMap(
 		vermap,
 	).Where(
-		squirrel.Eq{"id": verID},
+		squirrel.Eq{"id": verID, "status": verifier.VerStatusPending},
 	).ToSql()
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = pgs.pqdriver.Exec(context.Background(), query, args...)
+	ctx, cancel := ctxWithTimeout(ctx, pgs.cfg.WriteTimeout)
+	defer cancel()
+	result, err := pgs.pqdriver.Exec(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	if result.RowsAffected() == 0 {
+		return nil, pgs.notUpdatedErr(ctx, verID)
+	}
 
 	return req, nil
 }
 
-// NewPostgres returns a new instance of Postgres with all the required fields initialized
-func NewPostgres(cfg *PostgresConfig) (*Postgres, error) {
+// notUpdatedErr returns the reason a conditional update of the request did not update any rows,
+// ErrNotFound if the request does not exist, else ErrRequestNotPending
+func (pgs *Postgres) notUpdatedErr(ctx context.Context, verID string) error {
+	_, err := pgs.ReadByID(ctx, verID)
+	if err != nil {
+		return err
+	}
+	return verifier.ErrRequestNotPending
+}
+
+// IncrementAttempts atomically increments the verification attempts of a pending request, and
+// returns the updated request
+func (pgs *Postgres) IncrementAttempts(ctx context.Context, verID string) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, pgs.tracer, "postgresql", "IncrementAttempts")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := pgs.qbuilder.Update(
+		pgs.tableName,
+	).Set(
+		"attempts", squirrel.Expr("COALESCE(attempts, 0) + 1"),
+	).Set(
+		"updatedAt", squirrel.Expr("now()"),
+	).Where(
+		squirrel.Eq{"id": verID, "status": verifier.VerStatusPending},
+	).Suffix(
+		"RETURNING " + strings.Join(requestColumns, ", "),
+	).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ctxWithTimeout(ctx, pgs.cfg.WriteTimeout)
+	defer cancel()
+	row := pgs.pqdriver.QueryRow(
+		ctx,
+		query,
+		args...,
+	)
+
+	req, err := scanRequest(row)
+	if errors.Is(err, verifier.ErrNotFound) {
+		return nil, pgs.notUpdatedErr(ctx, verID)
+	}
+	return req, err
+}
+
+// IncrementResends atomically increments the resends of the request if it can be resent, and
+// returns the updated request
+func (pgs *Postgres) IncrementResends(ctx context.Context, verID string, now time.Time, interval time.Duration, maxResends int) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, pgs.tracer, "postgresql", "IncrementResends")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := pgs.qbuilder.Update(
+		pgs.tableName,
+	).Set(
+		"resends", squirrel.Expr("COALESCE(resends, 0) + 1"),
+	).Set(
+		"lastSentAt", now,
+	).Set(
+		"updatedAt", now,
+	).Where(
+		squirrel.Eq{"id": verID, "status": verifier.VerStatusPending},
+	).Where(
+		squirrel.Lt{"COALESCE(resends, 0)": maxResends},
+	).Where(
+		squirrel.LtOrEq{"COALESCE(lastSentAt, createdAt)": now.Add(-interval)},
+	).Suffix(
+		"RETURNING " + strings.Join(requestColumns, ", "),
+	).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ctxWithTimeout(ctx, pgs.cfg.WriteTimeout)
+	defer cancel()
+	row := pgs.pqdriver.QueryRow(
+		ctx,
+		query,
+		args...,
+	)
+
+	req, err := scanRequest(row)
+	if errors.Is(err, verifier.ErrNotFound) {
+		return nil, pgs.notResentErr(ctx, verID, now, interval, maxResends)
+	}
+	return req, err
+}
+
+// notResentErr returns the reason a conditional increment of resends did not update any rows
+func (pgs *Postgres) notResentErr(ctx context.Context, verID string, now time.Time, interval time.Duration, maxResends int) error {
+	req, err := pgs.ReadByID(ctx, verID)
+	if err != nil {
+		return err
+	}
+
+	err = req.CheckResend(now, interval, maxResends)
+	if err != nil {
+		return err
+	}
+	// the request was resent concurrently, after it was not updated & before it was read
+	return verifier.ErrResendTooSoon
+}
+
+// newPostgresPool returns a connection pool, as per the configuration
+func newPostgresPool(cfg *PostgresConfig) (*pgxpool.Pool, error) {
 	poolcfg, err := pgxpool.ParseConfig(cfg.ConnURL())
 	if err != nil {
 		return nil, err
 	}
 
-	poolcfg.MaxConnLifetime = cfg.IdleTimeout
-	poolcfg.MaxConns = int32(cfg.PoolSize)
+	if cfg.IdleTimeout > 0 {
+		poolcfg.MaxConnLifetime = cfg.IdleTimeout
+	}
+	if cfg.PoolSize > 0 {
+		poolcfg.MaxConns = int32(cfg.PoolSize)
+	}
+
+	return pgxpool.NewWithConfig(context.Background(), poolcfg)
+}
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), poolcfg)
+// NewPostgres returns a new instance of Postgres with all the required fields initialized
+func NewPostgres(cfg *PostgresConfig) (*Postgres, error) {
+	pool, err := newPostgresPool(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -223,6 +513,7 @@ func NewPostgres(cfg *PostgresConfig) (*Postgres, error) {
 		tableName: cfg.TableName,
 		pqdriver:  pool,
 		qbuilder:  squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+		tracer:    verifier.Tracer(cfg.TracerProvider, tracerName),
 	}
 
 	return pg, nil
@@ -0,0 +1,184 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// newTestPostgres returns a Postgres store connected to the database configured using the
+// environment variables VERIFIER_TEST_POSTGRES_*. Tests are skipped if the host is not set, e.g.
+//
+//	docker run -d -p 5432:5432 -e POSTGRES_PASSWORD=password postgres
+//	VERIFIER_TEST_POSTGRES_HOST=localhost go test ./stores/...
+func newTestPostgres(t *testing.T) *Postgres {
+	t.Helper()
+
+	host := os.Getenv("VERIFIER_TEST_POSTGRES_HOST")
+	if host == "" {
+		t.Skip("VERIFIER_TEST_POSTGRES_HOST not set, skipping Postgres integration tests")
+	}
+
+	env := func(key, fallback string) string {
+		value := os.Getenv(key)
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+
+	pgs, err := NewPostgres(&PostgresConfig{
+		Host:         host,
+		Port:         env("VERIFIER_TEST_POSTGRES_PORT", "5432"),
+		Username:     env("VERIFIER_TEST_POSTGRES_USER", "postgres"),
+		Password:     env("VERIFIER_TEST_POSTGRES_PASSWORD", "password"),
+		StoreName:    env("VERIFIER_TEST_POSTGRES_DB", "postgres"),
+		PoolSize:     10,
+		ReadTimeout:  time.Second * 5,
+		WriteTimeout: time.Second * 5,
+		TableName:    "VerificationRequests",
+	})
+	if err != nil {
+		t.Fatalf("failed connecting to postgres: %v", err)
+	}
+	t.Cleanup(pgs.pqdriver.Close)
+
+	_, err = pgs.pqdriver.Exec(context.Background(), PostgresSchema)
+	if err != nil {
+		t.Fatalf("failed creating schema: %v", err)
+	}
+
+	return pgs
+}
+
+// newTestPostgresQueue returns an empty Postgres send queue, the jobs of previous tests are deleted
+// since every claim would return them
+func newTestPostgresQueue(t *testing.T) *PostgresQueue {
+	t.Helper()
+
+	pgs := newTestPostgres(t)
+	pgq, err := NewPostgresQueue(pgs.cfg)
+	if err != nil {
+		t.Fatalf("failed connecting to postgres: %v", err)
+	}
+	t.Cleanup(pgq.Close)
+
+	_, err = pgq.pqdriver.Exec(context.Background(), "DELETE FROM "+pgq.tableName)
+	if err != nil {
+		t.Fatalf("failed deleting jobs: %v", err)
+	}
+
+	return pgq
+}
+
+func newTestRequest(ctype verifier.CommType, recipient string, createdAt time.Time) *verifier.Request {
+	expiry := createdAt.Add(time.Hour)
+	return &verifier.Request{
+		ID:           fmt.Sprintf("%s-%d", recipient, createdAt.UnixNano()),
+		Type:         ctype,
+		Recipient:    recipient,
+		Secret:       "secret",
+		SecretExpiry: &expiry,
+		Status:       verifier.VerStatusPending,
+		CreatedAt:    &createdAt,
+		UpdatedAt:    &createdAt,
+	}
+}
+
+func TestPostgres_ReadLastPending(t *testing.T) {
+	pgs := newTestPostgres(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+	alice := fmt.Sprintf("alice-%d@example.com", suffix)
+	bob := fmt.Sprintf("bob-%d@example.com", suffix)
+	now := time.Now().Truncate(time.Microsecond)
+
+	// requests of both recipients are interleaved, so that the latest request overall is always
+	// of the other recipient
+	requests := []*verifier.Request{
+		newTestRequest(verifier.CommTypeEmail, alice, now.Add(-time.Minute*4)),
+		newTestRequest(verifier.CommTypeEmail, bob, now.Add(-time.Minute*3)),
+		newTestRequest(verifier.CommTypeEmail, alice, now.Add(-time.Minute*2)),
+		newTestRequest(verifier.CommTypeEmail, bob, now.Add(-time.Minute)),
+		newTestRequest(verifier.CommTypeMobile, alice, now),
+	}
+	for _, req := range requests {
+		_, err := pgs.Create(ctx, req)
+		if err != nil {
+			t.Fatalf("Postgres.Create() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		ctype     verifier.CommType
+		recipient string
+		wantID    string
+		wantErr   error
+	}{
+		{
+			name:      "latest of alice",
+			ctype:     verifier.CommTypeEmail,
+			recipient: alice,
+			wantID:    requests[2].ID,
+		},
+		{
+			name:      "latest of bob",
+			ctype:     verifier.CommTypeEmail,
+			recipient: bob,
+			wantID:    requests[3].ID,
+		},
+		{
+			name:      "latest of alice by type",
+			ctype:     verifier.CommTypeMobile,
+			recipient: alice,
+			wantID:    requests[4].ID,
+		},
+		{
+			name:      "no requests",
+			ctype:     verifier.CommTypeMobile,
+			recipient: bob,
+			wantErr:   verifier.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pgs.ReadLastPending(ctx, tt.ctype, tt.recipient)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Postgres.ReadLastPending() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.ID != tt.wantID {
+				t.Fatalf("expected request '%s', got '%s'", tt.wantID, got.ID)
+			}
+			if got.Recipient != tt.recipient {
+				t.Fatalf("expected recipient '%s', got '%s'", tt.recipient, got.Recipient)
+			}
+		})
+	}
+
+	t.Run("verified request is not pending", func(t *testing.T) {
+		verified := requests[3]
+		verified.Status = verifier.VerStatusVerified
+		_, err := pgs.Update(ctx, verified.ID, verified)
+		if err != nil {
+			t.Fatalf("Postgres.Update() error = %v", err)
+		}
+
+		got, err := pgs.ReadLastPending(ctx, verifier.CommTypeEmail, bob)
+		if err != nil {
+			t.Fatalf("Postgres.ReadLastPending() error = %v", err)
+		}
+		if got.ID != requests[1].ID {
+			t.Fatalf("expected request '%s', got '%s'", requests[1].ID, got.ID)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// DefaultQueueTableName is the table of the Postgres send queue, if PostgresConfig.QueueTableName
+// is not set
+const DefaultQueueTableName = "SendJobs"
+
+// jobColumns are the columns read for a job, in the order expected by scanJob
+var jobColumns = []string{
+	"id",
+	"requestId",
+	"type",
+	"subject",
+	"attempts",
+	"nextAttemptAt",
+	"lastError",
+	"createdAt",
+}
+
+// PostgresQueue implements verifier.SendQueue using Postgres. Jobs are claimed using
+// 'FOR UPDATE SKIP LOCKED', so that multiple instances of the service can send concurrently
+// without claiming the same jobs
+type PostgresQueue struct {
+	cfg       *PostgresConfig
+	tableName string
+	pqdriver  *pgxpool.Pool
+	qbuilder  squirrel.StatementBuilderType
+	tracer    trace.Tracer
+}
+
+// Enqueue persists a new job
+func (pgq *PostgresQueue) Enqueue(ctx context.Context, job *verifier.SendJob) (err error) {
+	ctx, span := startSpan(ctx, pgq.tracer, "postgresql", "Enqueue")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := pgq.qbuilder.Insert(pgq.tableName).SetMap(map[string]interface{}{
+		"id":            job.ID,
+		"requestId":     job.RequestID,
+		"type":          job.Type,
+		"subject":       job.Subject,
+		"attempts":      job.Attempts,
+		"nextAttemptAt": job.NextAttemptAt,
+		"lastError":     job.LastError,
+		"createdAt":     job.CreatedAt,
+	}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctxWithTimeout(ctx, pgq.cfg.WriteTimeout)
+	defer cancel()
+	_, err = pgq.pqdriver.Exec(ctx, query, args...)
+	return err
+}
+
+// scanJob scans a row with all the jobColumns, to a job
+func scanJob(row pgx.Row) (*verifier.SendJob, error) {
+	job := &verifier.SendJob{}
+	commtype := new(sql.NullString)
+	subject := new(sql.NullString)
+	lastError := new(sql.NullString)
+
+	err := row.Scan(
+		&job.ID,
+		&job.RequestID,
+		commtype,
+		subject,
+		&job.Attempts,
+		&job.NextAttemptAt,
+		lastError,
+		&job.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Type = verifier.CommType(commtype.String)
+	job.Subject = subject.String
+	job.LastError = lastError.String
+	return job, nil
+}
+
+// Claim returns at most limit jobs due to be attempted at now, oldest first. Claimed jobs are not
+// returned again till the lease expires. Jobs locked by concurrent claims are skipped
+func (pgq *PostgresQueue) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) (_ []*verifier.SendJob, err error) {
+	ctx, span := startSpan(ctx, pgq.tracer, "postgresql", "Claim")
+	defer func() { endSpan(span, err) }()
+
+	due := squirrel.Select("id").From(pgq.tableName).Where(
+		squirrel.LtOrEq{"nextAttemptAt": now},
+	).Where(
+		squirrel.Or{
+			squirrel.Eq{"claimedUntil": nil},
+			squirrel.LtOrEq{"claimedUntil": now},
+		},
+	).OrderBy(
+		"createdAt", "id",
+	).Limit(
+		uint64(limit),
+	).Suffix(
+		"FOR UPDATE SKIP LOCKED",
+	)
+
+	query, args, err := pgq.qbuilder.Update(
+		pgq.tableName,
+	).Set(
+		"claimedUntil", now.Add(lease),
+	).Where(
+		squirrel.Expr("id IN (?)", due),
+	).Suffix(
+		"RETURNING " + strings.Join(jobColumns, ", "),
+	).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ctxWithTimeout(ctx, pgq.cfg.WriteTimeout)
+	defer cancel()
+	rows, err := pgq.pqdriver.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*verifier.SendJob, 0, limit)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the rows returned by UPDATE are not ordered
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	return jobs, nil
+}
+
+// Retry updates a claimed job, and releases it to be claimed again at NextAttemptAt
+func (pgq *PostgresQueue) Retry(ctx context.Context, job *verifier.SendJob) (err error) {
+	ctx, span := startSpan(ctx, pgq.tracer, "postgresql", "Retry")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := pgq.qbuilder.Update(
+		pgq.tableName,
+	).SetMap(map[string]interface{}{
+		"attempts":      job.Attempts,
+		"nextAttemptAt": job.NextAttemptAt,
+		"lastError":     job.LastError,
+		"claimedUntil":  nil,
+	}).Where(
+		squirrel.Eq{"id": job.ID},
+	).ToSql()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctxWithTimeout(ctx, pgq.cfg.WriteTimeout)
+	defer cancel()
+	result, err := pgq.pqdriver.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return verifier.ErrJobNotFound
+	}
+
+	return nil
+}
+
+// Delete removes a job
+func (pgq *PostgresQueue) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := startSpan(ctx, pgq.tracer, "postgresql", "Delete")
+	defer func() { endSpan(span, err) }()
+
+	query, args, err := pgq.qbuilder.Delete(pgq.tableName).Where(squirrel.Eq{"id": id}).ToSql()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := ctxWithTimeout(ctx, pgq.cfg.WriteTimeout)
+	defer cancel()
+	result, err := pgq.pqdriver.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return verifier.ErrJobNotFound
+	}
+
+	return nil
+}
+
+// Close closes all the connections to Postgres
+func (pgq *PostgresQueue) Close() {
+	pgq.pqdriver.Close()
+}
+
+// NewPostgresQueue returns a send queue which persists the jobs in Postgres. The table is created
+// by PostgresSchema
+func NewPostgresQueue(cfg *PostgresConfig) (*PostgresQueue, error) {
+	pool, err := newPostgresPool(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tableName := cfg.QueueTableName
+	if tableName == "" {
+		tableName = DefaultQueueTableName
+	}
+
+	return &PostgresQueue{
+		cfg:       cfg,
+		tableName: tableName,
+		pqdriver:  pool,
+		qbuilder:  squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+		tracer:    verifier.Tracer(cfg.TracerProvider, tracerName),
+	}, nil
+}
@@ -1,13 +1,18 @@
 package stores
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/vmihailenco/msgpack/v4"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/naughtygopher/verifier"
+	"github.com/naughtygopher/verifier/internal/redisutil"
 )
 
 // RedisConfig holds all the configuration required for the redis handler
@@ -18,103 +23,546 @@ type RedisConfig struct {
 	DialTimeout  time.Duration `json:"dialTimeoutSecs,omitempty"`
 	ReadTimeout  time.Duration `json:"readTimeoutSecs,omitempty"`
 	WriteTimeout time.Duration `json:"writeTimeoutSecs,omitempty"`
+	// Retention is the duration for which requests are retained after their secret expires, so
+	// that verification of an expired secret is reported as expired. DefaultRetention is used if
+	// not set
+	Retention time.Duration `json:"retention,omitempty"`
+	// TracerProvider is used to trace the commands, the global tracer provider is used if not set
+	TracerProvider trace.TracerProvider `json:"-"`
 }
 
 // Redis struct exposes all the store functionalities required for verifier
+/*
+   Every request is stored in its own key, 'verifier:request:{<id>}'; with the expiry set to
+   the secret expiry + retention. Verification attempts are maintained in a separate counter,
+   'verifier:attempts:{<id>}', so that they can be incremented atomically. The status is also maintained
+   in 'verifier:status:{<id>}', so that only pending requests are updated or incremented. Requests
+   without a status key, i.e. created by earlier versions, are considered pending. Resends & the
+   time of the last send are maintained in 'verifier:resends:{<id>}' as '<resends>:<unix millis>',
+   so that they can be checked & incremented atomically. IDs of all the requests of a commtype + recipient are maintained
+   in a sorted set 'verifier:requests:<commtype>:<recipient>', scored by the creation time.
+   IDs of all the requests of a commtype are also maintained in a sorted set 'verifier:index:<commtype>'
+   scored by the creation time, to list requests which are not filtered by recipient.
+*/
 type Redis struct {
-	client redis.UniversalClient
+	client    redis.UniversalClient
+	retention time.Duration
+	tracer    trace.Tracer
 }
 
-// Create creates a new entry of the verification request in the store
-func (ris *Redis) Create(ver *verifier.Request) (*verifier.Request, error) {
-	key := fmt.Sprintf(
-		"%s-%s",
-		ver.Type,
-		ver.Recipient,
-	)
+// the verification ID is used as the hash tag, so that the request, its attempts & status are in the
+// same slot when using redis cluster
+func redisRequestKey(verID string) string {
+	return fmt.Sprintf("verifier:request:{%s}", verID)
+}
 
-	now := time.Now()
-	expiry := ver.SecretExpiry.Sub(now)
+func redisTypeKey(ctype verifier.CommType) string {
+	return fmt.Sprintf("verifier:index:%s", ctype)
+}
+
+func redisAttemptsKey(verID string) string {
+	return fmt.Sprintf("verifier:attempts:{%s}", verID)
+}
+
+func redisStatusKey(verID string) string {
+	return fmt.Sprintf("verifier:status:{%s}", verID)
+}
+
+func redisResendsKey(verID string) string {
+	return fmt.Sprintf("verifier:resends:{%s}", verID)
+}
+
+// redisResendsValue returns the value of the resends key, of the resends & time of the last send
+func redisResendsValue(resends int, lastSentAt time.Time) string {
+	return fmt.Sprintf("%d:%d", resends, lastSentAt.UnixMilli())
+}
+
+func redisRecipientKey(ctype verifier.CommType, recipient string) string {
+	return fmt.Sprintf("verifier:requests:%s:%s", ctype, recipient)
+}
+
+// ttl returns the duration for which the request should be retained in redis
+func (ris *Redis) ttl(ver *verifier.Request) time.Duration {
+	if ver.SecretExpiry == nil {
+		return ris.retention
+	}
+
+	ttl := time.Until(ver.SecretExpiry.Add(ris.retention))
+	if ttl < time.Millisecond {
+		// a TTL <= 0 would persist the key forever
+		ttl = time.Millisecond
+	}
+	return ttl
+}
+
+// Create creates a new entry of the verification request in the store
+func (ris *Redis) Create(ctx context.Context, ver *verifier.Request) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, ris.tracer, "redis", "Create")
+	defer func() { endSpan(span, err) }()
 
 	payload, err := msgpack.Marshal(ver)
 	if err != nil {
 		return nil, err
 	}
 
-	resp := ris.client.Set(
-		key,
-		payload,
-		expiry,
-	)
+	createdAt := time.Now()
+	if ver.CreatedAt != nil {
+		createdAt = *ver.CreatedAt
+	}
+
+	ttl := ris.ttl(ver)
+	cli := redisutil.WithContext(ctx, ris.client)
 
-	err = resp.Err()
+	created, err := cli.SetNX(redisRequestKey(ver.ID), payload, ttl).Result()
 	if err != nil {
 		return nil, err
 	}
+	if !created {
+		return nil, ErrDuplicateRequest
+	}
 
-	return ver, nil
-}
+	lastSentAt := createdAt
+	if ver.LastSentAt != nil {
+		lastSentAt = *ver.LastSentAt
+	}
+	_, err = cli.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(redisAttemptsKey(ver.ID), ver.Attempts, ttl)
+		pipe.Set(redisStatusKey(ver.ID), string(ver.Status), ttl)
+		pipe.Set(redisResendsKey(ver.ID), redisResendsValue(ver.Resends, lastSentAt), ttl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-// ReadLastPending reads the last pending verification request of the commtype + recipient
-func (ris *Redis) ReadLastPending(ctype verifier.CommType, recipient string) (*verifier.Request, error) {
-	key := fmt.Sprintf(
-		"%s-%s",
-		ctype,
-		recipient,
-	)
+	recipientKey := redisRecipientKey(ver.Type, ver.Recipient)
+	_, err = cli.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(recipientKey, redis.Z{
+			Score:  float64(createdAt.UnixNano()),
+			Member: ver.ID,
+		})
+		// the latest request would have the farthest expiry in most cases
+		pipe.Expire(recipientKey, ttl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	resp := ris.client.Get(key)
-	err := resp.Err()
+	typeKey := redisTypeKey(ver.Type)
+	_, err = cli.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(typeKey, redis.Z{
+			Score:  float64(createdAt.UnixNano()),
+			Member: ver.ID,
+		})
+		if ver.SecretExpiry != nil {
+			// requests of a type have the same expiry in most cases, so requests created before
+			// the lifetime of this request are past their retention as well
+			lifetime := ver.SecretExpiry.Add(ris.retention).Sub(createdAt)
+			evictBefore := time.Now().Add(-lifetime).UnixNano()
+			pipe.ZRemRangeByScore(typeKey, "-inf", fmt.Sprintf("(%d", evictBefore))
+		}
+		pipe.Expire(typeKey, ttl)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	b, err := resp.Bytes()
+	return ver, nil
+}
+
+// read reads the request of the given ID
+func (ris *Redis) read(cli redis.Cmdable, verID string) (*verifier.Request, error) {
+	values, err := cli.MGet(redisRequestKey(verID), redisAttemptsKey(verID), redisResendsKey(verID)).Result()
 	if err != nil {
 		return nil, err
 	}
 
+	return decodeRequest(values)
+}
+
+// decodeRequest decodes the request from the values of the request, attempts & resends keys
+func decodeRequest(values []interface{}) (*verifier.Request, error) {
+	payload, ok := values[0].(string)
+	if !ok {
+		return nil, verifier.ErrNotFound
+	}
+
 	ver := &verifier.Request{}
-	err = msgpack.Unmarshal(b, ver)
+	err := msgpack.Unmarshal([]byte(payload), ver)
 	if err != nil {
 		return nil, err
 	}
 
+	if counter, ok := values[1].(string); ok {
+		attempts, err := strconv.Atoi(counter)
+		if err != nil {
+			return nil, err
+		}
+		if attempts > ver.Attempts {
+			ver.Attempts = attempts
+		}
+	}
+
+	if value, ok := values[2].(string); ok {
+		var resends, lastSentAt int64
+		_, err := fmt.Sscanf(value, "%d:%d", &resends, &lastSentAt)
+		if err != nil {
+			return nil, err
+		}
+		if int(resends) > ver.Resends {
+			ver.Resends = int(resends)
+		}
+		if ver.LastSentAt == nil || lastSentAt > ver.LastSentAt.UnixMilli() {
+			sentAt := time.UnixMilli(lastSentAt)
+			ver.LastSentAt = &sentAt
+		}
+	}
 	return ver, nil
 }
 
+// ReadByID reads the verification request of the given ID
+func (ris *Redis) ReadByID(ctx context.Context, verID string) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, ris.tracer, "redis", "ReadByID")
+	defer func() { endSpan(span, err) }()
+
+	return ris.read(redisutil.WithContext(ctx, ris.client), verID)
+}
+
+// ReadLastPending reads the last pending verification request of the commtype + recipient
+func (ris *Redis) ReadLastPending(ctx context.Context, ctype verifier.CommType, recipient string) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, ris.tracer, "redis", "ReadLastPending")
+	defer func() { endSpan(span, err) }()
+
+	cli := redisutil.WithContext(ctx, ris.client)
+	recipientKey := redisRecipientKey(ctype, recipient)
+
+	ids, err := cli.ZRevRange(recipientKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		ver, err := ris.read(cli, id)
+		if err == verifier.ErrNotFound {
+			// the request has expired, and is removed from the recipient's requests as well
+			cli.ZRem(recipientKey, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if ver.Status == verifier.VerStatusPending {
+			return ver, nil
+		}
+	}
+
+	return nil, verifier.ErrNotFound
+}
+
+// redisListBatchSize is the number of IDs read from the sorted sets at once, while listing
+const redisListBatchSize = 100
+
+// List returns the requests matching the filter, latest first. Requests are read from the sorted
+// set of the recipient if the filter has a recipient, else from the sorted set of the type
+func (ris *Redis) List(ctx context.Context, filter *verifier.ListFilter) (_ []*verifier.Request, err error) {
+	ctx, span := startSpan(ctx, ris.tracer, "redis", "List")
+	defer func() { endSpan(span, err) }()
+
+	cli := redisutil.WithContext(ctx, ris.client)
+
+	ctypes := []verifier.CommType{filter.Type}
+	if filter.Type == "" {
+		ctypes = []verifier.CommType{verifier.CommTypeEmail, verifier.CommTypeMobile}
+	}
+
+	// the requests of every type are required till the last request of the page, since they're
+	// merged & sorted before paginating
+	n := 0
+	if filter.Limit > 0 {
+		n = filter.Offset + filter.Limit
+	}
+
+	reqs := make([]*verifier.Request, 0, n)
+	for _, ctype := range ctypes {
+		key := redisTypeKey(ctype)
+		if filter.Recipient != "" {
+			key = redisRecipientKey(ctype, filter.Recipient)
+		}
+
+		matched, err := ris.list(cli, key, filter, n)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, matched...)
+	}
+
+	sort.Slice(reqs, func(i, j int) bool {
+		ci, cj := createdAt(reqs[i]), createdAt(reqs[j])
+		if ci.Equal(cj) {
+			return reqs[i].ID > reqs[j].ID
+		}
+		return ci.After(cj)
+	})
+
+	return paginate(reqs, filter), nil
+}
+
+// list returns the first n requests (or all, if n is 0) matching the filter, from the sorted set
+// of request IDs
+func (ris *Redis) list(cli redis.Cmdable, key string, filter *verifier.ListFilter, n int) ([]*verifier.Request, error) {
+	rangeBy := redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "+inf",
+		Count: redisListBatchSize,
+	}
+	if filter.CreatedFrom != nil {
+		rangeBy.Min = strconv.FormatInt(filter.CreatedFrom.UnixNano(), 10)
+	}
+	if filter.CreatedTo != nil {
+		rangeBy.Max = strconv.FormatInt(filter.CreatedTo.UnixNano(), 10)
+	}
+
+	reqs := make([]*verifier.Request, 0, n)
+	expired := make([]interface{}, 0)
+	for {
+		ids, err := cli.ZRevRangeByScore(key, rangeBy).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		rangeBy.Offset += int64(len(ids))
+
+		cmds := make([]*redis.SliceCmd, len(ids))
+		_, err = cli.Pipelined(func(pipe redis.Pipeliner) error {
+			for i, id := range ids {
+				cmds[i] = pipe.MGet(redisRequestKey(id), redisAttemptsKey(id), redisResendsKey(id))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for i, cmd := range cmds {
+			ver, err := decodeRequest(cmd.Val())
+			if err == verifier.ErrNotFound {
+				expired = append(expired, ids[i])
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if filter.Match(ver) {
+				reqs = append(reqs, ver)
+			}
+		}
+
+		if n > 0 && len(reqs) >= n {
+			reqs = reqs[:n]
+			break
+		}
+	}
+
+	if len(expired) > 0 {
+		// expired requests are removed only after reading, since removing them while reading
+		// would shift the offset
+		cli.ZRem(key, expired...)
+	}
+
+	return reqs, nil
+}
+
+// redisUpdateScript updates the request only if it exists & is pending, and never decreases the
+// attempts. Returns 0 if the request does not exist, and -1 if it's not pending
+var redisUpdateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local status = redis.call('GET', KEYS[3])
+if status and status ~= ARGV[5] then
+	return -1
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+redis.call('SET', KEYS[3], ARGV[4], 'PX', ARGV[2])
+redis.call('PEXPIRE', KEYS[4], ARGV[2])
+local attempts = tonumber(redis.call('GET', KEYS[2]) or '0')
+if tonumber(ARGV[3]) > attempts then
+	redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[2])
+else
+	redis.call('PEXPIRE', KEYS[2], ARGV[2])
+end
+return 1
+`)
+
 // Update updates a verification request for the given verification ID & the payload
-func (ris *Redis) Update(verID string, ver *verifier.Request) (*verifier.Request, error) {
-	key := fmt.Sprintf(
-		"%s-%s",
-		ver.Type,
-		ver.Recipient,
-	)
-	now := time.Now()
-	expiry := ver.SecretExpiry.Sub(now)
+func (ris *Redis) Update(ctx context.Context, verID string, ver *verifier.Request) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, ris.tracer, "redis", "Update")
+	defer func() { endSpan(span, err) }()
 
 	payload, err := msgpack.Marshal(ver)
 	if err != nil {
 		return nil, err
 	}
 
-	resp := ris.client.Set(
-		key,
+	updated, err := redisUpdateScript.Run(
+		redisutil.WithContext(ctx, ris.client),
+		[]string{redisRequestKey(verID), redisAttemptsKey(verID), redisStatusKey(verID), redisResendsKey(verID)},
 		payload,
-		expiry,
-	)
+		ris.ttl(ver).Milliseconds(),
+		ver.Attempts,
+		string(ver.Status),
+		string(verifier.VerStatusPending),
+	).Int()
+	if err != nil {
+		return nil, err
+	}
+	if updated == 0 {
+		return nil, verifier.ErrNotFound
+	}
+	if updated < 0 {
+		return nil, verifier.ErrRequestNotPending
+	}
+
+	return ver, nil
+}
+
+// redisIncrementScript increments the attempts of the request only if it exists & is pending, and
+// returns the incremented attempts. Returns -1 if the request does not exist, and -2 if it's not pending
+var redisIncrementScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl == -2 then
+	return -1
+end
+local status = redis.call('GET', KEYS[3])
+if status and status ~= ARGV[1] then
+	return -2
+end
+local attempts = redis.call('INCR', KEYS[2])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return attempts
+`)
+
+// IncrementAttempts atomically increments the verification attempts of the request, and returns
+// the updated request
+func (ris *Redis) IncrementAttempts(ctx context.Context, verID string) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, ris.tracer, "redis", "IncrementAttempts")
+	defer func() { endSpan(span, err) }()
+
+	cli := redisutil.WithContext(ctx, ris.client)
+	attempts, err := redisIncrementScript.Run(
+		cli,
+		[]string{redisRequestKey(verID), redisAttemptsKey(verID), redisStatusKey(verID)},
+		string(verifier.VerStatusPending),
+	).Int()
+	if err != nil {
+		return nil, err
+	}
+	if attempts == -1 {
+		return nil, verifier.ErrNotFound
+	}
+	if attempts < 0 {
+		return nil, verifier.ErrRequestNotPending
+	}
 
-	err = resp.Err()
+	ver, err := ris.read(cli, verID)
 	if err != nil {
 		return nil, err
 	}
+	// attempts might have been incremented again after this increment, but the count returned
+	// should be of this increment
+	ver.Attempts = attempts
 
-	return nil, nil
+	return ver, nil
 }
 
-// NewRedis returns a newly initialized redis store
-func NewRedis(cfg *RedisConfig) (*Redis, error) {
-	cli := redis.NewUniversalClient(
+// redisResendScript increments the resends of the request only if it exists, is pending, has been
+// resent less than the maximum resends & was last sent at least the interval before now; and
+// returns the incremented resends. Returns -1 if the request does not exist, -2 if it's not
+// pending, -3 if the maximum resends are exceeded, and -4 if it's too soon
+var redisResendScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl == -2 then
+	return -1
+end
+local status = redis.call('GET', KEYS[2])
+if status and status ~= ARGV[1] then
+	return -2
+end
+local resends, lastSentAt = 0, 0
+local value = redis.call('GET', KEYS[3])
+if value then
+	local count, sentAt = string.match(value, '^(%d+):(%d+)$')
+	resends, lastSentAt = tonumber(count), tonumber(sentAt)
+end
+if resends >= tonumber(ARGV[4]) then
+	return -3
+end
+if tonumber(ARGV[2]) - lastSentAt < tonumber(ARGV[3]) then
+	return -4
+end
+resends = resends + 1
+redis.call('SET', KEYS[3], resends .. ':' .. ARGV[2])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[3], ttl)
+end
+return resends
+`)
+
+// redisResendErrs are the errors of the negative results of redisResendScript
+var redisResendErrs = map[int]error{
+	-1: verifier.ErrNotFound,
+	-2: verifier.ErrRequestNotPending,
+	-3: verifier.ErrMaximumResendsExceeded,
+	-4: verifier.ErrResendTooSoon,
+}
+
+// IncrementResends atomically increments the resends of the request if it can be resent, and
+// returns the updated request
+func (ris *Redis) IncrementResends(ctx context.Context, verID string, now time.Time, interval time.Duration, maxResends int) (_ *verifier.Request, err error) {
+	ctx, span := startSpan(ctx, ris.tracer, "redis", "IncrementResends")
+	defer func() { endSpan(span, err) }()
+
+	cli := redisutil.WithContext(ctx, ris.client)
+	resends, err := redisResendScript.Run(
+		cli,
+		[]string{redisRequestKey(verID), redisStatusKey(verID), redisResendsKey(verID)},
+		string(verifier.VerStatusPending),
+		now.UnixMilli(),
+		interval.Milliseconds(),
+		maxResends,
+	).Int()
+	if err != nil {
+		return nil, err
+	}
+	if resends < 0 {
+		return nil, redisResendErrs[resends]
+	}
+
+	ver, err := ris.read(cli, verID)
+	if err != nil {
+		return nil, err
+	}
+	// the request might have been resent again after this increment, but the values returned
+	// should be of this increment
+	sentAt := time.UnixMilli(now.UnixMilli())
+	ver.Resends = resends
+	ver.LastSentAt = &sentAt
+
+	return ver, nil
+}
+
+// NewRedisClient returns a Redis client of the configuration, so that other Redis backends
+// (e.g. the rate limiter) can be configured the same way as the store
+func NewRedisClient(cfg *RedisConfig) redis.UniversalClient {
+	return redis.NewUniversalClient(
 		&redis.UniversalOptions{
 			Addrs:        cfg.Hosts,
 			Password:     cfg.Password,
@@ -124,15 +572,26 @@ func NewRedis(cfg *RedisConfig) (*Redis, error) {
 			PoolTimeout:  cfg.WriteTimeout * 10,
 		},
 	)
+}
 
+// NewRedis returns a newly initialized redis store
+func NewRedis(cfg *RedisConfig) (*Redis, error) {
+	cli := NewRedisClient(cfg)
 	result := cli.Ping()
 	err := result.Err()
 	if err != nil {
 		return nil, err
 	}
 
+	retention := cfg.Retention
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
 	r := &Redis{
-		client: cli,
+		client:    cli,
+		retention: retention,
+		tracer:    verifier.Tracer(cfg.TracerProvider, tracerName),
 	}
 	return r, nil
 }
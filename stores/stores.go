@@ -0,0 +1,29 @@
+// Package stores has the persistent stores for verifier, i.e. Postgres, Redis & in-memory
+package stores
+
+import (
+	"errors"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// DefaultRetention is the duration for which requests are retained after their secret expires
+const DefaultRetention = time.Hour * 24
+
+// ErrDuplicateRequest is the error returned when a request with the same ID already exists
+var ErrDuplicateRequest = errors.New("verification request already exists")
+
+// paginate returns the page of requests as per the offset & limit of the filter
+func paginate(reqs []*verifier.Request, filter *verifier.ListFilter) []*verifier.Request {
+	if filter.Offset >= len(reqs) {
+		return []*verifier.Request{}
+	}
+
+	reqs = reqs[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(reqs) {
+		reqs = reqs[:filter.Limit]
+	}
+
+	return reqs
+}
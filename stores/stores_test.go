@@ -0,0 +1,121 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/naughtygopher/verifier"
+	"github.com/naughtygopher/verifier/stores/storetest"
+)
+
+func newTestRedis(t *testing.T) *Redis {
+	t.Helper()
+	return newTestRedisWithTracer(t, nil)
+}
+
+func newTestRedisWithTracer(t *testing.T, tp trace.TracerProvider) *Redis {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	ris, err := NewRedis(&RedisConfig{
+		Hosts:          []string{mr.Addr()},
+		DialTimeout:    time.Second,
+		ReadTimeout:    time.Second,
+		WriteTimeout:   time.Second,
+		TracerProvider: tp,
+	})
+	if err != nil {
+		t.Fatalf("failed connecting to redis: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = ris.client.Close()
+	})
+
+	return ris
+}
+
+func TestMemory_conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		return NewMemory(nil)
+	})
+}
+
+func TestRedis_conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		return newTestRedis(t)
+	})
+}
+
+func TestPostgres_conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		return newTestPostgres(t)
+	})
+}
+
+func TestMemoryQueue_conformance(t *testing.T) {
+	storetest.RunQueue(t, func(t *testing.T) storetest.Queue {
+		return NewMemoryQueue()
+	})
+}
+
+func TestPostgresQueue_conformance(t *testing.T) {
+	storetest.RunQueue(t, func(t *testing.T) storetest.Queue {
+		return newTestPostgresQueue(t)
+	})
+}
+
+func TestRedis_tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ris := newTestRedisWithTracer(t, tp)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, err := ris.ReadByID(ctx, "missing")
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+	_, err = ris.IncrementAttempts(ctx, "missing")
+	parent.End()
+	if err == nil {
+		t.Fatalf("expected error incrementing attempts of a missing request")
+	}
+
+	tests := []struct {
+		name       string
+		wantStatus codes.Code
+	}{
+		// not found is an expected result of reads, and is not an error of the store
+		{name: "redis.ReadByID", wantStatus: codes.Unset},
+		{name: "redis.IncrementAttempts", wantStatus: codes.Unset},
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, ok := spans[tt.name]
+			if !ok {
+				t.Fatalf("span '%s' not found", tt.name)
+			}
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Fatalf("expected span '%s' to be a child of the span in context", tt.name)
+			}
+			if span.SpanKind() != trace.SpanKindClient {
+				t.Fatalf("expected span kind '%v', got '%v'", trace.SpanKindClient, span.SpanKind())
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Fatalf("expected status '%v', got '%v'", tt.wantStatus, span.Status().Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// Queue is the interface a verifier send queue implements
+type Queue interface {
+	Enqueue(ctx context.Context, job *verifier.SendJob) error
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*verifier.SendJob, error)
+	Retry(ctx context.Context, job *verifier.SendJob) error
+	Delete(ctx context.Context, id string) error
+}
+
+// NewQueue returns the queue to be tested, it's expected to be empty
+type NewQueue func(t *testing.T) Queue
+
+// NewJob returns a job of a mobile verification request, due at the creation time
+func NewJob(createdAt time.Time) *verifier.SendJob {
+	createdAt = createdAt.Truncate(time.Millisecond)
+	id := fmt.Sprintf("%d-%d", createdAt.UnixNano(), atomic.AddUint64(&seq, 1))
+	return &verifier.SendJob{
+		ID:            id,
+		RequestID:     "request-" + id,
+		Type:          verifier.CommTypeMobile,
+		NextAttemptAt: createdAt,
+		CreatedAt:     createdAt,
+	}
+}
+
+// RunQueue runs all the conformance tests of send queues
+func RunQueue(t *testing.T, newQueue NewQueue) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, queue Queue)
+	}{
+		{name: "Claim", test: testClaim},
+		{name: "Claim not due", test: testClaimNotDue},
+		{name: "Claim lease", test: testClaimLease},
+		{name: "Retry", test: testRetry},
+		{name: "Delete", test: testDelete},
+		{name: "Concurrent claims", test: testConcurrentClaims},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newQueue(t))
+		})
+	}
+}
+
+func enqueue(t *testing.T, queue Queue, jobs ...*verifier.SendJob) {
+	t.Helper()
+	for _, job := range jobs {
+		err := queue.Enqueue(context.Background(), job)
+		if err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+}
+
+func claim(t *testing.T, queue Queue, now time.Time, limit int) []*verifier.SendJob {
+	t.Helper()
+	jobs, err := queue.Claim(context.Background(), now, time.Minute, limit)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	return jobs
+}
+
+func assertJobs(t *testing.T, want, got []*verifier.SendJob) {
+	t.Helper()
+	if len(want) != len(got) {
+		t.Fatalf("expected %d jobs, got %d", len(want), len(got))
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if w.ID != g.ID || w.RequestID != g.RequestID || w.Type != g.Type || w.Subject != g.Subject {
+			t.Fatalf("expected job %+v, got %+v", w, g)
+		}
+		if w.Attempts != g.Attempts || w.LastError != g.LastError {
+			t.Fatalf("expected attempts %d & error '%s', got %d & '%s'", w.Attempts, w.LastError, g.Attempts, g.LastError)
+		}
+		if !w.NextAttemptAt.Equal(g.NextAttemptAt) || !w.CreatedAt.Equal(g.CreatedAt) {
+			t.Fatalf("expected times %v & %v, got %v & %v", w.NextAttemptAt, w.CreatedAt, g.NextAttemptAt, g.CreatedAt)
+		}
+	}
+}
+
+func testClaim(t *testing.T, queue Queue) {
+	now := time.Now()
+	jobs := []*verifier.SendJob{NewJob(now), NewJob(now.Add(time.Millisecond)), NewJob(now.Add(time.Millisecond * 2))}
+	jobs[1].Type = verifier.CommTypeEmail
+	jobs[1].Subject = "Verify your email"
+	// enqueued out of order, claims are oldest first
+	enqueue(t, queue, jobs[2], jobs[0], jobs[1])
+
+	later := now.Add(time.Second)
+	assertJobs(t, jobs[:2], claim(t, queue, later, 2))
+	// claimed jobs are not claimed again
+	assertJobs(t, jobs[2:], claim(t, queue, later, 2))
+	assertJobs(t, nil, claim(t, queue, later, 2))
+}
+
+func testClaimNotDue(t *testing.T, queue Queue) {
+	now := time.Now()
+	job := NewJob(now)
+	job.NextAttemptAt = job.CreatedAt.Add(time.Minute)
+	enqueue(t, queue, job)
+
+	assertJobs(t, nil, claim(t, queue, now.Add(time.Second), 1))
+	assertJobs(t, []*verifier.SendJob{job}, claim(t, queue, now.Add(time.Minute*2), 1))
+}
+
+func testClaimLease(t *testing.T, queue Queue) {
+	now := time.Now()
+	job := NewJob(now)
+	enqueue(t, queue, job)
+
+	assertJobs(t, []*verifier.SendJob{job}, claim(t, queue, now, 1))
+	assertJobs(t, nil, claim(t, queue, now.Add(time.Second*30), 1))
+	// jobs are claimed again once the lease expires, e.g. if the worker which claimed it stopped
+	assertJobs(t, []*verifier.SendJob{job}, claim(t, queue, now.Add(time.Minute*2), 1))
+}
+
+func testRetry(t *testing.T, queue Queue) {
+	now := time.Now()
+	job := NewJob(now)
+	enqueue(t, queue, job)
+	claimed := claim(t, queue, now, 1)
+	assertJobs(t, []*verifier.SendJob{job}, claimed)
+
+	retry := claimed[0]
+	retry.Attempts = 1
+	retry.LastError = "throttled"
+	retry.NextAttemptAt = job.CreatedAt.Add(time.Second)
+	err := queue.Retry(context.Background(), retry)
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+
+	assertJobs(t, nil, claim(t, queue, now, 1))
+	// released before the lease expires, once the job is due
+	assertJobs(t, []*verifier.SendJob{retry}, claim(t, queue, now.Add(time.Second*2), 1))
+
+	err = queue.Retry(context.Background(), NewJob(now))
+	if !errors.Is(err, verifier.ErrJobNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrJobNotFound, err)
+	}
+}
+
+func testDelete(t *testing.T, queue Queue) {
+	now := time.Now()
+	job := NewJob(now)
+	enqueue(t, queue, job)
+
+	err := queue.Delete(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	assertJobs(t, nil, claim(t, queue, now.Add(time.Hour), 1))
+
+	err = queue.Delete(context.Background(), job.ID)
+	if !errors.Is(err, verifier.ErrJobNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrJobNotFound, err)
+	}
+}
+
+func testConcurrentClaims(t *testing.T, queue Queue) {
+	const (
+		jobs        = 30
+		concurrency = 10
+	)
+	now := time.Now()
+	for i := 0; i < jobs; i++ {
+		enqueue(t, queue, NewJob(now.Add(time.Duration(i)*time.Millisecond)))
+	}
+
+	mu := sync.Mutex{}
+	claimed := map[string]int{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				got, err := queue.Claim(context.Background(), now.Add(time.Second), time.Minute, 2)
+				if err != nil {
+					t.Errorf("Claim() error = %v", err)
+					return
+				}
+				if len(got) == 0 {
+					return
+				}
+
+				mu.Lock()
+				for _, job := range got {
+					claimed[job.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != jobs {
+		t.Fatalf("expected %d jobs to be claimed, got %d", jobs, len(claimed))
+	}
+	for id, count := range claimed {
+		if count != 1 {
+			t.Fatalf("expected job %s to be claimed once, got %d", id, count)
+		}
+	}
+}
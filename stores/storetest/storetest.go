@@ -0,0 +1,771 @@
+// Package storetest has the conformance tests for verifier stores. Every store implementation is
+// expected to pass these tests, so that verifier behaves the same irrespective of the store used
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// Store is the interface a verifier store implements
+type Store interface {
+	Create(ctx context.Context, ver *verifier.Request) (*verifier.Request, error)
+	ReadLastPending(ctx context.Context, ctype verifier.CommType, recipient string) (*verifier.Request, error)
+	ReadByID(ctx context.Context, verID string) (*verifier.Request, error)
+	Update(ctx context.Context, verID string, ver *verifier.Request) (*verifier.Request, error)
+	IncrementAttempts(ctx context.Context, verID string) (*verifier.Request, error)
+	IncrementResends(ctx context.Context, verID string, now time.Time, interval time.Duration, maxResends int) (*verifier.Request, error)
+	List(ctx context.Context, filter *verifier.ListFilter) ([]*verifier.Request, error)
+}
+
+// NewStore returns the store to be tested
+type NewStore func(t *testing.T) Store
+
+var seq uint64
+
+// uniqueRecipient returns a recipient which is unique across tests & test runs, so that the
+// stores need not be emptied before every test
+func uniqueRecipient(name string) string {
+	return fmt.Sprintf("%s-%d-%d@example.com", name, time.Now().UnixNano(), atomic.AddUint64(&seq, 1))
+}
+
+// NewRequest returns a pending verification request, with its secret expiring an hour after
+// the creation time
+func NewRequest(ctype verifier.CommType, recipient string, createdAt time.Time) *verifier.Request {
+	createdAt = createdAt.Truncate(time.Millisecond)
+	expiry := createdAt.Add(time.Hour)
+	return &verifier.Request{
+		ID:           fmt.Sprintf("%d-%d", createdAt.UnixNano(), atomic.AddUint64(&seq, 1)),
+		Type:         ctype,
+		Recipient:    recipient,
+		Secret:       "secret",
+		SecretExpiry: &expiry,
+		Status:       verifier.VerStatusPending,
+		LastSentAt:   &createdAt,
+		CreatedAt:    &createdAt,
+		UpdatedAt:    &createdAt,
+	}
+}
+
+func create(t *testing.T, store Store, reqs ...*verifier.Request) {
+	t.Helper()
+	for _, req := range reqs {
+		_, err := store.Create(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+}
+
+func readLastPending(t *testing.T, store Store, ctype verifier.CommType, recipient string) *verifier.Request {
+	t.Helper()
+	got, err := store.ReadLastPending(context.Background(), ctype, recipient)
+	if err != nil {
+		t.Fatalf("ReadLastPending() error = %v", err)
+	}
+	return got
+}
+
+func assertEqual(t *testing.T, want, got *verifier.Request) {
+	t.Helper()
+	if got.ID != want.ID {
+		t.Fatalf("expected ID '%s', got '%s'", want.ID, got.ID)
+	}
+	if got.Type != want.Type {
+		t.Fatalf("expected type '%s', got '%s'", want.Type, got.Type)
+	}
+	if got.Recipient != want.Recipient {
+		t.Fatalf("expected recipient '%s', got '%s'", want.Recipient, got.Recipient)
+	}
+	if got.Locale != want.Locale {
+		t.Fatalf("expected locale '%s', got '%s'", want.Locale, got.Locale)
+	}
+	if got.Secret != want.Secret {
+		t.Fatalf("expected secret '%s', got '%s'", want.Secret, got.Secret)
+	}
+	if got.Status != want.Status {
+		t.Fatalf("expected status '%s', got '%s'", want.Status, got.Status)
+	}
+	if got.Attempts != want.Attempts {
+		t.Fatalf("expected attempts %d, got %d", want.Attempts, got.Attempts)
+	}
+	if got.SecretExpiry == nil || !got.SecretExpiry.Equal(*want.SecretExpiry) {
+		t.Fatalf("expected secret expiry '%v', got '%v'", want.SecretExpiry, got.SecretExpiry)
+	}
+	if got.Resends != want.Resends {
+		t.Fatalf("expected resends %d, got %d", want.Resends, got.Resends)
+	}
+	if (got.LastSentAt == nil) != (want.LastSentAt == nil) ||
+		(got.LastSentAt != nil && !got.LastSentAt.Equal(*want.LastSentAt)) {
+		t.Fatalf("expected last sent at '%v', got '%v'", want.LastSentAt, got.LastSentAt)
+	}
+	if len(got.CommStatus) != len(want.CommStatus) {
+		t.Fatalf("expected %d comm statuses, got %d", len(want.CommStatus), len(got.CommStatus))
+	}
+	for i := range want.CommStatus {
+		if got.CommStatus[i].Status != want.CommStatus[i].Status {
+			t.Fatalf(
+				"expected comm status '%s', got '%s'",
+				want.CommStatus[i].Status,
+				got.CommStatus[i].Status,
+			)
+		}
+	}
+}
+
+// Run runs all the conformance tests against the store returned by newStore. newStore is called
+// for every test, and the returned store may be shared across tests since every test uses unique
+// recipients
+func Run(t *testing.T, newStore NewStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{name: "Create", test: testCreate},
+		{name: "ReadLastPending not found", test: testReadLastPendingNotFound},
+		{name: "ReadLastPending ordering", test: testReadLastPendingOrdering},
+		{name: "ReadLastPending isolation", test: testReadLastPendingIsolation},
+		{name: "ReadByID", test: testReadByID},
+		{name: "ReadByID not found", test: testReadByIDNotFound},
+		{name: "Update", test: testUpdate},
+		{name: "Update not found", test: testUpdateNotFound},
+		{name: "Update status", test: testUpdateStatus},
+		{name: "Expiry", test: testExpiry},
+		{name: "Concurrent updates", test: testConcurrentUpdates},
+		{name: "IncrementAttempts", test: testIncrementAttempts},
+		{name: "IncrementAttempts not found", test: testIncrementAttemptsNotFound},
+		{name: "Concurrent IncrementAttempts", test: testConcurrentIncrementAttempts},
+		{name: "Update does not decrease attempts", test: testUpdateAttempts},
+		{name: "Update not pending", test: testUpdateNotPending},
+		{name: "IncrementAttempts not pending", test: testIncrementAttemptsNotPending},
+		{name: "Concurrent status updates", test: testConcurrentStatusUpdates},
+		{name: "IncrementResends", test: testIncrementResends},
+		{name: "IncrementResends not found", test: testIncrementResendsNotFound},
+		{name: "IncrementResends not pending", test: testIncrementResendsNotPending},
+		{name: "Concurrent IncrementResends", test: testConcurrentIncrementResends},
+		{name: "List by recipient", test: testListRecipient},
+		{name: "List by status", test: testListStatus},
+		{name: "List by time range", test: testListTimeRange},
+		{name: "List pagination", test: testListPagination},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func testCreate(t *testing.T, store Store) {
+	req := NewRequest(verifier.CommTypeEmail, uniqueRecipient("create"), time.Now())
+	req.Sender = "noreply@example.com"
+	req.Data = map[string]string{"key": "value"}
+	req.Locale = "pt-BR"
+
+	got, err := store.Create(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	assertEqual(t, req, got)
+	assertEqual(t, req, readLastPending(t, store, req.Type, req.Recipient))
+
+	_, err = store.Create(context.Background(), req)
+	if err == nil {
+		t.Fatalf("expected error when creating a request with an existing ID")
+	}
+}
+
+func testReadLastPendingNotFound(t *testing.T, store Store) {
+	_, err := store.ReadLastPending(
+		context.Background(),
+		verifier.CommTypeMobile,
+		uniqueRecipient("not-found"),
+	)
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+}
+
+func testReadLastPendingOrdering(t *testing.T, store Store) {
+	recipient := uniqueRecipient("ordering")
+	now := time.Now()
+	oldest := NewRequest(verifier.CommTypeMobile, recipient, now.Add(-time.Minute*2))
+	latest := NewRequest(verifier.CommTypeMobile, recipient, now)
+	older := NewRequest(verifier.CommTypeMobile, recipient, now.Add(-time.Minute))
+
+	// the latest request is the one created last, by its creation time & not by the order of
+	// calling Create
+	create(t, store, oldest, latest, older)
+	assertEqual(t, latest, readLastPending(t, store, verifier.CommTypeMobile, recipient))
+}
+
+func testReadLastPendingIsolation(t *testing.T, store Store) {
+	alice := uniqueRecipient("alice")
+	bob := uniqueRecipient("bob")
+	now := time.Now()
+
+	aliceEmail := NewRequest(verifier.CommTypeEmail, alice, now.Add(-time.Minute*3))
+	bobEmail := NewRequest(verifier.CommTypeEmail, bob, now.Add(-time.Minute*2))
+	aliceMobile := NewRequest(verifier.CommTypeMobile, alice, now.Add(-time.Minute))
+	create(t, store, aliceEmail, bobEmail, aliceMobile)
+
+	assertEqual(t, aliceEmail, readLastPending(t, store, verifier.CommTypeEmail, alice))
+	assertEqual(t, bobEmail, readLastPending(t, store, verifier.CommTypeEmail, bob))
+	assertEqual(t, aliceMobile, readLastPending(t, store, verifier.CommTypeMobile, alice))
+
+	_, err := store.ReadLastPending(context.Background(), verifier.CommTypeMobile, bob)
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+}
+
+func testReadByID(t *testing.T, store Store) {
+	recipient := uniqueRecipient("read-by-id")
+	now := time.Now()
+	older := NewRequest(verifier.CommTypeEmail, recipient, now.Add(-time.Minute))
+	latest := NewRequest(verifier.CommTypeEmail, recipient, now)
+	create(t, store, older, latest)
+
+	// any request can be read by its ID, and not just the latest pending request
+	got, err := store.ReadByID(context.Background(), older.ID)
+	if err != nil {
+		t.Fatalf("ReadByID() error = %v", err)
+	}
+	assertEqual(t, older, got)
+
+	// requests are read irrespective of their status
+	latest.Status = verifier.VerStatusVerified
+	_, err = store.Update(context.Background(), latest.ID, latest)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	got, err = store.ReadByID(context.Background(), latest.ID)
+	if err != nil {
+		t.Fatalf("ReadByID() error = %v", err)
+	}
+	assertEqual(t, latest, got)
+}
+
+func testReadByIDNotFound(t *testing.T, store Store) {
+	req := NewRequest(verifier.CommTypeEmail, uniqueRecipient("read-by-id-not-found"), time.Now())
+	_, err := store.ReadByID(context.Background(), req.ID)
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+}
+
+func testUpdate(t *testing.T, store Store) {
+	req := NewRequest(verifier.CommTypeEmail, uniqueRecipient("update"), time.Now())
+	create(t, store, req)
+
+	updatedAt := req.CreatedAt.Add(time.Second)
+	req.UpdatedAt = &updatedAt
+	req.Attempts = 2
+	req.CommStatus = []verifier.CommStatus{
+		{
+			Status: "queued",
+			Data:   map[string]interface{}{"status": "message-id"},
+		},
+	}
+
+	got, err := store.Update(context.Background(), req.ID, req)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got == nil {
+		t.Fatalf("expected Update() to return the updated request")
+	}
+	assertEqual(t, req, got)
+	assertEqual(t, req, readLastPending(t, store, req.Type, req.Recipient))
+}
+
+func testUpdateNotFound(t *testing.T, store Store) {
+	req := NewRequest(verifier.CommTypeEmail, uniqueRecipient("update-not-found"), time.Now())
+	_, err := store.Update(context.Background(), req.ID, req)
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+}
+
+func testUpdateStatus(t *testing.T, store Store) {
+	recipient := uniqueRecipient("update-status")
+	now := time.Now()
+	older := NewRequest(verifier.CommTypeMobile, recipient, now.Add(-time.Minute))
+	latest := NewRequest(verifier.CommTypeMobile, recipient, now)
+	create(t, store, older, latest)
+
+	latest.Status = verifier.VerStatusVerified
+	_, err := store.Update(context.Background(), latest.ID, latest)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// a request which is not pending anymore should not be read as pending
+	assertEqual(t, older, readLastPending(t, store, verifier.CommTypeMobile, recipient))
+
+	older.Status = verifier.VerStatusRejected
+	_, err = store.Update(context.Background(), older.ID, older)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	_, err = store.ReadLastPending(context.Background(), verifier.CommTypeMobile, recipient)
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+}
+
+func testExpiry(t *testing.T, store Store) {
+	req := NewRequest(verifier.CommTypeMobile, uniqueRecipient("expiry"), time.Now().Add(-time.Hour*2))
+	create(t, store, req)
+
+	// requests with an expired secret should still be read, so that verifier can report the
+	// secret as expired; instead of reporting that there's no such request
+	assertEqual(t, req, readLastPending(t, store, req.Type, req.Recipient))
+
+	req.Status = verifier.VerStatusExpired
+	_, err := store.Update(context.Background(), req.ID, req)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	_, err = store.ReadLastPending(context.Background(), req.Type, req.Recipient)
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+}
+
+func testConcurrentUpdates(t *testing.T, store Store) {
+	const concurrency = 20
+	recipient := uniqueRecipient("concurrent")
+	now := time.Now()
+
+	reqs := make([]*verifier.Request, 0, concurrency)
+	for i := 0; i < concurrency; i++ {
+		reqs = append(reqs, NewRequest(verifier.CommTypeEmail, recipient, now.Add(time.Duration(i)*time.Millisecond)))
+	}
+
+	wg := sync.WaitGroup{}
+	for _, req := range reqs {
+		wg.Add(1)
+		go func(req *verifier.Request) {
+			defer wg.Done()
+			_, err := store.Create(context.Background(), req)
+			if err != nil {
+				t.Errorf("Create() error = %v", err)
+				return
+			}
+
+			updated := *req
+			updated.Attempts = 1
+			_, err = store.Update(context.Background(), updated.ID, &updated)
+			if err != nil {
+				t.Errorf("Update() error = %v", err)
+			}
+		}(req)
+	}
+	wg.Wait()
+
+	latest := *reqs[len(reqs)-1]
+	latest.Attempts = 1
+	assertEqual(t, &latest, readLastPending(t, store, verifier.CommTypeEmail, recipient))
+}
+
+func testIncrementAttempts(t *testing.T, store Store) {
+	req := NewRequest(verifier.CommTypeEmail, uniqueRecipient("increment"), time.Now())
+	create(t, store, req)
+
+	for i := 1; i <= 3; i++ {
+		got, err := store.IncrementAttempts(context.Background(), req.ID)
+		if err != nil {
+			t.Fatalf("IncrementAttempts() error = %v", err)
+		}
+		req.Attempts = i
+		assertEqual(t, req, got)
+	}
+
+	assertEqual(t, req, readLastPending(t, store, req.Type, req.Recipient))
+}
+
+func testIncrementAttemptsNotFound(t *testing.T, store Store) {
+	req := NewRequest(verifier.CommTypeEmail, uniqueRecipient("increment-not-found"), time.Now())
+	_, err := store.IncrementAttempts(context.Background(), req.ID)
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+}
+
+func testConcurrentIncrementAttempts(t *testing.T, store Store) {
+	const concurrency = 20
+	req := NewRequest(verifier.CommTypeMobile, uniqueRecipient("concurrent-increment"), time.Now())
+	create(t, store, req)
+
+	mu := sync.Mutex{}
+	seen := make(map[int]bool, concurrency)
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := store.IncrementAttempts(context.Background(), req.ID)
+			if err != nil {
+				t.Errorf("IncrementAttempts() error = %v", err)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			// every increment should observe a distinct count, else concurrent verifications
+			// could all pass the maximum attempts check
+			if seen[got.Attempts] {
+				t.Errorf("attempts %d returned more than once", got.Attempts)
+			}
+			seen[got.Attempts] = true
+		}()
+	}
+	wg.Wait()
+
+	req.Attempts = concurrency
+	assertEqual(t, req, readLastPending(t, store, req.Type, req.Recipient))
+}
+
+func testUpdateAttempts(t *testing.T, store Store) {
+	req := NewRequest(verifier.CommTypeEmail, uniqueRecipient("update-attempts"), time.Now())
+	create(t, store, req)
+
+	stale := *req
+	for i := 0; i < 2; i++ {
+		_, err := store.IncrementAttempts(context.Background(), req.ID)
+		if err != nil {
+			t.Fatalf("IncrementAttempts() error = %v", err)
+		}
+	}
+
+	// updating with a request read before the increments should not lose the increments
+	stale.CommStatus = []verifier.CommStatus{{Status: "sent"}}
+	_, err := store.Update(context.Background(), stale.ID, &stale)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	req.Attempts = 2
+	req.CommStatus = stale.CommStatus
+	assertEqual(t, req, readLastPending(t, store, req.Type, req.Recipient))
+}
+
+// notPendingRequest creates a request, and updates it to the status given
+func notPendingRequest(t *testing.T, store Store, name string, status func(req *verifier.Request)) *verifier.Request {
+	t.Helper()
+	req := NewRequest(verifier.CommTypeEmail, uniqueRecipient(name), time.Now())
+	create(t, store, req)
+
+	status(req)
+	_, err := store.Update(context.Background(), req.ID, req)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	return req
+}
+
+func testUpdateNotPending(t *testing.T, store Store) {
+	req := notPendingRequest(t, store, "update-not-pending", func(req *verifier.Request) {
+		req.Status = verifier.VerStatusVerified
+	})
+
+	// a verified request should not be changed, e.g. back to pending or to rejected
+	updated := *req
+	updated.Status = verifier.VerStatusPending
+	_, err := store.Update(context.Background(), updated.ID, &updated)
+	if !errors.Is(err, verifier.ErrRequestNotPending) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrRequestNotPending, err)
+	}
+
+	got, err := store.ReadByID(context.Background(), req.ID)
+	if err != nil {
+		t.Fatalf("ReadByID() error = %v", err)
+	}
+	assertEqual(t, req, got)
+}
+
+func testIncrementAttemptsNotPending(t *testing.T, store Store) {
+	req := notPendingRequest(t, store, "increment-not-pending", func(req *verifier.Request) {
+		req.Status = verifier.VerStatusCancelled
+	})
+
+	_, err := store.IncrementAttempts(context.Background(), req.ID)
+	if !errors.Is(err, verifier.ErrRequestNotPending) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrRequestNotPending, err)
+	}
+
+	got, err := store.ReadByID(context.Background(), req.ID)
+	if err != nil {
+		t.Fatalf("ReadByID() error = %v", err)
+	}
+	assertEqual(t, req, got)
+}
+
+func testConcurrentStatusUpdates(t *testing.T, store Store) {
+	const concurrency = 20
+	req := NewRequest(verifier.CommTypeMobile, uniqueRecipient("concurrent-status"), time.Now())
+	create(t, store, req)
+
+	var updated int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			update := *req
+			switch i % 3 {
+			case 0:
+				update.Status = verifier.VerStatusVerified
+			case 1:
+				update.Status = verifier.VerStatusRejected
+			default:
+				update.Status = verifier.VerStatusCancelled
+			}
+			_, err := store.Update(context.Background(), update.ID, &update)
+			if errors.Is(err, verifier.ErrRequestNotPending) {
+				return
+			}
+			if err != nil {
+				t.Errorf("Update() error = %v", err)
+				return
+			}
+			atomic.AddInt64(&updated, 1)
+		}(i)
+	}
+	wg.Wait()
+
+	// only one of the concurrent changes of status from pending should succeed
+	if updated != 1 {
+		t.Fatalf("expected 1 update to succeed, got %d", updated)
+	}
+}
+
+func testIncrementResends(t *testing.T, store Store) {
+	now := time.Now().Truncate(time.Millisecond)
+	req := NewRequest(verifier.CommTypeMobile, uniqueRecipient("resend"), now.Add(-time.Minute))
+	create(t, store, req)
+
+	stale := *req
+	tests := []struct {
+		name    string
+		now     time.Time
+		wantErr error
+	}{
+		{name: "first resend", now: now},
+		{name: "too soon", now: now.Add(time.Second * 59), wantErr: verifier.ErrResendTooSoon},
+		{name: "second resend", now: now.Add(time.Minute)},
+		{name: "maximum resends", now: now.Add(time.Minute * 2), wantErr: verifier.ErrMaximumResendsExceeded},
+	}
+	for _, tt := range tests {
+		got, err := store.IncrementResends(context.Background(), req.ID, tt.now, time.Minute, 2)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: expected error '%v', got '%v'", tt.name, tt.wantErr, err)
+		}
+		if tt.wantErr != nil {
+			continue
+		}
+		sentAt := tt.now
+		req.Resends++
+		req.LastSentAt = &sentAt
+		assertEqual(t, req, got)
+	}
+
+	// updating with a request read before the resends should not lose the resends
+	_, err := store.Update(context.Background(), stale.ID, &stale)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	assertEqual(t, req, readLastPending(t, store, req.Type, req.Recipient))
+}
+
+func testIncrementResendsNotFound(t *testing.T, store Store) {
+	req := NewRequest(verifier.CommTypeMobile, uniqueRecipient("resend-not-found"), time.Now())
+	_, err := store.IncrementResends(context.Background(), req.ID, time.Now(), 0, 1)
+	if !errors.Is(err, verifier.ErrNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrNotFound, err)
+	}
+}
+
+func testIncrementResendsNotPending(t *testing.T, store Store) {
+	req := notPendingRequest(t, store, "resend-not-pending", func(req *verifier.Request) {
+		req.Status = verifier.VerStatusVerified
+	})
+
+	_, err := store.IncrementResends(context.Background(), req.ID, time.Now(), 0, 1)
+	if !errors.Is(err, verifier.ErrRequestNotPending) {
+		t.Fatalf("expected error '%v', got '%v'", verifier.ErrRequestNotPending, err)
+	}
+}
+
+func testConcurrentIncrementResends(t *testing.T, store Store) {
+	const concurrency = 20
+	now := time.Now().Truncate(time.Millisecond)
+	req := NewRequest(verifier.CommTypeMobile, uniqueRecipient("concurrent-resend"), now.Add(-time.Minute))
+	create(t, store, req)
+
+	var resent int64
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.IncrementResends(context.Background(), req.ID, now, time.Minute, concurrency)
+			if errors.Is(err, verifier.ErrResendTooSoon) {
+				return
+			}
+			if err != nil {
+				t.Errorf("IncrementResends() error = %v", err)
+				return
+			}
+			atomic.AddInt64(&resent, 1)
+		}()
+	}
+	wg.Wait()
+
+	// only one of the concurrent resends should pass the interval
+	if resent != 1 {
+		t.Fatalf("expected 1 resend to succeed, got %d", resent)
+	}
+}
+
+func list(t *testing.T, store Store, filter *verifier.ListFilter) []*verifier.Request {
+	t.Helper()
+	got, err := store.List(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	return got
+}
+
+func assertList(t *testing.T, want, got []*verifier.Request) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d requests, got %d", len(want), len(got))
+	}
+	for i := range want {
+		assertEqual(t, want[i], got[i])
+	}
+}
+
+// newRequests creates n requests of the type & recipient, a minute apart; starting from start.
+// The requests are returned latest first
+func newRequests(t *testing.T, store Store, ctype verifier.CommType, recipient string, start time.Time, n int) []*verifier.Request {
+	t.Helper()
+	reqs := make([]*verifier.Request, n)
+	for i := 0; i < n; i++ {
+		req := NewRequest(ctype, recipient, start.Add(time.Duration(i)*time.Minute))
+		create(t, store, req)
+		reqs[n-1-i] = req
+	}
+	return reqs
+}
+
+func testListRecipient(t *testing.T, store Store) {
+	recipient := uniqueRecipient("list-recipient")
+	now := time.Now()
+	emails := newRequests(t, store, verifier.CommTypeEmail, recipient, now.Add(-time.Minute*10), 2)
+	mobiles := newRequests(t, store, verifier.CommTypeMobile, recipient, now.Add(-time.Minute*5), 2)
+	newRequests(t, store, verifier.CommTypeEmail, uniqueRecipient("list-other"), now, 1)
+
+	got := list(t, store, &verifier.ListFilter{Type: verifier.CommTypeEmail, Recipient: recipient, Limit: 10})
+	assertList(t, emails, got)
+
+	// requests of all types are listed if type is not set
+	got = list(t, store, &verifier.ListFilter{Recipient: recipient, Limit: 10})
+	assertList(t, append(mobiles, emails...), got)
+}
+
+func testListStatus(t *testing.T, store Store) {
+	recipient := uniqueRecipient("list-status")
+	reqs := newRequests(t, store, verifier.CommTypeMobile, recipient, time.Now().Add(-time.Minute*5), 3)
+
+	reqs[1].Status = verifier.VerStatusCancelled
+	_, err := store.Update(context.Background(), reqs[1].ID, reqs[1])
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	got := list(t, store, &verifier.ListFilter{
+		Recipient: recipient,
+		Status:    verifier.VerStatusCancelled,
+		Limit:     10,
+	})
+	assertList(t, reqs[1:2], got)
+
+	got = list(t, store, &verifier.ListFilter{
+		Recipient: recipient,
+		Status:    verifier.VerStatusPending,
+		Limit:     10,
+	})
+	assertList(t, []*verifier.Request{reqs[0], reqs[2]}, got)
+}
+
+func testListTimeRange(t *testing.T, store Store) {
+	// requests are listed by a recipient unique to this test, so that requests of other tests &
+	// of previous runs sharing the store (e.g. Postgres) are not listed
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	recipient := uniqueRecipient("list-time-range")
+	reqs := newRequests(t, store, verifier.CommTypeEmail, recipient, start, 4)
+
+	from := start.Add(time.Minute)
+	to := start.Add(time.Minute * 2)
+	got := list(t, store, &verifier.ListFilter{
+		Type:        verifier.CommTypeEmail,
+		Recipient:   recipient,
+		CreatedFrom: &from,
+		CreatedTo:   &to,
+		Limit:       10,
+	})
+	assertList(t, reqs[1:3], got)
+
+	got = list(t, store, &verifier.ListFilter{
+		Recipient:   recipient,
+		CreatedFrom: &from,
+		Limit:       10,
+	})
+	assertList(t, reqs[:3], got)
+
+	got = list(t, store, &verifier.ListFilter{
+		Recipient: recipient,
+		CreatedTo: &to,
+		Limit:     10,
+	})
+	assertList(t, reqs[1:], got)
+}
+
+func testListPagination(t *testing.T, store Store) {
+	recipient := uniqueRecipient("list-pagination")
+	reqs := newRequests(t, store, verifier.CommTypeEmail, recipient, time.Now().Add(-time.Minute*10), 5)
+
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		want   []*verifier.Request
+	}{
+		{name: "first page", offset: 0, limit: 2, want: reqs[0:2]},
+		{name: "second page", offset: 2, limit: 2, want: reqs[2:4]},
+		{name: "last page", offset: 4, limit: 2, want: reqs[4:]},
+		{name: "past the end", offset: 5, limit: 2, want: []*verifier.Request{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := list(t, store, &verifier.ListFilter{
+				Recipient: recipient,
+				Offset:    tt.offset,
+				Limit:     tt.limit,
+			})
+			assertList(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package stores
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// tracerName is the name of the tracer used by the stores
+const tracerName = verifier.TracerName + "/stores"
+
+// startSpan starts a client span of the store operation, as a child of the span in ctx if any
+func startSpan(ctx context.Context, tracer trace.Tracer, system, operation string) (context.Context, trace.Span) {
+	return tracer.Start(
+		ctx,
+		system+"."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", system),
+			attribute.String("db.operation.name", operation),
+		),
+	)
+}
+
+// expectedErrs are the errors which are expected results of reads & conditional updates, and are
+// not recorded as errors
+var expectedErrs = []error{
+	verifier.ErrNotFound,
+	verifier.ErrRequestNotPending,
+	verifier.ErrResendTooSoon,
+	verifier.ErrMaximumResendsExceeded,
+}
+
+// endSpan records the error if any, & ends the span. expectedErrs are not recorded as errors
+func endSpan(span trace.Span, err error) {
+	if err != nil && !isExpectedErr(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func isExpectedErr(err error) bool {
+	for _, expected := range expectedErrs {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
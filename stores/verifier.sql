@@ -5,11 +5,51 @@ CREATE TABLE IF NOT EXISTS VerificationRequests (
     sender TEXT,
     recipient TEXT,
     data jsonb,
+    locale TEXT,
     secret TEXT NOT NULL,
     secretExpiry timestamptz NOT NULL,
     attempts integer,
+    resends integer,
+    lastSentAt timestamptz,
     commStatus jsonb,
     status TEXT NOT NULL,
     createdAt timestamptz DEFAULT now(),
     updatedAt timestamptz DEFAULT now()
 );
+
+-- locale was added after the table was created, in earlier versions
+ALTER TABLE VerificationRequests ADD COLUMN IF NOT EXISTS locale TEXT;
+
+-- resends & lastSentAt were added after the table was created, in earlier versions
+ALTER TABLE VerificationRequests ADD COLUMN IF NOT EXISTS resends integer;
+ALTER TABLE VerificationRequests ADD COLUMN IF NOT EXISTS lastSentAt timestamptz;
+
+-- ReadLastPending looks up the latest request of a recipient by type & status
+CREATE INDEX IF NOT EXISTS VerificationRequestsRecipientIdx
+    ON VerificationRequests (type, recipient, status, createdAt DESC);
+
+-- most lookups are for pending requests, which are a small fraction of all the requests
+CREATE INDEX IF NOT EXISTS VerificationRequestsPendingIdx
+    ON VerificationRequests (type, recipient, createdAt DESC)
+    WHERE status = 'pending';
+
+-- List looks up requests by creation time, when not filtered by recipient
+CREATE INDEX IF NOT EXISTS VerificationRequestsCreatedAtIdx
+    ON VerificationRequests (createdAt DESC);
+
+-- SendJobs are the queued sends of the Postgres send queue, if sends are asynchronous
+CREATE TABLE IF NOT EXISTS SendJobs (
+    id TEXT PRIMARY KEY,
+    requestId TEXT NOT NULL,
+    type TEXT NOT NULL,
+    subject TEXT,
+    attempts integer NOT NULL DEFAULT 0,
+    nextAttemptAt timestamptz NOT NULL,
+    claimedUntil timestamptz,
+    lastError TEXT,
+    createdAt timestamptz DEFAULT now()
+);
+
+-- Claim looks up the due jobs, oldest first
+CREATE INDEX IF NOT EXISTS SendJobsDueIdx
+    ON SendJobs (nextAttemptAt, createdAt);
@@ -0,0 +1,342 @@
+package verifier
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Names of the templates used by verifier
+const (
+	// TemplateEmailHTML is the HTML body of verification emails
+	TemplateEmailHTML = "email.html"
+	// TemplateEmailText is the plain text alternative of the HTML body of verification emails
+	TemplateEmailText = "email.txt"
+	// TemplateEmailSubject is the subject of verification emails
+	TemplateEmailSubject = "email.subject.txt"
+	// TemplateSMS is the body of verification text messages
+	TemplateSMS = "sms.txt"
+)
+
+// ErrTemplateNotFound is the error returned when rendering a template which does not exist
+var ErrTemplateNotFound = errors.New("template not found")
+
+//go:embed templates/*
+var defaultTemplatesFS embed.FS
+
+var defaultTemplates = func() *Templates {
+	tmpls, err := ParseTemplates(defaultTemplatesFS, "templates/*")
+	if err != nil {
+		panic(err)
+	}
+	return tmpls
+}()
+
+// TemplateData is the data available to the templates
+type TemplateData struct {
+	Type      CommType
+	Recipient string
+	// Locale is the locale of the request, the templates of which are rendered
+	Locale string
+	// CallbackURL is the link to verify an email, it's empty for mobile verification
+	CallbackURL string
+	// Secret is the plain text secret, which should be used only in text messages. Emails should
+	// use CallbackURL, which has the secret
+	Secret string
+	// Expiry is the duration for which the secret is valid
+	Expiry    time.Duration
+	ExpiresAt time.Time
+	// Data is Request.Data
+	Data map[string]string
+}
+
+// Message is a rendered email
+type Message struct {
+	Subject string `json:"subject,omitempty"`
+	HTML    string `json:"html,omitempty"`
+	// Text is the plain text alternative of HTML, it's sent only if the email service supports
+	// multipart emails
+	Text string `json:"text,omitempty"`
+}
+
+// Templates are named templates, used to render the emails & text messages sent. Templates with
+// the extension '.html' are parsed using html/template, so that values are escaped as per their
+// context; all other templates are parsed using text/template. Templates are safe for concurrent use
+type Templates struct {
+	// locales are the templates of each locale (normalized), the templates of the locale "" are
+	// used if a template is not available in any of the locales looked up
+	locales map[string]*templateSet
+	// fallback is the locale looked up after the locale of the data
+	fallback string
+}
+
+type templateSet struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// newTemplateSet returns an empty set of the templates of the locale, the durations in which are
+// humanized in the language of the locale
+func newTemplateSet(locale string) *templateSet {
+	funcs := templateFuncs(locale)
+	return &templateSet{
+		html: htmltemplate.New("").Funcs(funcs),
+		text: texttemplate.New("").Funcs(funcs),
+	}
+}
+
+func (ts *templateSet) has(name string) bool {
+	if isHTMLTemplate(name) {
+		return ts.html.Lookup(name) != nil
+	}
+	return ts.text.Lookup(name) != nil
+}
+
+func (ts *templateSet) parse(name string, content []byte) error {
+	var err error
+	if isHTMLTemplate(name) {
+		_, err = ts.html.New(name).Parse(string(content))
+	} else {
+		_, err = ts.text.New(name).Parse(string(content))
+	}
+	return err
+}
+
+// lookup returns the template set with the template of the name, of the most specific locale
+// in the fallback chain of the locale
+func (tmpls *Templates) lookup(locale, name string) *templateSet {
+	for _, loc := range append(LocaleFallbacks(locale, tmpls.fallback), "") {
+		set, ok := tmpls.locales[loc]
+		if ok && set.has(name) {
+			return set
+		}
+	}
+	return nil
+}
+
+// Has returns true if there's a template of the name, for the locale or any of its fallbacks
+func (tmpls *Templates) Has(locale, name string) bool {
+	return tmpls.lookup(locale, name) != nil
+}
+
+// localized returns true if the template of the name is of the locale or any of its fallbacks,
+// and not one of the templates used for all locales
+func (tmpls *Templates) localized(locale, name string) bool {
+	set := tmpls.lookup(locale, name)
+	return set != nil && set != tmpls.locales[""]
+}
+
+// Render renders the template of the name with the data, in the locale of the data
+func (tmpls *Templates) Render(name string, data *TemplateData) (string, error) {
+	set := tmpls.lookup(data.Locale, name)
+	if set == nil {
+		return "", fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	buf := &bytes.Buffer{}
+	var err error
+	if isHTMLTemplate(name) {
+		err = set.html.ExecuteTemplate(buf, name, data)
+	} else {
+		err = set.text.ExecuteTemplate(buf, name, data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// Email renders the subject, HTML & plain text bodies of a verification email. Each of the
+// templates is optional, though there should be at least one of the bodies
+func (tmpls *Templates) Email(data *TemplateData) (*Message, error) {
+	msg := &Message{}
+	for _, part := range []struct {
+		name   string
+		result *string
+	}{
+		{name: TemplateEmailSubject, result: &msg.Subject},
+		{name: TemplateEmailHTML, result: &msg.HTML},
+		{name: TemplateEmailText, result: &msg.Text},
+	} {
+		if !tmpls.Has(data.Locale, part.name) {
+			continue
+		}
+
+		rendered, err := tmpls.Render(part.name, data)
+		if err != nil {
+			return nil, err
+		}
+		*part.result = strings.TrimSpace(rendered)
+	}
+
+	if msg.HTML == "" && msg.Text == "" {
+		return nil, fmt.Errorf("%w: %s or %s", ErrTemplateNotFound, TemplateEmailHTML, TemplateEmailText)
+	}
+
+	return msg, nil
+}
+
+// SMS renders the body of a verification text message
+func (tmpls *Templates) SMS(data *TemplateData) (string, error) {
+	return tmpls.sms(TemplateSMS, data)
+}
+
+// sms renders the body of a verification text message, using the template of the name
+func (tmpls *Templates) sms(name string, data *TemplateData) (string, error) {
+	body, err := tmpls.Render(name, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(body), nil
+}
+
+func isHTMLTemplate(name string) bool {
+	return path.Ext(name) == ".html"
+}
+
+// DefaultTemplates returns the templates used if Config.Templates is not set, which are in English
+func DefaultTemplates() *Templates {
+	return defaultTemplates
+}
+
+// ParseTemplates parses the files matching the patterns (refer fs.Glob) in fsys as templates,
+// named by their file names (e.g. 'email.html'). All files are parsed if no patterns are provided.
+// The templates are used for all locales, refer ParseLocalizedTemplates for localized templates
+func ParseTemplates(fsys fs.FS, patterns ...string) (*Templates, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+
+	set := newTemplateSet("")
+	parsed := 0
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := parseFiles(fsys, set, files)
+		if err != nil {
+			return nil, err
+		}
+		parsed += n
+	}
+
+	if parsed == 0 {
+		return nil, fmt.Errorf("%w: no files match %v", ErrTemplateNotFound, patterns)
+	}
+
+	return &Templates{locales: map[string]*templateSet{"": set}}, nil
+}
+
+// ParseLocalizedTemplates parses the templates of each locale from the directories in fsys, named
+// by the locale (e.g. 'en/email.html', 'pt/sms.txt', 'pt-BR/sms.txt'). A template is looked up in
+// the locale of the request, then the less specific locales, and then the fallback locale; e.g.
+// pt-BR, pt and en, if the fallback is 'en'. The files in the root of fsys are used for all locales,
+// if a template is not available in any of them
+func ParseLocalizedTemplates(fsys fs.FS, fallback string) (*Templates, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	tmpls := &Templates{
+		locales:  map[string]*templateSet{},
+		fallback: fallback,
+	}
+	parsed := 0
+	for _, entry := range entries {
+		dir, locale := ".", ""
+		if entry.IsDir() {
+			dir, locale = entry.Name(), normalizeLocale(entry.Name())
+		}
+		if _, ok := tmpls.locales[locale]; ok {
+			continue
+		}
+
+		files, err := fs.Glob(fsys, path.Join(dir, "*"))
+		if err != nil {
+			return nil, err
+		}
+
+		set := newTemplateSet(locale)
+		n, err := parseFiles(fsys, set, files)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			tmpls.locales[locale] = set
+			parsed += n
+		}
+	}
+
+	if parsed == 0 {
+		return nil, fmt.Errorf("%w: no templates found", ErrTemplateNotFound)
+	}
+
+	return tmpls, nil
+}
+
+// parseFiles parses the files to the set, skipping directories, and returns the number of files parsed
+func parseFiles(fsys fs.FS, set *templateSet, files []string) (int, error) {
+	parsed := 0
+	for _, file := range files {
+		info, err := fs.Stat(fsys, file)
+		if err != nil {
+			return parsed, err
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return parsed, err
+		}
+
+		err = set.parse(path.Base(file), content)
+		if err != nil {
+			return parsed, fmt.Errorf("failed parsing template %s: %w", file, err)
+		}
+		parsed++
+	}
+	return parsed, nil
+}
+
+// ParseTemplatesDir parses all the files in the directory as templates
+func ParseTemplatesDir(dir string) (*Templates, error) {
+	return ParseTemplates(os.DirFS(dir))
+}
+
+// templateData returns the data to render the templates of the request
+func (ver *Verifier) templateData(verreq *Request, callbackURL string) *TemplateData {
+	data := &TemplateData{
+		Type:        verreq.Type,
+		Recipient:   verreq.Recipient,
+		Locale:      verreq.Locale,
+		CallbackURL: callbackURL,
+		Secret:      verreq.PlainSecret(),
+		Expiry:      ver.cfg.EmailOTPExpiry,
+		Data:        verreq.Data,
+	}
+	if data.Locale == "" && ver.cfg.LocaleResolver != nil {
+		data.Locale = ver.cfg.LocaleResolver.Locale(verreq.Type, verreq.Recipient)
+	}
+	if verreq.Type == CommTypeMobile {
+		data.Expiry = ver.cfg.MobileOTPExpiry
+	}
+	if verreq.SecretExpiry != nil {
+		data.ExpiresAt = *verreq.SecretExpiry
+	}
+
+	return data
+}
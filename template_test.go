@@ -0,0 +1,280 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type mockmultipartemail struct {
+	subject  string
+	htmlBody string
+	textBody string
+}
+
+func (mme *mockmultipartemail) Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error) {
+	mme.subject, mme.htmlBody = subject, body
+	return "message-id", nil
+}
+
+func (mme *mockmultipartemail) SendMultipart(ctx context.Context, sender, recipient, subject, htmlBody, textBody string) (interface{}, error) {
+	mme.subject, mme.htmlBody, mme.textBody = subject, htmlBody, textBody
+	return "message-id", nil
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	data := &TemplateData{
+		Type:        CommTypeEmail,
+		Recipient:   "john.doe@example.com",
+		CallbackURL: "https://example.com/verify?email=john.doe%40example.com&secret=<secret>",
+		Secret:      "123456",
+		Expiry:      time.Minute * 5,
+	}
+
+	msg, err := DefaultTemplates().Email(data)
+	if err != nil {
+		t.Fatalf("Templates.Email() error = %v", err)
+	}
+	if msg.Subject != "Email verification request" {
+		t.Fatalf("expected subject 'Email verification request', got '%s'", msg.Subject)
+	}
+	if !strings.Contains(msg.HTML, "secret=%3csecret%3e") || strings.Contains(msg.HTML, "<secret>") {
+		t.Fatalf("expected the callback URL to be escaped in the HTML body, got %s", msg.HTML)
+	}
+	if !strings.Contains(msg.HTML, "5 minutes") {
+		t.Fatalf("expected expiry '5 minutes' in the HTML body, got %s", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, data.CallbackURL) {
+		t.Fatalf("expected callback URL '%s' in the text body, got %s", data.CallbackURL, msg.Text)
+	}
+
+	sms, err := DefaultTemplates().SMS(data)
+	if err != nil {
+		t.Fatalf("Templates.SMS() error = %v", err)
+	}
+	want := "123456 is the OTP to verify your mobile number. It is valid only for 5 minutes."
+	if sms != want {
+		t.Fatalf("expected '%s', got '%s'", want, sms)
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	data := &TemplateData{
+		CallbackURL: "https://example.com/verify",
+		Secret:      "123456",
+		Data:        map[string]string{"name": "John"},
+	}
+
+	tests := []struct {
+		name       string
+		files      fstest.MapFS
+		patterns   []string
+		want       *Message
+		wantSMS    string
+		wantSMSErr error
+	}{
+		{
+			name: "all templates",
+			files: fstest.MapFS{
+				"email.subject.txt": {Data: []byte("Hi {{.Data.name}}, verify your email")},
+				"email.html":        {Data: []byte(`<a href="{{.CallbackURL}}">{{.Data.name}}</a>`)},
+				"email.txt":         {Data: []byte("{{.CallbackURL}}")},
+				"sms.txt":           {Data: []byte("{{.Secret}} is your OTP\n")},
+			},
+			want: &Message{
+				Subject: "Hi John, verify your email",
+				HTML:    `<a href="https://example.com/verify">John</a>`,
+				Text:    "https://example.com/verify",
+			},
+			wantSMS: "123456 is your OTP",
+		},
+		{
+			name: "text only email",
+			files: fstest.MapFS{
+				"email.txt": {Data: []byte("{{.CallbackURL}}")},
+			},
+			want:       &Message{Text: "https://example.com/verify"},
+			wantSMSErr: ErrTemplateNotFound,
+		},
+		{
+			name: "patterns",
+			files: fstest.MapFS{
+				"en/email.html": {Data: []byte("{{.CallbackURL}}")},
+				"fr/email.html": {Data: []byte("fr {{.CallbackURL}}")},
+			},
+			patterns:   []string{"fr/*"},
+			want:       &Message{HTML: "fr https://example.com/verify"},
+			wantSMSErr: ErrTemplateNotFound,
+		},
+		{
+			name: "no email templates",
+			files: fstest.MapFS{
+				"sms.txt": {Data: []byte("{{.Secret}}")},
+			},
+			wantSMS: "123456",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpls, err := ParseTemplates(tt.files, tt.patterns...)
+			if err != nil {
+				t.Fatalf("ParseTemplates() error = %v", err)
+			}
+
+			msg, err := tmpls.Email(data)
+			if tt.want == nil {
+				if !errors.Is(err, ErrTemplateNotFound) {
+					t.Fatalf("expected error '%v', got '%v'", ErrTemplateNotFound, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Templates.Email() error = %v", err)
+				}
+				if *msg != *tt.want {
+					t.Fatalf("expected %+v, got %+v", tt.want, msg)
+				}
+			}
+
+			sms, err := tmpls.SMS(data)
+			if tt.wantSMSErr != nil {
+				if !errors.Is(err, tt.wantSMSErr) {
+					t.Fatalf("expected error '%v', got '%v'", tt.wantSMSErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Templates.SMS() error = %v", err)
+			}
+			if sms != tt.wantSMS {
+				t.Fatalf("expected '%s', got '%s'", tt.wantSMS, sms)
+			}
+		})
+	}
+}
+
+func TestParseTemplates_errors(t *testing.T) {
+	_, err := ParseTemplates(fstest.MapFS{})
+	if !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("expected error '%v', got '%v'", ErrTemplateNotFound, err)
+	}
+
+	_, err = ParseTemplates(fstest.MapFS{"email.html": {Data: []byte("{{.CallbackURL")}})
+	if err == nil {
+		t.Fatalf("expected error parsing an invalid template")
+	}
+}
+
+func TestParseTemplatesDir(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "sms.txt"), []byte("Your OTP is {{.Secret}}"), 0o600)
+	if err != nil {
+		t.Fatalf("failed writing template: %v", err)
+	}
+
+	tmpls, err := ParseTemplatesDir(dir)
+	if err != nil {
+		t.Fatalf("ParseTemplatesDir() error = %v", err)
+	}
+	sms, err := tmpls.SMS(&TemplateData{Secret: "123456"})
+	if err != nil {
+		t.Fatalf("Templates.SMS() error = %v", err)
+	}
+	if sms != "Your OTP is 123456" {
+		t.Fatalf("expected 'Your OTP is 123456', got '%s'", sms)
+	}
+}
+
+func TestVerifier_templates(t *testing.T) {
+	tmpls, err := ParseTemplates(fstest.MapFS{
+		"email.subject.txt": {Data: []byte("Verify your email")},
+		"email.html":        {Data: []byte(`<a href="{{.CallbackURL}}">verify</a> {{.Data.source}}`)},
+		"email.txt":         {Data: []byte("{{.CallbackURL}} {{.Data.source}}")},
+		"sms.txt":           {Data: []byte("OTP {{.Secret}}, valid for {{.Expiry}}")},
+	})
+	if err != nil {
+		t.Fatalf("ParseTemplates() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		defaultSubject string
+		subject        string
+		wantSubject    string
+	}{
+		{
+			name:        "template subject",
+			wantSubject: "Verify your email",
+		},
+		{
+			name:           "default subject",
+			defaultSubject: "Welcome",
+			wantSubject:    "Welcome",
+		},
+		{
+			name:           "subject",
+			defaultSubject: "Welcome",
+			subject:        "Verify",
+			wantSubject:    "Verify",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := &mockmultipartemail{}
+			mobile := &mockmobile{}
+			verstore := &mockstore{data: map[string]*Request{}}
+			ver, err := New(
+				&Config{
+					EmailOTPExpiry:   time.Minute,
+					MobileOTPExpiry:  time.Minute * 2,
+					EmailCallbackURL: "https://example.com/verify",
+					DefaultEmailSub:  tt.defaultSubject,
+					Templates:        tmpls,
+				},
+				verstore,
+				email,
+				mobile,
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			recipient := "john.doe@example.com"
+			verreq, err := ver.NewRequest(CommTypeEmail, recipient)
+			if err != nil {
+				t.Fatalf("Verifier.NewRequest() error = %v", err)
+			}
+			verreq.Data = map[string]string{"source": "signup"}
+			err = ver.sendEmail(context.Background(), verreq, tt.subject)
+			if err != nil {
+				t.Fatalf("Verifier.sendEmail() error = %v", err)
+			}
+
+			if email.subject != tt.wantSubject {
+				t.Fatalf("expected subject '%s', got '%s'", tt.wantSubject, email.subject)
+			}
+			if !strings.HasPrefix(email.htmlBody, `<a href="https://example.com/verify?`) ||
+				!strings.HasSuffix(email.htmlBody, "signup") {
+				t.Fatalf("unexpected HTML body %s", email.htmlBody)
+			}
+			if !strings.HasPrefix(email.textBody, "https://example.com/verify?") ||
+				!strings.HasSuffix(email.textBody, "signup") {
+				t.Fatalf("unexpected text body %s", email.textBody)
+			}
+
+			err = ver.NewMobile("+919876543210")
+			if err != nil {
+				t.Fatalf("Verifier.NewMobile() error = %v", err)
+			}
+			mobreq := verstore.data["mobile-+919876543210"]
+			want := "OTP " + mobreq.Secret + ", valid for 2m0s"
+			if mobile.body != want {
+				t.Fatalf("expected '%s', got '%s'", want, mobile.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer used by verifier, and the prefix of the tracers used by
+// the stores & providers in this module
+const TracerName = "github.com/naughtygopher/verifier"
+
+// Span attributes set by verifier, stores & providers
+const (
+	AttrCommType  = attribute.Key("verifier.comm_type")
+	AttrProvider  = attribute.Key("verifier.provider")
+	AttrOutcome   = attribute.Key("verifier.outcome")
+	AttrRecipient = attribute.Key("verifier.recipient")
+	AttrRequestID = attribute.Key("verifier.request_id")
+)
+
+const (
+	outcomeSuccess     = "success"
+	outcomeError       = "error"
+	outcomeNotFound    = "not-found"
+	outcomeNotPending  = "not-pending"
+	outcomeRateLimited = "rate-limited"
+	// outcomeResendDenied is the outcome of a resend which is too soon, or exceeds the maximum resends
+	outcomeResendDenied = "resend-denied"
+)
+
+// expectedOutcomes are the outcomes which are not errors of the service, e.g. an invalid secret
+var expectedOutcomes = map[string]bool{
+	outcomeNotFound:               true,
+	outcomeNotPending:             true,
+	outcomeRateLimited:            true,
+	outcomeResendDenied:           true,
+	string(EventRejected):         true,
+	string(EventExpired):          true,
+	string(EventAttemptsExceeded): true,
+}
+
+// Tracer returns the tracer of the provider, or of the global tracer provider if it's nil
+func Tracer(tp trace.TracerProvider, name string) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(name)
+}
+
+// RedactRecipient masks an email address or mobile number so that it can be logged or traced.
+// e.g. "john.doe@example.com" is redacted as "j***@example.com", and "+919876543210" as
+// "+91******3210"
+func RedactRecipient(recipient string) string {
+	if recipient == "" {
+		return ""
+	}
+
+	if at := strings.LastIndex(recipient, "@"); at >= 0 {
+		if at == 0 {
+			return "***" + recipient[at:]
+		}
+		return recipient[:1] + "***" + recipient[at:]
+	}
+
+	const visible = 4
+	if len(recipient) <= visible {
+		return strings.Repeat("*", len(recipient))
+	}
+
+	prefix := CountryCallingCode(recipient)
+	masked := len(recipient) - len(prefix) - visible
+	if masked < 0 {
+		prefix, masked = "", len(recipient)-visible
+	}
+	return prefix + strings.Repeat("*", masked) + recipient[len(recipient)-visible:]
+}
+
+// startSpan starts a span of the verifier, with the communication type & redacted recipient
+func (ver *Verifier) startSpan(ctx context.Context, name string, ctype CommType, recipient string) (context.Context, trace.Span) {
+	attrs := make([]attribute.KeyValue, 0, 2)
+	if ctype != "" {
+		attrs = append(attrs, AttrCommType.String(string(ctype)))
+	}
+	if recipient != "" {
+		attrs = append(attrs, AttrRecipient.String(RedactRecipient(recipient)))
+	}
+	return ver.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// startSendSpan starts the span of sending the secret of the request using the provider
+func (ver *Verifier) startSendSpan(ctx context.Context, verreq *Request, provider interface{}) (context.Context, trace.Span) {
+	ctx, span := ver.startSpan(ctx, "verifier.Send", verreq.Type, verreq.Recipient)
+	span.SetAttributes(
+		AttrProvider.String(providerName(provider)),
+		AttrRequestID.String(verreq.ID),
+	)
+	return ctx, span
+}
+
+// endSpan sets the outcome & ends the span. The span's status is set to error only if the outcome
+// is not expected, e.g. a rejected secret is recorded but is not an error
+func endSpan(span trace.Span, outcome string, err error) {
+	span.SetAttributes(AttrOutcome.String(outcome))
+	if err != nil {
+		span.RecordError(err)
+		if !expectedOutcomes[outcome] {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+// verificationOutcome returns the outcome of a verification, from the error returned
+func verificationOutcome(err error) string {
+	switch {
+	case err == nil:
+		return string(EventVerified)
+	case errors.Is(err, ErrInvalidSecret):
+		return string(EventRejected)
+	case errors.Is(err, ErrSecretExpired):
+		return string(EventExpired)
+	case errors.Is(err, ErrMaximumAttemptsExceeded):
+		return string(EventAttemptsExceeded)
+	case errors.Is(err, ErrNotFound):
+		return outcomeNotFound
+	}
+	return outcomeError
+}
+
+// outcome returns the outcome of an operation other than verification, from the error returned
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, ErrNotFound):
+		return outcomeNotFound
+	case errors.Is(err, ErrRequestNotPending):
+		return outcomeNotPending
+	case errors.Is(err, ErrRateLimited):
+		return outcomeRateLimited
+	case errors.Is(err, ErrResendTooSoon), errors.Is(err, ErrMaximumResendsExceeded):
+		return outcomeResendDenied
+	}
+	return outcomeError
+}
@@ -0,0 +1,116 @@
+package verifier
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRedactRecipient(t *testing.T) {
+	tests := []struct {
+		name      string
+		recipient string
+		want      string
+	}{
+		{name: "email", recipient: "john.doe@example.com", want: "j***@example.com"},
+		{name: "email without local part", recipient: "@example.com", want: "***@example.com"},
+		{name: "mobile", recipient: "+919876543210", want: "+91******3210"},
+		{name: "mobile without calling code", recipient: "9876543210", want: "******3210"},
+		{name: "short", recipient: "123", want: "***"},
+		{name: "empty", recipient: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactRecipient(tt.recipient); got != tt.want {
+				t.Fatalf("expected '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestVerifier_tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	recipient := "+919876543210"
+	ver, err := New(
+		&Config{MobileOTPExpiry: time.Minute, TracerProvider: tp},
+		&mockstore{data: map[string]*Request{}},
+		nil,
+		&mockmobile{},
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	ctx := context.Background()
+	err = ver.NewMobileContext(ctx, recipient)
+	if err != nil {
+		t.Fatalf("Verifier.NewMobileContext() error = %v", err)
+	}
+	_ = ver.VerifyMobileSecretContext(ctx, recipient, "wrong")
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+		for _, attr := range span.Attributes() {
+			if strings.Contains(attr.Value.Emit(), recipient) {
+				t.Fatalf("span '%s' has the recipient unredacted in '%s'", span.Name(), attr.Key)
+			}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		parent      string
+		wantOutcome string
+		wantStatus  codes.Code
+	}{
+		{name: "verifier.NewRequest", wantOutcome: "success"},
+		{name: "verifier.store.create", parent: "verifier.NewRequest", wantOutcome: "success"},
+		{name: "verifier.Send", wantOutcome: "success"},
+		{name: "verifier.VerifySecret", wantOutcome: string(EventRejected), wantStatus: codes.Unset},
+		{name: "verifier.store.read_last_pending", parent: "verifier.VerifySecret", wantOutcome: "success"},
+		{name: "verifier.store.increment_attempts", parent: "verifier.VerifySecret", wantOutcome: "success"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, ok := spans[tt.name]
+			if !ok {
+				t.Fatalf("span '%s' not found", tt.name)
+			}
+
+			if tt.parent != "" && span.Parent().SpanID() != spans[tt.parent].SpanContext().SpanID() {
+				t.Fatalf("expected span '%s' to be a child of '%s'", tt.name, tt.parent)
+			}
+
+			attrs := map[string]string{}
+			for _, attr := range span.Attributes() {
+				attrs[string(attr.Key)] = attr.Value.Emit()
+			}
+			if attrs[string(AttrOutcome)] != tt.wantOutcome {
+				t.Fatalf("expected outcome '%s', got '%s'", tt.wantOutcome, attrs[string(AttrOutcome)])
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Fatalf("expected status '%v', got '%v'", tt.wantStatus, span.Status().Code)
+			}
+		})
+	}
+
+	send := spans["verifier.Send"]
+	attrs := map[string]string{}
+	for _, attr := range send.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs[string(AttrProvider)] != "custom" || attrs[string(AttrCommType)] != string(CommTypeMobile) {
+		t.Fatalf("expected provider 'custom' & comm type 'mobile', got %v", attrs)
+	}
+	if attrs[string(AttrRecipient)] != RedactRecipient(recipient) {
+		t.Fatalf("expected recipient '%s', got '%s'", RedactRecipient(recipient), attrs[string(AttrRecipient)])
+	}
+}
@@ -0,0 +1,75 @@
+package twilio
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrInvalidRecipient is the error returned if the recipient is not a valid mobile number, or
+	// cannot receive text messages
+	ErrInvalidRecipient = errors.New("invalid recipient")
+	// ErrInvalidSender is the error returned if the sender (From) is not a valid, text message
+	// capable number of the account
+	ErrInvalidSender = errors.New("invalid sender")
+	// ErrUnsubscribed is the error returned if the recipient has opted out of messages from the sender
+	ErrUnsubscribed = errors.New("recipient unsubscribed")
+	// ErrRegionNotPermitted is the error returned if the account is not permitted to send messages
+	// to the country of the recipient
+	ErrRegionNotPermitted = errors.New("region not permitted")
+	// ErrAuthentication is the error returned if the credentials are invalid
+	ErrAuthentication = errors.New("authentication failed")
+	// ErrRateLimited is the error returned if the requests or messages are being rate limited
+	ErrRateLimited = errors.New("rate limited")
+	// ErrQueueFull is the error returned if the message queue of the sender is full
+	ErrQueueFull = errors.New("message queue full")
+)
+
+// errorCodes maps the Twilio error codes to the typed errors,
+// refer https://www.twilio.com/docs/api/errors
+var errorCodes = map[int]error{
+	20003: ErrAuthentication,
+	20429: ErrRateLimited,
+	14107: ErrRateLimited,
+	21211: ErrInvalidRecipient,
+	21614: ErrInvalidRecipient,
+	21265: ErrInvalidRecipient,
+	21212: ErrInvalidSender,
+	21606: ErrInvalidSender,
+	21659: ErrInvalidSender,
+	21610: ErrUnsubscribed,
+	21408: ErrRegionNotPermitted,
+	21612: ErrRegionNotPermitted,
+	21611: ErrQueueFull,
+}
+
+// Error is an error responded by the Twilio API
+type Error struct {
+	// Code is the Twilio error code, e.g. 21211
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	MoreInfo string `json:"more_info"`
+	// Status is the HTTP status code of the response
+	Status int `json:"status"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("twilio error %d (HTTP %d): %s", e.Code, e.Status, e.Message)
+}
+
+// Unwrap returns the typed error of the code (e.g. ErrInvalidRecipient), so that it can be
+// checked using errors.Is
+func (e *Error) Unwrap() error {
+	return errorCodes[e.Code]
+}
+
+// Retryable returns true if the message might be sent if retried, e.g. after being rate limited or
+// a server error. Errors such as an invalid recipient are not retryable
+func (e *Error) Retryable() bool {
+	switch errorCodes[e.Code] {
+	case ErrRateLimited, ErrQueueFull:
+		return true
+	}
+	return e.Status == http.StatusTooManyRequests || e.Status >= http.StatusInternalServerError
+}
@@ -0,0 +1,194 @@
+// Package twilio sends verification text messages using the Twilio Programmable Messaging API, or
+// any API compatible with it
+package twilio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// DefaultBaseURL is the base URL of the Twilio REST API
+const DefaultBaseURL = "https://api.twilio.com"
+
+// maxResponseSize is the maximum size of the responses read
+const maxResponseSize = 1 << 20
+
+// Config holds all the configurations required to send text messages using Twilio
+type Config struct {
+	AccountSID string
+	// AuthToken is the auth token of the account, or the secret of the API key if APIKeySID is set
+	AuthToken string
+	// APIKeySID is used to authenticate instead of the account SID, if set
+	APIKeySID string
+
+	// From is the phone number or alphanumeric sender ID of the messages sent. It's optional if
+	// MessagingServiceSID is set, in which case the sender is chosen by the messaging service. The
+	// sender ID set in the context using verifier.WithSenderID is used instead, if set
+	From                string
+	MessagingServiceSID string
+	// StatusCallbackURL is called by Twilio with the delivery status of every message sent
+	StatusCallbackURL string
+
+	// BaseURL is DefaultBaseURL if not set, it can be set to any Twilio compatible API
+	BaseURL    string
+	HTTPClient *http.Client
+	// TracerProvider is used to trace the API calls, the global tracer provider is used if not set
+	TracerProvider trace.TracerProvider
+}
+
+// Message is the message resource responded by Twilio, when a message is queued to be sent
+type Message struct {
+	SID                 string `json:"sid,omitempty"`
+	Status              string `json:"status,omitempty"`
+	To                  string `json:"to,omitempty"`
+	From                string `json:"from,omitempty"`
+	MessagingServiceSID string `json:"messaging_service_sid,omitempty"`
+	NumSegments         string `json:"num_segments,omitempty"`
+	ErrorCode           *int   `json:"error_code,omitempty"`
+	ErrorMessage        string `json:"error_message,omitempty"`
+}
+
+// Twilio sends text messages using Twilio, it's safe for concurrent use
+type Twilio struct {
+	cfg      *Config
+	endpoint string
+	client   *http.Client
+	tracer   trace.Tracer
+}
+
+// Name returns the name of the provider, used in metrics
+func (tw *Twilio) Name() string {
+	return "twilio"
+}
+
+// Send sends a text message, and returns the *Message queued. Errors responded by Twilio are of
+// type *Error, which can be checked for the typed errors (e.g. ErrInvalidRecipient) using errors.Is
+func (tw *Twilio) Send(ctx context.Context, recipient, body string) (_ interface{}, err error) {
+	ctx, span := tw.tracer.Start(
+		ctx,
+		"twilio.CreateMessage",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			verifier.AttrProvider.String(tw.Name()),
+			verifier.AttrRecipient.String(verifier.RedactRecipient(recipient)),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	form := url.Values{
+		"To":   {recipient},
+		"Body": {body},
+	}
+	from := tw.cfg.From
+	if senderID := verifier.SenderIDFromContext(ctx); senderID != "" {
+		from = senderID
+	}
+	if from != "" {
+		form.Set("From", from)
+	}
+	if tw.cfg.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", tw.cfg.MessagingServiceSID)
+	}
+	if tw.cfg.StatusCallbackURL != "" {
+		form.Set("StatusCallback", tw.cfg.StatusCallbackURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tw.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	username := tw.cfg.AccountSID
+	if tw.cfg.APIKeySID != "" {
+		username = tw.cfg.APIKeySID
+	}
+	req.SetBasicAuth(username, tw.cfg.AuthToken)
+
+	resp, err := tw.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, parseError(resp.StatusCode, payload)
+	}
+
+	msg := &Message{}
+	err = json.Unmarshal(payload, msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding twilio response: %w", err)
+	}
+
+	return msg, nil
+}
+
+// parseError returns the error responded, or an error with the HTTP status if the response could
+// not be decoded (e.g. a proxy's error page)
+func parseError(status int, payload []byte) error {
+	twerr := &Error{}
+	err := json.Unmarshal(payload, twerr)
+	if err != nil || twerr.Message == "" {
+		twerr = &Error{Message: http.StatusText(status)}
+	}
+	twerr.Status = status
+	return twerr
+}
+
+// NewService returns an instance of Twilio
+func NewService(cfg *Config) (*Twilio, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" {
+		return nil, errors.New("twilio account SID & auth token are required")
+	}
+
+	if cfg.From == "" && cfg.MessagingServiceSID == "" {
+		return nil, errors.New("either of twilio sender (From) or messaging service SID is required")
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 10}
+	}
+
+	return &Twilio{
+		cfg: cfg,
+		endpoint: fmt.Sprintf(
+			"%s/2010-04-01/Accounts/%s/Messages.json",
+			strings.TrimSuffix(baseURL, "/"),
+			url.PathEscape(cfg.AccountSID),
+		),
+		client: client,
+		tracer: verifier.Tracer(cfg.TracerProvider, verifier.TracerName+"/twilio"),
+	}, nil
+}
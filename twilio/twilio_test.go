@@ -0,0 +1,241 @@
+package twilio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/naughtygopher/verifier"
+)
+
+// newTestAPI returns a stand-in of the Twilio Messages API, which responds with status & body.
+// The form of the last request is sent to forms
+func newTestAPI(t *testing.T, status int, body string) (*httptest.Server, chan url.Values) {
+	t.Helper()
+	forms := make(chan url.Values, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+			http.NotFound(w, r)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "AC123" || password != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"code": 20003, "message": "Authenticate", "status": 401}`)
+			return
+		}
+
+		err := r.ParseForm()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		forms <- r.PostForm
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, forms
+}
+
+func TestTwilio_Send(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		senderID string
+		wantForm url.Values
+	}{
+		{
+			name: "from",
+			cfg:  Config{From: "+15005550006"},
+			wantForm: url.Values{
+				"To":   {"+919876543210"},
+				"Body": {"123456 is your OTP"},
+				"From": {"+15005550006"},
+			},
+		},
+		{
+			name:     "sender ID from context",
+			cfg:      Config{From: "+15005550006"},
+			senderID: "VERIFY",
+			wantForm: url.Values{
+				"To":   {"+919876543210"},
+				"Body": {"123456 is your OTP"},
+				"From": {"VERIFY"},
+			},
+		},
+		{
+			name: "messaging service with status callback",
+			cfg: Config{
+				MessagingServiceSID: "MG123",
+				StatusCallbackURL:   "https://example.com/twilio/status",
+			},
+			wantForm: url.Values{
+				"To":                  {"+919876543210"},
+				"Body":                {"123456 is your OTP"},
+				"MessagingServiceSid": {"MG123"},
+				"StatusCallback":      {"https://example.com/twilio/status"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, forms := newTestAPI(t, http.StatusCreated, `{"sid": "SM123", "status": "queued", "to": "+919876543210"}`)
+			cfg := tt.cfg
+			cfg.AccountSID = "AC123"
+			cfg.AuthToken = "token"
+			cfg.BaseURL = srv.URL
+			tw, err := NewService(&cfg)
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+
+			ctx := context.Background()
+			if tt.senderID != "" {
+				ctx = verifier.WithSenderID(ctx, tt.senderID)
+			}
+			got, err := tw.Send(ctx, "+919876543210", "123456 is your OTP")
+			if err != nil {
+				t.Fatalf("Twilio.Send() error = %v", err)
+			}
+
+			msg, ok := got.(*Message)
+			if !ok || msg.SID != "SM123" || msg.Status != "queued" {
+				t.Fatalf("expected queued message SM123, got %+v", got)
+			}
+
+			form := <-forms
+			if len(form) != len(tt.wantForm) {
+				t.Fatalf("expected form %v, got %v", tt.wantForm, form)
+			}
+			for key := range tt.wantForm {
+				if form.Get(key) != tt.wantForm.Get(key) {
+					t.Fatalf("expected %s '%s', got '%s'", key, tt.wantForm.Get(key), form.Get(key))
+				}
+			}
+		})
+	}
+}
+
+func TestTwilio_errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		authToken     string
+		status        int
+		body          string
+		wantErr       error
+		wantCode      int
+		wantRetryable bool
+	}{
+		{
+			name:     "invalid recipient",
+			status:   http.StatusBadRequest,
+			body:     `{"code": 21211, "message": "The 'To' number is not a valid phone number.", "more_info": "https://www.twilio.com/docs/errors/21211", "status": 400}`,
+			wantErr:  ErrInvalidRecipient,
+			wantCode: 21211,
+		},
+		{
+			name:     "unsubscribed",
+			status:   http.StatusBadRequest,
+			body:     `{"code": 21610, "message": "Attempt to send to unsubscribed recipient", "status": 400}`,
+			wantErr:  ErrUnsubscribed,
+			wantCode: 21610,
+		},
+		{
+			name:     "region not permitted",
+			status:   http.StatusBadRequest,
+			body:     `{"code": 21408, "message": "Permission to send an SMS has not been enabled for the region", "status": 400}`,
+			wantErr:  ErrRegionNotPermitted,
+			wantCode: 21408,
+		},
+		{
+			name:          "rate limited",
+			status:        http.StatusTooManyRequests,
+			body:          `{"code": 20429, "message": "Too Many Requests", "status": 429}`,
+			wantErr:       ErrRateLimited,
+			wantCode:      20429,
+			wantRetryable: true,
+		},
+		{
+			name:          "queue full",
+			status:        http.StatusBadRequest,
+			body:          `{"code": 21611, "message": "This 'From' number has exceeded the maximum number of queued messages", "status": 400}`,
+			wantErr:       ErrQueueFull,
+			wantCode:      21611,
+			wantRetryable: true,
+		},
+		{
+			name:          "server error without a body",
+			status:        http.StatusBadGateway,
+			body:          `<html>bad gateway</html>`,
+			wantRetryable: true,
+		},
+		{
+			name:      "authentication",
+			authToken: "wrong",
+			wantErr:   ErrAuthentication,
+			wantCode:  20003,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newTestAPI(t, tt.status, tt.body)
+			authToken := tt.authToken
+			if authToken == "" {
+				authToken = "token"
+			}
+			tw, err := NewService(&Config{
+				AccountSID: "AC123",
+				AuthToken:  authToken,
+				From:       "+15005550006",
+				BaseURL:    srv.URL,
+			})
+			if err != nil {
+				t.Fatalf("NewService() error = %v", err)
+			}
+
+			_, err = tw.Send(context.Background(), "+919876543210", "123456 is your OTP")
+			twerr := &Error{}
+			if !errors.As(err, &twerr) {
+				t.Fatalf("expected error of type *Error, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+			if twerr.Code != tt.wantCode {
+				t.Fatalf("expected code %d, got %d", tt.wantCode, twerr.Code)
+			}
+			if twerr.Retryable() != tt.wantRetryable {
+				t.Fatalf("expected retryable %v, got %v", tt.wantRetryable, twerr.Retryable())
+			}
+		})
+	}
+}
+
+func TestNewService(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr bool
+	}{
+		{name: "valid", cfg: &Config{AccountSID: "AC123", AuthToken: "token", From: "+15005550006"}},
+		{name: "no credentials", cfg: &Config{From: "+15005550006"}, wantErr: true},
+		{name: "no sender", cfg: &Config{AccountSID: "AC123", AuthToken: "token"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewService(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
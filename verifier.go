@@ -2,8 +2,14 @@
 package verifier
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
+	"log/slog"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -22,6 +28,8 @@ const (
 	VerStatusRejected = verificationStatus("rejected")
 	// VerStatusExceededAttempts verification status when attempts are exceeded
 	VerStatusExceededAttempts = verificationStatus("exceeded-attempts")
+	// VerStatusCancelled verification status when the request is cancelled
+	VerStatusCancelled = verificationStatus("cancelled")
 )
 
 var (
@@ -39,8 +47,42 @@ var (
 	ErrEmptyEmailBody = errors.New("empty email body")
 	// ErrEmptyMobileMessageBody is the error returned when using custom mobile message body and it's empty
 	ErrEmptyMobileMessageBody = errors.New("empty mobile message body")
+	// ErrNotFound is the error returned by stores when no matching verification request exists
+	ErrNotFound = errors.New("verification request not found")
+	// ErrInvalidSecretHash is the error returned when the hashed secret in the store could not be parsed
+	ErrInvalidSecretHash = errors.New("invalid secret hash")
+	// ErrEmptyPepper is the error returned when an HMAC hasher is initialized without a pepper
+	ErrEmptyPepper = errors.New("empty pepper")
+	// ErrVerificationFailed is the error returned for all failed verifications, instead of the
+	// specific reason, when Config.OpaqueErrors is enabled
+	ErrVerificationFailed = errors.New("verification failed")
+	// ErrResendTooSoon is the error returned when a resend is requested before Config.ResendInterval
+	// has elapsed since the secret was last sent
+	ErrResendTooSoon = errors.New("resend requested too soon")
+	// ErrMaximumResendsExceeded is the error returned when the secret has already been resent
+	// Config.MaxResends times
+	ErrMaximumResendsExceeded = errors.New("maximum resends exceeded")
+	// ErrRequestNotPending is the error returned when cancelling a verification request which is
+	// not pending, and by stores when updating a request which is not pending
+	ErrRequestNotPending = errors.New("verification request is not pending")
 )
 
+const (
+	// DefaultResendInterval is the minimum interval between sends of a secret, if
+	// Config.ResendInterval is not set
+	DefaultResendInterval = time.Second * 30
+	// DefaultMaxResends is the maximum number of resends of a verification request, if
+	// Config.MaxResends is not set
+	DefaultMaxResends = 3
+	// DefaultListLimit is the number of requests listed, if ListFilter.Limit is not set
+	DefaultListLimit = 20
+	// MaxListLimit is the maximum number of requests listed at once
+	MaxListLimit = 100
+)
+
+// defaultEmailSubject is the subject of emails, if neither set nor configured nor rendered
+const defaultEmailSubject = "Email verification request"
+
 // CommType defines the communication type (mobile, Email)
 type CommType string
 
@@ -50,22 +92,83 @@ type verificationStatus string
 type emailService interface {
 	// the interface returned is expected to be a reference ID for the communication sent
 	// This might be a single ref ID or more info based on the service we're using
-	Send(sender, recipient, subject, body string) (interface{}, error)
+	Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error)
+}
+
+// multipartEmailService is an email service which can send an HTML body along with its plain
+// text alternative. It's optional, & is used only if the email has a plain text body
+type multipartEmailService interface {
+	SendMultipart(ctx context.Context, sender, recipient, subject, htmlBody, textBody string) (interface{}, error)
 }
 
 type mobileService interface {
 	// the interface returned is expected to be a reference ID for the communication sent
 	// This might be a single ref ID or more info based on the service we're using
-	Send(recipient, body string) (interface{}, error)
+	Send(ctx context.Context, recipient, body string) (interface{}, error)
 }
+
 type store interface {
-	Create(ver *Request) (*Request, error)
-	ReadLastPending(ctype CommType, recipient string) (*Request, error)
-	Update(verID string, ver *Request) (*Request, error)
+	Create(ctx context.Context, ver *Request) (*Request, error)
+	ReadLastPending(ctx context.Context, ctype CommType, recipient string) (*Request, error)
+	// ReadByID reads the request of the given ID, irrespective of its status
+	ReadByID(ctx context.Context, verID string) (*Request, error)
+	// Update updates the request, though the attempts are never decreased; since attempts might
+	// have been incremented concurrently, after the request being updated was read. Only pending
+	// requests are updated, ErrRequestNotPending is returned otherwise; so that a change of status
+	// from pending (e.g. verified, cancelled) is a compare-and-set, and concurrent changes do not
+	// overwrite each other
+	Update(ctx context.Context, verID string, ver *Request) (*Request, error)
+	// IncrementAttempts atomically increments the verification attempts of a pending request, and
+	// returns the updated request. ErrRequestNotPending is returned if the request is not pending
+	IncrementAttempts(ctx context.Context, verID string) (*Request, error)
+	// IncrementResends atomically increments the resends of the request & sets its LastSentAt to
+	// now, if Request.CheckResend allows it; so that concurrent resends cannot exceed the maximum
+	// resends or the interval. The error of CheckResend is returned otherwise. Like attempts, Update
+	// should never decrease the resends or LastSentAt
+	IncrementResends(ctx context.Context, verID string, now time.Time, interval time.Duration, maxResends int) (*Request, error)
+	// List returns the requests matching the filter, latest first
+	List(ctx context.Context, filter *ListFilter) ([]*Request, error)
 }
 
-func newID() string {
-	return randomString(32)
+// ListFilter is used to filter & paginate the verification requests listed. Filters which are not
+// set are not applied
+type ListFilter struct {
+	Type      CommType           `json:"type,omitempty"`
+	Recipient string             `json:"recipient,omitempty"`
+	Status    verificationStatus `json:"status,omitempty"`
+	// CreatedFrom & CreatedTo are the inclusive bounds of the creation time of the requests
+	CreatedFrom *time.Time `json:"createdFrom,omitempty"`
+	CreatedTo   *time.Time `json:"createdTo,omitempty"`
+
+	// Limit is the maximum number of requests returned, DefaultListLimit is used if not set
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
+}
+
+// Match reports whether the request matches all the filters, it's meant to be used by stores
+// which cannot filter the requests in the query
+func (lf *ListFilter) Match(req *Request) bool {
+	if lf.Type != "" && req.Type != lf.Type {
+		return false
+	}
+	if lf.Recipient != "" && req.Recipient != lf.Recipient {
+		return false
+	}
+	if lf.Status != "" && req.Status != lf.Status {
+		return false
+	}
+
+	if req.CreatedAt == nil {
+		return lf.CreatedFrom == nil && lf.CreatedTo == nil
+	}
+	if lf.CreatedFrom != nil && req.CreatedAt.Before(*lf.CreatedFrom) {
+		return false
+	}
+	if lf.CreatedTo != nil && req.CreatedAt.After(*lf.CreatedTo) {
+		return false
+	}
+
+	return true
 }
 
 // Config has all the configurations required for verifier package to function
@@ -82,50 +185,216 @@ type Config struct {
 	   Two query string attributes are added to the callback URL while sending the verification link.
 	   1) 'email' - The email address to which verification mail was sent
 	   2) 'secret' - The secret generated for the email, this is required while verification
+	   If EmailCallbackWithID is enabled, 'id' - the ID of the verification request, is added
+	   instead of 'email'; and the request is expected to be verified using VerifyByID
 	*/
 	EmailCallbackURL string `json:"emailCallbackURL,omitempty"`
+	// EmailCallbackWithID if enabled, adds the ID of the verification request to the callback URL
+	// instead of the email address, so that the email address is not exposed in links
+	EmailCallbackWithID bool `json:"emailCallbackWithID,omitempty"`
 	// DefaultFromEmail is used to set the "from" email while sending verification emails
 	DefaultFromEmail string `json:"defaultFromEmail,omitempty"`
 	// DefaultEmailSub is the email subject set while sending verification emails
 	/*
 	   If not set, a hardcoded string "Email verification request" is set as the subject.
-	   The default subject is used if no subject is sent while calling the Send function
+	   The default subject is used if no subject is sent while calling the Send function, and
+	   there's no subject template of the locale of the request
 	*/
 	DefaultEmailSub string `json:"defaultEmailSub,omitempty"`
+	// Templates are used to render the verification emails & text messages. DefaultTemplates
+	// is used if not set. The subject rendered from the templates of a locale is used even if
+	// DefaultEmailSub is set, the subject rendered from the other templates only if it's not set
+	Templates *Templates `json:"-"`
+	// LocaleResolver resolves the locale of requests, which are not created with a locale using
+	// WithLocale. e.g. CallingCodeLocales resolves the locale of mobile numbers by country code
+	LocaleResolver LocaleResolver `json:"-"`
+
+	// SecretGenerator is used to generate the secrets & IDs of verification requests. If not set,
+	// RandomSecretGenerator with crypto/rand as the source of entropy is used
+	SecretGenerator SecretGenerator `json:"-"`
+	// SecretHasher is used to hash the secrets before they're persisted in the store. If not set,
+	// secrets are stored in plain text, which lets anyone with read access to the store verify
+	// any pending request. It's recommended to use NewHMACHasher or NewArgon2idHasher
+	SecretHasher SecretHasher `json:"-"`
+	// OpaqueErrors if enabled, returns ErrVerificationFailed for all failed verifications instead
+	// of the specific reason (e.g. invalid secret, expired secret, exceeded attempts, no pending
+	// request). The specific reason is still updated in the store as the status of the request
+	OpaqueErrors bool `json:"opaqueErrors,omitempty"`
+
+	// ResendInterval is the minimum interval between sends of a verification request's secret.
+	// DefaultResendInterval is used if not set
+	ResendInterval time.Duration `json:"resendInterval,omitempty"`
+	// MaxResends is the maximum number of times a verification request's secret can be resent.
+	// DefaultMaxResends is used if not set
+	MaxResends int `json:"maxResends,omitempty"`
+	// RotateSecretOnResend if enabled, generates a new secret (with a new expiry) on every resend
+	// instead of re-delivering the existing secret. Secrets are always rotated if SecretHasher is
+	// set, since the plain text secret is not available to be re-delivered
+	RotateSecretOnResend bool `json:"rotateSecretOnResend,omitempty"`
+
+	// RateLimiter is used to rate limit the verification requests sent (including resends). Rate
+	// limiting is disabled if not set
+	RateLimiter RateLimiter `json:"-"`
+	// RateLimits are the limits applied per recipient, country, client & globally
+	RateLimits RateLimits `json:"rateLimits,omitempty"`
+
+	// Metrics is used to record the metrics of requests, providers & the store. Metrics are not
+	// recorded if not set
+	Metrics Metrics `json:"-"`
+	// TracerProvider is used to trace requests, verifications, sends & store calls. The global
+	// tracer provider is used if not set
+	TracerProvider trace.TracerProvider `json:"-"`
+	// Logger is used to log sends, verifications & failed store calls. Recipients are redacted,
+	// and secrets are never logged. Nothing is logged if not set
+	Logger *slog.Logger `json:"-"`
+
+	// SendQueue if set, makes the sends asynchronous. Instead of sending the secret, the request is
+	// persisted & a job to send it is enqueued; which is sent by the workers started using
+	// StartSendWorkers, with retries. Every attempt is recorded in the request's CommStatus
+	SendQueue SendQueue `json:"-"`
+	// SendWorkers is the configuration of the workers sending the queued jobs
+	SendWorkers SendWorkersConfig `json:"sendWorkers,omitempty"`
 }
 
 func (cfg *Config) init() {
 	if cfg.MaxVerifyAttempts < 1 {
 		cfg.MaxVerifyAttempts = 3
 	}
+
+	if cfg.SecretGenerator == nil {
+		cfg.SecretGenerator = &RandomSecretGenerator{}
+	}
+
+	if cfg.ResendInterval <= 0 {
+		cfg.ResendInterval = DefaultResendInterval
+	}
+
+	if cfg.MaxResends < 1 {
+		cfg.MaxResends = DefaultMaxResends
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = slog.New(discardHandler{})
+	}
+
+	if cfg.Templates == nil {
+		cfg.Templates = DefaultTemplates()
+	}
+
+	cfg.SendWorkers.init()
 }
 
 // CommStatus stores the status of the communication sent
 type CommStatus struct {
 	Status string                 `json:"status,omitempty"`
 	Data   map[string]interface{} `json:"data,omitempty"`
+	// Provider is the name of the provider which sent, or last failed to send, the communication
+	Provider string `json:"provider,omitempty"`
+	// Attempts are the providers attempted, if the communication was sent using a provider which
+	// tries multiple providers (e.g. failover)
+	Attempts []SendAttempt `json:"attempts,omitempty"`
+	// Attempt is the attempt number of a queued send (Config.SendQueue), it's 0 for the status
+	// recorded when the send is enqueued & for synchronous sends
+	Attempt int `json:"attempt,omitempty"`
+	// CreatedAt is the time at which the communication was sent
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// SendAttempt is an attempt to send a communication using a provider
+type SendAttempt struct {
+	Provider string `json:"provider,omitempty"`
+	// Status is the status returned by the provider, if sent successfully
+	Status interface{} `json:"status,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	// CreatedAt is the time at which the attempt was made
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// attemptsReporter is implemented by the statuses & errors returned by providers which try
+// multiple providers (e.g. failover), so that the attempts are recorded in the CommStatus
+type attemptsReporter interface {
+	SendAttempts() []SendAttempt
 }
 
 // Request struct holds all data related to a single verification request
 type Request struct {
-	ID           string            `json:"id,omitempty"`
-	Type         CommType          `json:"type,omitempty"`
-	Sender       string            `json:"sender,omitempty"`
-	Recipient    string            `json:"recipient,omitempty"`
-	Data         map[string]string `json:"data,omitempty"`
-	Secret       string            `json:"secret,omitempty"`
-	SecretExpiry *time.Time        `json:"secretExpiry,omitempty"`
+	ID        string            `json:"id,omitempty"`
+	Type      CommType          `json:"type,omitempty"`
+	Sender    string            `json:"sender,omitempty"`
+	Recipient string            `json:"recipient,omitempty"`
+	Data      map[string]string `json:"data,omitempty"`
+	// Locale is the locale in which the verification email or message is sent, e.g. 'pt-BR'
+	Locale string `json:"locale,omitempty"`
+	// Secret is the secret as persisted in the store, it is hashed if Config.SecretHasher is set
+	Secret       string     `json:"secret,omitempty"`
+	SecretExpiry *time.Time `json:"secretExpiry,omitempty"`
 	// Attempts has the number of times verification has been attempted
 	Attempts int `json:"attempts,omitempty"`
+	// Resends has the number of times the secret has been resent
+	Resends int `json:"resends,omitempty"`
+	// LastSentAt is the time at which the secret was last sent or resent
+	LastSentAt *time.Time `json:"lastSentAt,omitempty"`
 	// CommStatus is the communication status, and is maintained as a list to later store
 	// statuses of retries
 	CommStatus []CommStatus       `json:"commStatus,omitempty"`
 	Status     verificationStatus `json:"status,omitempty"`
 	CreatedAt  *time.Time         `json:"createdAt,omitempty"`
 	UpdatedAt  *time.Time         `json:"updatedAt,omitempty"`
+
+	// secret is the plain text secret, which is available only in memory till it's sent
+	secret string
+}
+
+// PlainSecret returns the plain text secret of a newly created request, to be used in custom
+// email or message bodies. It is not available once the request is sent, or if the request
+// was read from the store
+func (v *Request) PlainSecret() string {
+	return v.secret
+}
+
+// CheckResend returns nil if the request can be resent at now, i.e. it's pending, has been resent
+// less than maxResends times, & was last sent at least interval before now. ErrRequestNotPending,
+// ErrMaximumResendsExceeded or ErrResendTooSoon is returned otherwise. Stores use it to implement
+// IncrementResends
+func (v *Request) CheckResend(now time.Time, interval time.Duration, maxResends int) error {
+	if v.Status != VerStatusPending {
+		return ErrRequestNotPending
+	}
+
+	if v.Resends >= maxResends {
+		return ErrMaximumResendsExceeded
+	}
+
+	lastSentAt := v.LastSentAt
+	if lastSentAt == nil {
+		lastSentAt = v.CreatedAt
+	}
+	if lastSentAt != nil && now.Sub(*lastSentAt) < interval {
+		return ErrResendTooSoon
+	}
+
+	return nil
 }
 
 func (v *Request) setStatus(status interface{}, err error) {
+	now := time.Now()
+
+	provider, attempts := "", []SendAttempt(nil)
+	reporter, ok := status.(attemptsReporter)
+	if !ok && err != nil {
+		errors.As(err, &reporter)
+	}
+	if reporter != nil {
+		attempts = reporter.SendAttempts()
+	}
+	if len(attempts) > 0 {
+		last := attempts[len(attempts)-1]
+		provider = last.Provider
+		if status != nil && last.Status != nil {
+			status = last.Status
+		}
+	}
+
 	if status != nil {
 		if len(v.CommStatus) == 0 {
 			v.CommStatus = make([]CommStatus, 0, 1)
@@ -137,6 +406,9 @@ func (v *Request) setStatus(status interface{}, err error) {
 				Data: map[string]interface{}{
 					"status": status,
 				},
+				Provider:  provider,
+				Attempts:  attempts,
+				CreatedAt: &now,
 			},
 		)
 		return
@@ -154,62 +426,231 @@ func (v *Request) setStatus(status interface{}, err error) {
 				Data: map[string]interface{}{
 					"error": err.Error(),
 				},
+				Provider:  provider,
+				Attempts:  attempts,
+				CreatedAt: &now,
 			},
 		)
 		return
 	}
 }
 
+// setProvider sets the provider of the last communication status, if it's not already set by
+// the provider itself
+func (v *Request) setProvider(provider string) {
+	if len(v.CommStatus) == 0 {
+		return
+	}
+	last := &v.CommStatus[len(v.CommStatus)-1]
+	if last.Provider == "" {
+		last.Provider = provider
+	}
+}
+
 // Verifier struct exposes all services provided by verify package
 type Verifier struct {
 	cfg           *Config
 	emailHandler  emailService
 	mobileHandler mobileService
 	store         store
+	tracer        trace.Tracer
+
+	dummyOnce sync.Once
+	dummy     *Request
+
+	observersMu sync.RWMutex
+	observers   []Observer
+
+	sendWorkers *sendWorkers
 }
 
 // NewRequest is used to create a new verification request
 func (ver *Verifier) NewRequest(ctype CommType, recipient string) (*Request, error) {
+	return ver.NewRequestContext(context.Background(), ctype, recipient)
+}
+
+// NewRequestContext is same as NewRequest, with the context passed on to the store
+func (ver *Verifier) NewRequestContext(ctx context.Context, ctype CommType, recipient string) (*Request, error) {
+	ctx, span := ver.startSpan(ctx, "verifier.NewRequest", ctype, recipient)
+	verreq, err := ver.newRequest(ctx, ctype, recipient)
+	if verreq != nil {
+		span.SetAttributes(AttrRequestID.String(verreq.ID))
+	}
+	endSpan(span, outcome(err), err)
+
+	return verreq, err
+}
+
+func (ver *Verifier) newRequest(ctx context.Context, ctype CommType, recipient string) (*Request, error) {
+	err := ver.rateLimit(ctx, ctype, recipient)
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 	secExpiry := now.Add(ver.cfg.EmailOTPExpiry)
-	secret := randomString(256)
 
 	switch ctype {
 	case CommTypeMobile:
 		{
 			secExpiry = now.Add(ver.cfg.MobileOTPExpiry)
-			secret = randomNumericString(6)
 		}
 	}
 
+	secret, err := ver.cfg.SecretGenerator.Secret(ctype)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := ver.cfg.SecretGenerator.ID()
+	if err != nil {
+		return nil, err
+	}
+
+	hashedSecret, err := ver.hashSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
 	verReq := &Request{
-		ID:           newID(),
+		ID:           id,
 		Type:         ctype,
 		Recipient:    recipient,
 		Data:         nil,
-		Secret:       secret,
+		Locale:       ver.locale(ctx, ctype, recipient),
+		Secret:       hashedSecret,
 		SecretExpiry: &secExpiry,
 		Status:       VerStatusPending,
+		LastSentAt:   &now,
 		CreatedAt:    &now,
 		UpdatedAt:    &now,
+		secret:       secret,
 	}
-	verReq, err := ver.store.Create(verReq)
+	verReq, err = ver.store.Create(ctx, verReq)
 	if err != nil {
 		return nil, err
 	}
+	// stores may return a different instance of the request
+	verReq.secret = secret
+	ver.emit(ctx, EventCreated, verReq, nil)
+
 	return verReq, nil
 }
 
-func (ver *Verifier) verifySecret(ctype CommType, recipient, secret string) error {
-	verreq, err := ver.store.ReadLastPending(ctype, recipient)
-	if err != nil {
+// hashSecret returns the hash of the secret to be persisted, or the secret itself if hashing
+// is not configured
+func (ver *Verifier) hashSecret(secret string) (string, error) {
+	if ver.cfg.SecretHasher == nil {
+		return secret, nil
+	}
+	return ver.cfg.SecretHasher.Hash(secret)
+}
+
+// matchSecret reports whether the secret matches the secret persisted in the verification request
+func (ver *Verifier) matchSecret(verreq *Request, secret string) (bool, error) {
+	if ver.cfg.SecretHasher == nil {
+		return subtle.ConstantTimeCompare([]byte(secret), []byte(verreq.Secret)) == 1, nil
+	}
+	return ver.cfg.SecretHasher.Compare(verreq.Secret, secret)
+}
+
+func (ver *Verifier) verifySecret(ctx context.Context, ctype CommType, recipient, secret string) error {
+	ctx, span := ver.startSpan(ctx, "verifier.VerifySecret", ctype, recipient)
+	verreq, err := ver.store.ReadLastPending(ctx, ctype, recipient)
+	err = ver.verify(ctx, verreq, err, secret)
+	outcome := verificationOutcome(err)
+	endSpan(span, outcome, err)
+	ver.logVerification(ctx, outcome, err, slog.String("type", string(ctype)), RecipientAttr(recipient))
+
+	return ver.opaqueErr(err)
+}
+
+// verify verifies the secret of the request, readErr is the error returned while reading the
+// request from the store
+func (ver *Verifier) verify(ctx context.Context, verreq *Request, readErr error, secret string) error {
+	if readErr != nil {
+		if errors.Is(readErr, ErrNotFound) {
+			// a secret comparison is done anyway, so that the response time does not
+			// reveal whether a pending request exists
+			_, _ = ver.matchSecret(ver.dummyRequest(), secret)
+		}
+		return readErr
+	}
+
+	return ver.verifyAndUpdate(ctx, secret, verreq)
+}
+
+// VerifyByID verifies the secret of the pending verification request of the given ID. Unlike
+// VerifyEmailSecret & VerifyMobileSecret, any pending request of the recipient can be verified,
+// and not just the latest one
+func (ver *Verifier) VerifyByID(id, secret string) error {
+	return ver.VerifyByIDContext(context.Background(), id, secret)
+}
+
+// VerifyByIDContext is same as VerifyByID, with the context passed on to the store
+func (ver *Verifier) VerifyByIDContext(ctx context.Context, id, secret string) error {
+	ctx, span := ver.startSpan(ctx, "verifier.VerifyByID", "", "")
+	span.SetAttributes(AttrRequestID.String(id))
+
+	verreq, err := ver.store.ReadByID(ctx, id)
+	if err == nil && verreq.Status != VerStatusPending {
+		// requests which are not pending are treated the same as when verifying by recipient
+		err = ErrNotFound
+	}
+	if err == nil {
+		span.SetAttributes(
+			AttrCommType.String(string(verreq.Type)),
+			AttrRecipient.String(RedactRecipient(verreq.Recipient)),
+		)
+	}
+
+	err = ver.verify(ctx, verreq, err, secret)
+	outcome := verificationOutcome(err)
+	endSpan(span, outcome, err)
+	ver.logVerification(ctx, outcome, err, slog.String("id", id))
+
+	return ver.opaqueErr(err)
+}
+
+// opaqueErr replaces the reason of a failed verification with ErrVerificationFailed if
+// Config.OpaqueErrors is enabled
+func (ver *Verifier) opaqueErr(err error) error {
+	if !ver.cfg.OpaqueErrors {
 		return err
 	}
 
-	return ver.verifyAndUpdate(secret, verreq)
+	switch {
+	case errors.Is(err, ErrNotFound),
+		errors.Is(err, ErrInvalidSecret),
+		errors.Is(err, ErrSecretExpired),
+		errors.Is(err, ErrMaximumAttemptsExceeded),
+		errors.Is(err, ErrInvalidSecretHash):
+		return ErrVerificationFailed
+	}
+
+	return err
 }
 
+// dummyRequest returns a request with a random secret, which is used to compare secrets
+// when there's no request to verify against
+func (ver *Verifier) dummyRequest() *Request {
+	ver.dummyOnce.Do(func() {
+		secret, _ := randomString(DefaultMobileSecretLength)
+		hashed, err := ver.hashSecret(secret)
+		if err != nil {
+			hashed = secret
+		}
+		ver.dummy = &Request{Secret: hashed}
+	})
+	return ver.dummy
+}
+
+// validate checks if the secret is valid for the verification request. The secret is always
+// compared, even if attempts are exceeded or the secret has expired, so that the time taken
+// does not reveal the reason of failure
 func (ver *Verifier) validate(secret string, verreq *Request) error {
+	match, err := ver.matchSecret(verreq, secret)
+
 	if verreq.Attempts > ver.cfg.MaxVerifyAttempts {
 		return ErrMaximumAttemptsExceeded
 	}
@@ -219,7 +660,11 @@ func (ver *Verifier) validate(secret string, verreq *Request) error {
 		return ErrSecretExpired
 	}
 
-	if secret != verreq.Secret {
+	if err != nil {
+		return err
+	}
+
+	if !match {
 		return ErrInvalidSecret
 	}
 
@@ -228,39 +673,48 @@ func (ver *Verifier) validate(secret string, verreq *Request) error {
 
 // verifyAndUpdate verifies all conditions required to verify a secret. And then update
 // the status of verification in the store
-func (ver *Verifier) verifyAndUpdate(secret string, verreq *Request) error {
-	var err error
+func (ver *Verifier) verifyAndUpdate(ctx context.Context, secret string, verreq *Request) error {
+	// attempts are incremented atomically in the store, so that concurrent attempts cannot
+	// all see the same count & bypass the maximum attempts allowed
+	verreq, err := ver.store.IncrementAttempts(ctx, verreq.ID)
+	if errors.Is(err, ErrRequestNotPending) || (err == nil && verreq.Status != VerStatusPending) {
+		// the request was verified, rejected or cancelled after it was read
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
 	now := time.Now()
 	verreq.UpdatedAt = &now
-	verreq.Attempts++
 
 	validationErr := ver.validate(secret, verreq)
 	switch validationErr {
 	case ErrMaximumAttemptsExceeded:
 		{
-			verreq.Status = VerStatusExceededAttempts
-			verreq, err = ver.store.Update(verreq.ID, verreq)
+			verreq, err = ver.updateOutcome(ctx, verreq, VerStatusExceededAttempts)
 			if err != nil {
 				return err
 			}
+			ver.emit(ctx, EventAttemptsExceeded, verreq, validationErr)
 		}
 
 	case ErrSecretExpired:
 		{
-			verreq.Status = VerStatusExpired
-			verreq, err = ver.store.Update(verreq.ID, verreq)
+			verreq, err = ver.updateOutcome(ctx, verreq, VerStatusExpired)
 			if err != nil {
 				return err
 			}
+			ver.emit(ctx, EventExpired, verreq, validationErr)
 		}
 
 	case ErrInvalidSecret:
 		{
-			verreq.Status = VerStatusRejected
-			verreq, err = ver.store.Update(verreq.ID, verreq)
+			verreq, err = ver.updateOutcome(ctx, verreq, VerStatusRejected)
 			if err != nil {
 				return err
 			}
+			ver.emit(ctx, EventRejected, verreq, validationErr)
 		}
 	}
 
@@ -268,92 +722,195 @@ func (ver *Verifier) verifyAndUpdate(secret string, verreq *Request) error {
 		return validationErr
 	}
 
-	verreq.Status = VerStatusVerified
-	verreq, err = ver.store.Update(verreq.ID, verreq)
+	verreq, err = ver.updateOutcome(ctx, verreq, VerStatusVerified)
 	if err != nil {
 		return err
 	}
+	ver.emit(ctx, EventVerified, verreq, nil)
 
 	return nil
 }
 
+// updateOutcome persists the outcome of a verification. The store updates only pending requests,
+// so the outcome of a concurrent verification or cancellation is not overwritten
+func (ver *Verifier) updateOutcome(ctx context.Context, verreq *Request, status verificationStatus) (*Request, error) {
+	verreq.Status = status
+	verreq, err := ver.store.Update(ctx, verreq.ID, verreq)
+	if errors.Is(err, ErrRequestNotPending) {
+		return nil, ErrNotFound
+	}
+	return verreq, err
+}
+
 // VerifyEmailSecret validates an email and its verification secret
 func (ver *Verifier) VerifyEmailSecret(recipient, secret string) error {
-	return ver.verifySecret(CommTypeEmail, recipient, secret)
+	return ver.VerifyEmailSecretContext(context.Background(), recipient, secret)
+}
+
+// VerifyEmailSecretContext is same as VerifyEmailSecret, with the context passed on to the store
+func (ver *Verifier) VerifyEmailSecretContext(ctx context.Context, recipient, secret string) error {
+	return ver.verifySecret(ctx, CommTypeEmail, recipient, secret)
 }
 
 // NewEmailWithReq is used to send a mail with a custom verification request
 func (ver *Verifier) NewEmailWithReq(verreq *Request, subject, body string) error {
+	return ver.NewEmailWithReqContext(context.Background(), verreq, subject, body)
+}
+
+// NewEmailWithReqContext is same as NewEmailWithReq, with the context passed on to the
+// store & email service
+func (ver *Verifier) NewEmailWithReqContext(ctx context.Context, verreq *Request, subject, body string) error {
+	if body == "" {
+		err := validateEmailAddress(verreq.Recipient)
+		if err != nil {
+			return err
+		}
+		return ErrEmptyEmailBody
+	}
+
+	return ver.NewEmailWithMessageContext(ctx, verreq, &Message{Subject: subject, HTML: body})
+}
+
+// NewEmailWithMessageContext sends the email message for a custom verification request. The plain
+// text body of the message is sent along with the HTML body only if the email service supports
+// multipart emails (i.e. has a method SendMultipart), otherwise the HTML body is sent, or the
+// plain text body if there's no HTML body. The message is sent synchronously even if
+// Config.SendQueue is set, since it has the plain text secret which is never persisted
+func (ver *Verifier) NewEmailWithMessageContext(ctx context.Context, verreq *Request, msg *Message) error {
 	err := validateEmailAddress(verreq.Recipient)
 	if err != nil {
 		return err
 	}
 
-	if body == "" {
+	if msg == nil || (msg.HTML == "" && msg.Text == "") {
 		return ErrEmptyEmailBody
 	}
 
+	subject := ver.cfg.DefaultEmailSub
+	if msg.Subject != "" {
+		subject = msg.Subject
+	}
 	if subject == "" {
-		subject = ver.cfg.DefaultEmailSub
-		if subject == "" {
-			subject = "Email verification request"
-		}
+		subject = defaultEmailSubject
 	}
 
-	status, sendErr := ver.emailHandler.Send(
-		ver.cfg.DefaultFromEmail,
-		verreq.Recipient,
-		subject,
-		body,
-	)
-
+	sendCtx, span := ver.startSendSpan(ctx, verreq, ver.emailHandler)
+	start := time.Now()
+	status, sendErr := ver.sendEmailMessage(sendCtx, verreq.Recipient, subject, msg)
+	ver.recordProviderCall(CommTypeEmail, ver.emailHandler, start, sendErr)
+	ver.logSend(ctx, verreq, ver.emailHandler, start, sendErr)
+	endSpan(span, outcome(sendErr), sendErr)
+	// plain text secret is not required once it's sent
+	verreq.secret = ""
 	verreq.setStatus(status, sendErr)
+	verreq.setProvider(providerName(ver.emailHandler))
 
-	verreq, err = ver.store.Update(verreq.ID, verreq)
+	verreq, err = ver.store.Update(ctx, verreq.ID, verreq)
 	if err != nil {
 		return err
 	}
 
 	if sendErr != nil {
+		ver.emit(ctx, EventSendFailed, verreq, sendErr)
 		return sendErr
 	}
+	ver.emit(ctx, EventSent, verreq, nil)
 
 	return nil
 }
 
+// sendEmailMessage sends the message using the email handler, as a multipart email if the
+// message has both the bodies & the handler supports it
+func (ver *Verifier) sendEmailMessage(ctx context.Context, recipient, subject string, msg *Message) (interface{}, error) {
+	if msg.HTML == "" {
+		return ver.emailHandler.Send(ctx, ver.cfg.DefaultFromEmail, recipient, subject, msg.Text)
+	}
+
+	multipart, ok := ver.emailHandler.(multipartEmailService)
+	if !ok || msg.Text == "" {
+		return ver.emailHandler.Send(ctx, ver.cfg.DefaultFromEmail, recipient, subject, msg.HTML)
+	}
+
+	return multipart.SendMultipart(ctx, ver.cfg.DefaultFromEmail, recipient, subject, msg.HTML, msg.Text)
+}
+
 // NewEmail creates a new request for email verification
 func (ver *Verifier) NewEmail(recipient, subject string) error {
+	return ver.NewEmailContext(context.Background(), recipient, subject)
+}
+
+// NewEmailContext is same as NewEmail, with the context passed on to the store & email service
+func (ver *Verifier) NewEmailContext(ctx context.Context, recipient, subject string) error {
 	err := validateEmailAddress(recipient)
 	if err != nil {
 		return err
 	}
 
-	verreq, err := ver.NewRequest(CommTypeEmail, recipient)
+	verreq, err := ver.NewRequestContext(ctx, CommTypeEmail, recipient)
 	if err != nil {
 		return err
 	}
 
-	callbackURL, err := EmailCallbackURL(ver.cfg.EmailCallbackURL, verreq.Recipient, verreq.Secret)
+	return ver.sendEmail(ctx, verreq, subject)
+}
+
+// sendEmail sends the verification email, with the callback URL, for the request; or enqueues it
+// to be sent if Config.SendQueue is set
+func (ver *Verifier) sendEmail(ctx context.Context, verreq *Request, subject string) error {
+	if ver.cfg.SendQueue != nil {
+		return ver.enqueue(ctx, verreq, subject)
+	}
+
+	msg, err := ver.emailMessage(verreq, subject)
 	if err != nil {
 		return err
 	}
 
-	if subject == "" {
-		subject = ver.cfg.DefaultEmailSub
-		if subject == "" {
-			subject = "Email verification request"
-		}
+	return ver.NewEmailWithMessageContext(ctx, verreq, msg)
+}
+
+// emailMessage renders the verification email of the request using the configured templates. The
+// subject if not empty takes precedence over the rendered & configured subjects. A subject rendered
+// from the templates of a locale takes precedence over the configured subject
+func (ver *Verifier) emailMessage(verreq *Request, subject string) (*Message, error) {
+	callbackURL, err := EmailCallbackURL(ver.cfg.EmailCallbackURL, verreq.Recipient, verreq.PlainSecret())
+	if ver.cfg.EmailCallbackWithID {
+		callbackURL, err = EmailCallbackURLWithID(ver.cfg.EmailCallbackURL, verreq.ID, verreq.PlainSecret())
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return ver.NewEmailWithReq(
-		verreq,
-		subject,
-		emailBody(callbackURL, ver.cfg.EmailOTPExpiry.String()),
-	)
+	data := ver.templateData(verreq, callbackURL)
+	msg, err := ver.cfg.Templates.Email(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case subject != "":
+		msg.Subject = subject
+	case ver.cfg.Templates.localized(data.Locale, TemplateEmailSubject):
+		// the subject in the language of the recipient takes precedence over the configured subject
+	case ver.cfg.DefaultEmailSub != "":
+		msg.Subject = ver.cfg.DefaultEmailSub
+	}
+	if msg.Subject == "" {
+		msg.Subject = defaultEmailSubject
+	}
+
+	return msg, nil
 }
 
 // NewMobileWithReq creates a new request for mobile number verification
 func (ver *Verifier) NewMobileWithReq(verreq *Request, body string) error {
+	return ver.NewMobileWithReqContext(context.Background(), verreq, body)
+}
+
+// NewMobileWithReqContext is same as NewMobileWithReq, with the context passed on to the
+// store & mobile service. The message is sent synchronously even if Config.SendQueue is set,
+// since it has the plain text secret which is never persisted
+func (ver *Verifier) NewMobileWithReqContext(ctx context.Context, verreq *Request, body string) error {
 	err := validateMobile(verreq.Recipient)
 	if err != nil {
 		return err
@@ -363,45 +920,299 @@ func (ver *Verifier) NewMobileWithReq(verreq *Request, body string) error {
 		return ErrEmptyMobileMessageBody
 	}
 
+	sendCtx, span := ver.startSendSpan(ctx, verreq, ver.mobileHandler)
+	start := time.Now()
 	status, sendErr := ver.mobileHandler.Send(
+		sendCtx,
 		verreq.Recipient,
 		body,
 	)
+	ver.recordProviderCall(CommTypeMobile, ver.mobileHandler, start, sendErr)
+	ver.logSend(ctx, verreq, ver.mobileHandler, start, sendErr)
+	endSpan(span, outcome(sendErr), sendErr)
+	// plain text secret is not required once it's sent
+	verreq.secret = ""
 	verreq.setStatus(status, sendErr)
+	verreq.setProvider(providerName(ver.mobileHandler))
 
-	verreq, err = ver.store.Update(verreq.ID, verreq)
+	verreq, err = ver.store.Update(ctx, verreq.ID, verreq)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	if sendErr != nil {
+		ver.emit(ctx, EventSendFailed, verreq, sendErr)
 		return sendErr
 	}
+	ver.emit(ctx, EventSent, verreq, nil)
 
 	return nil
 }
 
 // NewMobile creates a new request for mobile number verification with default setting
 func (ver *Verifier) NewMobile(recipient string) error {
+	return ver.NewMobileContext(context.Background(), recipient)
+}
+
+// NewMobileContext is same as NewMobile, with the context passed on to the store & mobile service
+func (ver *Verifier) NewMobileContext(ctx context.Context, recipient string) error {
 	err := validateMobile(recipient)
 	if err != nil {
 		return err
 	}
 
-	verreq, err := ver.NewRequest(CommTypeMobile, recipient)
+	verreq, err := ver.NewRequestContext(ctx, CommTypeMobile, recipient)
 	if err != nil {
 		return err
 	}
 
-	return ver.NewMobileWithReq(
-		verreq,
-		smsBody(verreq.Secret, ver.cfg.MobileOTPExpiry.String()),
-	)
+	return ver.sendMobile(ctx, verreq)
+}
+
+// sendMobile sends the verification message, with the secret, for the request; or enqueues it to
+// be sent if Config.SendQueue is set
+func (ver *Verifier) sendMobile(ctx context.Context, verreq *Request) error {
+	if ver.cfg.SendQueue != nil {
+		return ver.enqueue(ctx, verreq, "")
+	}
+
+	body, err := ver.mobileBody(verreq)
+	if err != nil {
+		return err
+	}
+
+	return ver.NewMobileWithReqContext(ctx, verreq, body)
+}
+
+// mobileBody renders the verification message of the request using the configured templates
+func (ver *Verifier) mobileBody(verreq *Request) (string, error) {
+	return ver.cfg.Templates.sms(ver.smsTemplate(verreq.Recipient), ver.templateData(verreq, ""))
 }
 
 // VerifyMobileSecret validates a mobile number and its verification secret (OTP)
 func (ver *Verifier) VerifyMobileSecret(recipient, secret string) error {
-	return ver.verifySecret(CommTypeMobile, recipient, secret)
+	return ver.VerifyMobileSecretContext(context.Background(), recipient, secret)
+}
+
+// VerifyMobileSecretContext is same as VerifyMobileSecret, with the context passed on to the store
+func (ver *Verifier) VerifyMobileSecretContext(ctx context.Context, recipient, secret string) error {
+	return ver.verifySecret(ctx, CommTypeMobile, recipient, secret)
+}
+
+// Status returns the last pending verification request of the recipient. The secret is
+// removed from the returned request, so it's safe to be exposed
+func (ver *Verifier) Status(ctype CommType, recipient string) (*Request, error) {
+	return ver.StatusContext(context.Background(), ctype, recipient)
+}
+
+// StatusContext is same as Status, with the context passed on to the store
+func (ver *Verifier) StatusContext(ctx context.Context, ctype CommType, recipient string) (*Request, error) {
+	verreq, err := ver.store.ReadLastPending(ctx, ctype, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	return sanitized(verreq), nil
+}
+
+// Resend re-sends the secret of the last pending verification request of the recipient. The
+// existing secret is re-delivered, unless Config.RotateSecretOnResend is enabled or secrets are
+// hashed; in which case a new secret is generated & sent, with a new expiry. Verification attempts
+// are not reset on resend. Every resend is recorded in the request's CommStatus
+func (ver *Verifier) Resend(ctype CommType, recipient string) error {
+	return ver.ResendContext(context.Background(), ctype, recipient)
+}
+
+// ResendContext is same as Resend, with the context passed on to the store & the email or mobile service
+func (ver *Verifier) ResendContext(ctx context.Context, ctype CommType, recipient string) error {
+	switch ctype {
+	case CommTypeEmail:
+		err := validateEmailAddress(recipient)
+		if err != nil {
+			return err
+		}
+	case CommTypeMobile:
+		err := validateMobile(recipient)
+		if err != nil {
+			return err
+		}
+	default:
+		return ErrNotFound
+	}
+
+	verreq, err := ver.store.ReadLastPending(ctx, ctype, recipient)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	// checked before rate limiting, so that resends which are not allowed are not counted
+	err = verreq.CheckResend(now, ver.cfg.ResendInterval, ver.cfg.MaxResends)
+	if err != nil {
+		return err
+	}
+
+	rotate := ver.cfg.RotateSecretOnResend || ver.cfg.SecretHasher != nil
+	if !rotate && (verreq.SecretExpiry == nil || verreq.SecretExpiry.Before(now)) {
+		// the existing secret cannot be re-delivered, which should not count as a resend
+		return ErrSecretExpired
+	}
+
+	err = ver.rateLimit(ctx, ctype, recipient)
+	if err != nil {
+		return err
+	}
+
+	// resends are counted atomically in the store, so that concurrent resends cannot all pass
+	// the checks above
+	verreq, err = ver.store.IncrementResends(ctx, verreq.ID, now, ver.cfg.ResendInterval, ver.cfg.MaxResends)
+	if errors.Is(err, ErrRequestNotPending) {
+		// the request was verified or cancelled after it was read
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if !rotate {
+		verreq.secret = verreq.Secret
+	} else {
+		err = ver.rotateSecret(verreq, now)
+		if err != nil {
+			return err
+		}
+	}
+	verreq.UpdatedAt = &now
+
+	if rotate && ver.cfg.SendQueue == nil {
+		// the new secret is persisted before it's sent, so that it can be verified as soon as it's
+		// received. Queued sends are persisted when they're enqueued
+		secret := verreq.secret
+		verreq, err = ver.store.Update(ctx, verreq.ID, verreq)
+		if errors.Is(err, ErrRequestNotPending) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		verreq.secret = secret
+	}
+
+	if ctype == CommTypeMobile {
+		return ver.sendMobile(ctx, verreq)
+	}
+
+	return ver.sendEmail(ctx, verreq, "")
+}
+
+// rotateSecret replaces the secret of the request with a newly generated secret & expiry
+func (ver *Verifier) rotateSecret(verreq *Request, now time.Time) error {
+	secret, err := ver.cfg.SecretGenerator.Secret(verreq.Type)
+	if err != nil {
+		return err
+	}
+
+	hashedSecret, err := ver.hashSecret(secret)
+	if err != nil {
+		return err
+	}
+
+	expiry := now.Add(ver.cfg.EmailOTPExpiry)
+	if verreq.Type == CommTypeMobile {
+		expiry = now.Add(ver.cfg.MobileOTPExpiry)
+	}
+
+	verreq.Secret = hashedSecret
+	verreq.SecretExpiry = &expiry
+	verreq.secret = secret
+
+	return nil
+}
+
+// sanitized returns a copy of the request without the secret, so that it's safe to be exposed
+func sanitized(verreq *Request) *Request {
+	clean := *verreq
+	clean.Secret = ""
+	clean.secret = ""
+	return &clean
+}
+
+// Get returns the verification request of the given ID, irrespective of its status. The secret
+// is removed from the returned request
+func (ver *Verifier) Get(id string) (*Request, error) {
+	return ver.GetContext(context.Background(), id)
+}
+
+// GetContext is same as Get, with the context passed on to the store
+func (ver *Verifier) GetContext(ctx context.Context, id string) (*Request, error) {
+	verreq, err := ver.store.ReadByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return sanitized(verreq), nil
+}
+
+// List returns the verification requests matching the filter, latest first. The secrets are
+// removed from the returned requests
+func (ver *Verifier) List(filter ListFilter) ([]*Request, error) {
+	return ver.ListContext(context.Background(), filter)
+}
+
+// ListContext is same as List, with the context passed on to the store
+func (ver *Verifier) ListContext(ctx context.Context, filter ListFilter) ([]*Request, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultListLimit
+	}
+	if filter.Limit > MaxListLimit {
+		filter.Limit = MaxListLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	reqs, err := ver.store.List(ctx, &filter)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Request, 0, len(reqs))
+	for _, verreq := range reqs {
+		list = append(list, sanitized(verreq))
+	}
+
+	return list, nil
+}
+
+// Cancel cancels the pending verification request of the given ID, so that it can no longer be
+// verified or resent. ErrRequestNotPending is returned if the request is not pending
+func (ver *Verifier) Cancel(id string) error {
+	return ver.CancelContext(context.Background(), id)
+}
+
+// CancelContext is same as Cancel, with the context passed on to the store
+func (ver *Verifier) CancelContext(ctx context.Context, id string) error {
+	verreq, err := ver.store.ReadByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if verreq.Status != VerStatusPending {
+		return ErrRequestNotPending
+	}
+
+	now := time.Now()
+	verreq.Status = VerStatusCancelled
+	verreq.UpdatedAt = &now
+	// the store updates only pending requests, so a request verified or cancelled concurrently,
+	// after it was read, is not overwritten & ErrRequestNotPending is returned
+	verreq, err = ver.store.Update(ctx, verreq.ID, verreq)
+	if err != nil {
+		return err
+	}
+	ver.emit(ctx, EventCancelled, verreq, nil)
+
+	return nil
 }
 
 // CustomEmailHandler is used to set a custom email sending service
@@ -413,7 +1224,12 @@ func (ver *Verifier) CustomEmailHandler(email emailService) error {
 
 // CustomStore is used to set a custom persistent store
 func (ver *Verifier) CustomStore(verStore store) error {
-	ver.store = verStore
+	ver.store = &instrumentedStore{
+		store:   verStore,
+		tracer:  ver.tracer,
+		metrics: ver.cfg.Metrics,
+		logger:  ver.cfg.Logger,
+	}
 	// TODO: implement a validation method later, by implementing Ping
 	return nil
 }
@@ -430,7 +1246,13 @@ func New(cfg *Config, verStore store, email emailService, mobile mobileService)
 	cfg.init()
 
 	v := &Verifier{
-		cfg: cfg,
+		cfg:    cfg,
+		tracer: Tracer(cfg.TracerProvider, TracerName),
+		sendWorkers: &sendWorkers{
+			wake:    make(chan struct{}, 1),
+			slots:   make(chan struct{}, cfg.SendWorkers.Concurrency),
+			secrets: map[string]queuedSecret{},
+		},
 	}
 
 	err := v.CustomEmailHandler(email)
@@ -0,0 +1,181 @@
+package verifier_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+	"github.com/naughtygopher/verifier/stores"
+)
+
+type mockmobile struct{}
+
+func (mm *mockmobile) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	return "message-id", nil
+}
+
+func TestVerifier_ConcurrentVerification(t *testing.T) {
+	const (
+		maxAttempts = 3
+		concurrency = 50
+		recipient   = "+919876543210"
+	)
+
+	ver, err := verifier.New(
+		&verifier.Config{
+			MaxVerifyAttempts: maxAttempts,
+			MobileOTPExpiry:   time.Minute,
+		},
+		stores.NewMemory(nil),
+		nil,
+		&mockmobile{},
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	err = ver.NewMobile(recipient)
+	if err != nil {
+		t.Fatalf("Verifier.NewMobile() error = %v", err)
+	}
+
+	mu := sync.Mutex{}
+	invalid := 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := ver.VerifyMobileSecret(recipient, "wrong-secret")
+			switch {
+			case errors.Is(err, verifier.ErrInvalidSecret):
+				mu.Lock()
+				invalid++
+				mu.Unlock()
+			case errors.Is(err, verifier.ErrMaximumAttemptsExceeded),
+				errors.Is(err, verifier.ErrNotFound):
+				// the request is not pending anymore once the attempts are exceeded
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every guess is counted, so no more than the maximum attempts can be evaluated against
+	// the secret, irrespective of concurrency
+	if invalid > maxAttempts {
+		t.Fatalf("expected at most %d invalid secret errors, got %d", maxAttempts, invalid)
+	}
+}
+
+func TestVerifier_ConcurrentResend(t *testing.T) {
+	const (
+		concurrency = 50
+		recipient   = "+919876543210"
+	)
+
+	ver, err := verifier.New(
+		&verifier.Config{
+			MobileOTPExpiry: time.Minute,
+			ResendInterval:  time.Millisecond,
+			MaxResends:      1,
+		},
+		stores.NewMemory(nil),
+		nil,
+		&mockmobile{},
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	err = ver.NewMobile(recipient)
+	if err != nil {
+		t.Fatalf("Verifier.NewMobile() error = %v", err)
+	}
+	time.Sleep(time.Millisecond * 2)
+
+	mu := sync.Mutex{}
+	resent := 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := ver.Resend(verifier.CommTypeMobile, recipient)
+			switch {
+			case err == nil:
+				mu.Lock()
+				resent++
+				mu.Unlock()
+			case errors.Is(err, verifier.ErrMaximumResendsExceeded),
+				errors.Is(err, verifier.ErrResendTooSoon):
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// resends are counted atomically, so concurrent resends cannot exceed the maximum resends
+	if resent != 1 {
+		t.Fatalf("expected 1 resend, got %d", resent)
+	}
+}
+
+func TestVerifier_ConcurrentCancel(t *testing.T) {
+	const (
+		concurrency = 20
+		recipient   = "+919876543210"
+	)
+
+	ver, err := verifier.New(
+		&verifier.Config{MobileOTPExpiry: time.Minute},
+		stores.NewMemory(nil),
+		nil,
+		&mockmobile{},
+	)
+	if err != nil {
+		t.Fatalf("failed initializing verifier: %v", err)
+	}
+
+	verreq, err := ver.NewRequest(verifier.CommTypeMobile, recipient)
+	if err != nil {
+		t.Fatalf("Verifier.NewRequest() error = %v", err)
+	}
+
+	mu := sync.Mutex{}
+	succeeded := 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				err = ver.Cancel(verreq.ID)
+			} else {
+				err = ver.VerifyByID(verreq.ID, verreq.PlainSecret())
+			}
+			switch {
+			case err == nil:
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			case errors.Is(err, verifier.ErrRequestNotPending),
+				errors.Is(err, verifier.ErrNotFound):
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// only one of the concurrent verifications & cancellations can change the status from pending
+	if succeeded != 1 {
+		t.Fatalf("expected 1 verification or cancellation to succeed, got %d", succeeded)
+	}
+}
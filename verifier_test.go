@@ -2,22 +2,25 @@
 package verifier
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"html"
+	"net/url"
 	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
-
-	"github.com/naughtygopher/verifier/awsses"
-	"github.com/naughtygopher/verifier/awssns"
 )
 
 type mockstore struct {
 	data map[string]*Request
+	// filter is the last filter used to list requests
+	filter *ListFilter
 }
 
-func (ms *mockstore) Create(ver *Request) (*Request, error) {
+func (ms *mockstore) Create(ctx context.Context, ver *Request) (*Request, error) {
 	key := fmt.Sprintf(
 		"%s-%s",
 		ver.Type,
@@ -26,7 +29,7 @@ func (ms *mockstore) Create(ver *Request) (*Request, error) {
 	ms.data[key] = ver
 	return ver, nil
 }
-func (ms *mockstore) ReadLastPending(ctype CommType, recipient string) (*Request, error) {
+func (ms *mockstore) ReadLastPending(ctx context.Context, ctype CommType, recipient string) (*Request, error) {
 	key := fmt.Sprintf(
 		"%s-%s",
 		ctype,
@@ -34,12 +37,32 @@ func (ms *mockstore) ReadLastPending(ctype CommType, recipient string) (*Request
 	)
 	req, ok := ms.data[key]
 	if !ok {
-		return nil, errors.New("not found")
+		return nil, ErrNotFound
 	}
 	return req, nil
 }
 
-func (ms *mockstore) Update(verID string, ver *Request) (*Request, error) {
+func (ms *mockstore) ReadByID(ctx context.Context, verID string) (*Request, error) {
+	for _, req := range ms.data {
+		if req.ID == verID {
+			return req, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (ms *mockstore) List(ctx context.Context, filter *ListFilter) ([]*Request, error) {
+	ms.filter = filter
+	list := make([]*Request, 0, len(ms.data))
+	for _, req := range ms.data {
+		if filter.Match(req) {
+			list = append(list, req)
+		}
+	}
+	return list, nil
+}
+
+func (ms *mockstore) Update(ctx context.Context, verID string, ver *Request) (*Request, error) {
 	key := fmt.Sprintf(
 		"%s-%s",
 		ver.Type,
@@ -49,10 +72,35 @@ func (ms *mockstore) Update(verID string, ver *Request) (*Request, error) {
 	return ver, nil
 }
 
+func (ms *mockstore) IncrementAttempts(ctx context.Context, verID string) (*Request, error) {
+	for _, req := range ms.data {
+		if req.ID == verID {
+			if req.Status != VerStatusPending {
+				return nil, ErrRequestNotPending
+			}
+			req.Attempts++
+			return req, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (ms *mockstore) IncrementResends(ctx context.Context, verID string, now time.Time, interval time.Duration, maxResends int) (*Request, error) {
+	verreq, err := ms.ReadByID(ctx, verID)
+	if err != nil {
+		return nil, err
+	}
+	err = verreq.CheckResend(now, interval, maxResends)
+	if err != nil {
+		return nil, err
+	}
+	verreq.Resends++
+	verreq.LastSentAt = &now
+	return verreq, nil
+}
+
 func TestConfig_init(t *testing.T) {
 	type fields struct {
-		MailCfg           *awsses.Config
-		MobileCfg         *awssns.Config
 		MaxVerifyAttempts int
 		EmailOTPExpiry    time.Duration
 		MobileOTPExpiry   time.Duration
@@ -219,7 +267,7 @@ func TestVerifier_validate(t *testing.T) {
 	}
 }
 
-func Test_newID(t *testing.T) {
+func TestRandomSecretGenerator_ID(t *testing.T) {
 	regex := regexp.MustCompile("^[0-9a-zA-Z]{32}$")
 	tests := []struct {
 		name string
@@ -232,7 +280,10 @@ func Test_newID(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := newID()
+			got, err := (&RandomSecretGenerator{}).ID()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 			if !regex.MatchString(got) {
 				t.Fatalf("Expected 32 chr long alpha numeric random string, got '%s'", got)
 			}
@@ -329,3 +380,803 @@ func TestRequest_setStatus(t *testing.T) {
 		})
 	}
 }
+
+type mockattempts struct {
+	attempts []SendAttempt
+}
+
+func (ma *mockattempts) Error() string {
+	return "all providers failed"
+}
+
+func (ma *mockattempts) SendAttempts() []SendAttempt {
+	return ma.attempts
+}
+
+func TestRequest_setStatus_attempts(t *testing.T) {
+	failed := SendAttempt{Provider: "awssns", Error: "throttled"}
+	sent := SendAttempt{Provider: "twilio", Status: "SM123"}
+	tests := []struct {
+		name         string
+		status       interface{}
+		err          error
+		wantStatus   string
+		wantData     map[string]interface{}
+		wantProvider string
+		wantAttempts int
+	}{
+		{
+			name:         "sent after failover",
+			status:       &mockattempts{attempts: []SendAttempt{failed, sent}},
+			wantStatus:   "queued",
+			wantData:     map[string]interface{}{"status": "SM123"},
+			wantProvider: "twilio",
+			wantAttempts: 2,
+		},
+		{
+			name:         "all providers failed",
+			err:          fmt.Errorf("failed sending: %w", &mockattempts{attempts: []SendAttempt{failed}}),
+			wantStatus:   "failed",
+			wantData:     map[string]interface{}{"error": "failed sending: all providers failed"},
+			wantProvider: "awssns",
+			wantAttempts: 1,
+		},
+		{
+			name:         "single provider",
+			status:       "message-id",
+			wantStatus:   "queued",
+			wantData:     map[string]interface{}{"status": "message-id"},
+			wantProvider: "awssns",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Request{}
+			v.setStatus(tt.status, tt.err)
+			v.setProvider("awssns")
+
+			got := v.CommStatus[0]
+			if got.Status != tt.wantStatus {
+				t.Fatalf("expected status '%s', got '%s'", tt.wantStatus, got.Status)
+			}
+			if !reflect.DeepEqual(tt.wantData, got.Data) {
+				t.Fatalf("expected '%v', got '%v'", tt.wantData, got.Data)
+			}
+			if got.Provider != tt.wantProvider {
+				t.Fatalf("expected provider '%s', got '%s'", tt.wantProvider, got.Provider)
+			}
+			if len(got.Attempts) != tt.wantAttempts {
+				t.Fatalf("expected %d attempts, got %d", tt.wantAttempts, len(got.Attempts))
+			}
+		})
+	}
+}
+
+type ctxKey string
+
+type mockmobile struct {
+	ctx  context.Context
+	err  error
+	body string
+}
+
+func (mm *mockmobile) Send(ctx context.Context, recipient, body string) (interface{}, error) {
+	mm.ctx = ctx
+	mm.body = body
+	if mm.err != nil {
+		return nil, mm.err
+	}
+	return "message-id", nil
+}
+
+func TestVerifier_NewMobileContext(t *testing.T) {
+	const key = ctxKey("trace")
+	tests := []struct {
+		name      string
+		recipient string
+		wantErr   bool
+	}{
+		{
+			name:      "context propagated",
+			recipient: "+919876543210",
+		},
+		{
+			name:      "invalid mobile",
+			recipient: "abc",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mobile := &mockmobile{}
+			ver, err := New(
+				&Config{MobileOTPExpiry: time.Minute},
+				&mockstore{data: map[string]*Request{}},
+				nil,
+				mobile,
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			ctx := context.WithValue(context.Background(), key, tt.name)
+			err = ver.NewMobileContext(ctx, tt.recipient)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verifier.NewMobileContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if mobile.ctx == nil || mobile.ctx.Value(key) != tt.name {
+				t.Fatalf("expected context to be passed on to mobile service")
+			}
+		})
+	}
+}
+
+func TestVerifier_OpaqueErrors(t *testing.T) {
+	const recipient = "+919876543210"
+	tests := []struct {
+		name         string
+		opaque       bool
+		create       bool
+		wantErr      error
+		wantReqState verificationStatus
+	}{
+		{
+			name:         "invalid secret",
+			create:       true,
+			wantErr:      ErrInvalidSecret,
+			wantReqState: VerStatusRejected,
+		},
+		{
+			name:         "opaque invalid secret",
+			opaque:       true,
+			create:       true,
+			wantErr:      ErrVerificationFailed,
+			wantReqState: VerStatusRejected,
+		},
+		{
+			name:    "not found",
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "opaque not found",
+			opaque:  true,
+			wantErr: ErrVerificationFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verstore := &mockstore{data: map[string]*Request{}}
+			ver, err := New(
+				&Config{MobileOTPExpiry: time.Minute, OpaqueErrors: tt.opaque},
+				verstore,
+				nil,
+				&mockmobile{},
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			if tt.create {
+				err = ver.NewMobile(recipient)
+				if err != nil {
+					t.Fatalf("Verifier.NewMobile() error = %v", err)
+				}
+			}
+
+			err = ver.VerifyMobileSecret(recipient, "invalid")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+
+			if !tt.create {
+				return
+			}
+			got := verstore.data["mobile-"+recipient].Status
+			if got != tt.wantReqState {
+				t.Fatalf("expected status '%s', got '%s'", tt.wantReqState, got)
+			}
+		})
+	}
+}
+
+func TestVerifier_Resend(t *testing.T) {
+	const recipient = "+919876543210"
+	hasher, err := NewHMACHasher([]byte("pepper"))
+	if err != nil {
+		t.Fatalf("NewHMACHasher() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		cfg         Config
+		sentAgo     time.Duration
+		resends     int
+		expired     bool
+		wantErr     error
+		wantRotated bool
+	}{
+		{
+			name:    "same secret",
+			sentAgo: time.Minute,
+		},
+		{
+			name:        "rotated secret",
+			cfg:         Config{RotateSecretOnResend: true},
+			sentAgo:     time.Minute,
+			wantRotated: true,
+		},
+		{
+			name:        "hashed secret is always rotated",
+			cfg:         Config{SecretHasher: hasher},
+			sentAgo:     time.Minute,
+			wantRotated: true,
+		},
+		{
+			name:    "too soon",
+			sentAgo: time.Second,
+			wantErr: ErrResendTooSoon,
+		},
+		{
+			name:    "custom interval",
+			cfg:     Config{ResendInterval: time.Second * 2},
+			sentAgo: time.Second * 3,
+		},
+		{
+			name:    "maximum resends exceeded",
+			sentAgo: time.Minute,
+			resends: DefaultMaxResends,
+			wantErr: ErrMaximumResendsExceeded,
+		},
+		{
+			name:    "expired secret",
+			sentAgo: time.Minute,
+			expired: true,
+			wantErr: ErrSecretExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verstore := &mockstore{data: map[string]*Request{}}
+			cfg := tt.cfg
+			cfg.MobileOTPExpiry = time.Minute * 10
+			ver, err := New(&cfg, verstore, nil, &mockmobile{})
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			err = ver.NewMobile(recipient)
+			if err != nil {
+				t.Fatalf("Verifier.NewMobile() error = %v", err)
+			}
+
+			verreq := verstore.data["mobile-"+recipient]
+			sentAt := time.Now().Add(-tt.sentAgo)
+			verreq.LastSentAt = &sentAt
+			verreq.Resends = tt.resends
+			if tt.expired {
+				expiry := time.Now().Add(-time.Second)
+				verreq.SecretExpiry = &expiry
+			}
+			secret := verreq.Secret
+			sends := len(verreq.CommStatus)
+
+			err = ver.Resend(CommTypeMobile, recipient)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				// denied resends are not counted
+				if verreq.Resends != tt.resends || !verreq.LastSentAt.Equal(sentAt) {
+					t.Fatalf("expected resend %d at '%v', got %d at '%v'", tt.resends, sentAt, verreq.Resends, verreq.LastSentAt)
+				}
+				return
+			}
+
+			verreq = verstore.data["mobile-"+recipient]
+			if len(verreq.CommStatus) != sends+1 {
+				t.Fatalf("expected %d comm statuses, got %d", sends+1, len(verreq.CommStatus))
+			}
+			if rotated := verreq.Secret != secret; rotated != tt.wantRotated {
+				t.Fatalf("expected secret rotated %v, got %v", tt.wantRotated, rotated)
+			}
+			if verreq.PlainSecret() != "" {
+				t.Fatalf("expected plain text secret to be cleared after resending")
+			}
+			if verreq.Resends != tt.resends+1 || !verreq.LastSentAt.After(sentAt) {
+				t.Fatalf("expected resend %d after '%v', got %d at '%v'", tt.resends+1, sentAt, verreq.Resends, verreq.LastSentAt)
+			}
+		})
+	}
+}
+
+// updatefailingstore fails the updates with err, if it's set
+type updatefailingstore struct {
+	*mockstore
+	err error
+}
+
+func (ufs *updatefailingstore) Update(ctx context.Context, verID string, ver *Request) (*Request, error) {
+	if ufs.err != nil {
+		return nil, ufs.err
+	}
+	return ufs.mockstore.Update(ctx, verID, ver)
+}
+
+func TestVerifier_Resend_updateFailed(t *testing.T) {
+	const recipient = "+919876543210"
+	hasher, err := NewHMACHasher([]byte("pepper"))
+	if err != nil {
+		t.Fatalf("NewHMACHasher() error = %v", err)
+	}
+
+	for _, rotate := range []bool{false, true} {
+		cfg := &Config{MobileOTPExpiry: time.Minute, ResendInterval: time.Nanosecond}
+		if rotate {
+			cfg.SecretHasher = hasher
+		}
+		mobile := &mockqueuedmobile{}
+		verstore := &updatefailingstore{mockstore: &mockstore{data: map[string]*Request{}}}
+		ver, err := New(cfg, verstore, nil, mobile)
+		if err != nil {
+			t.Fatalf("failed initializing verifier: %v", err)
+		}
+
+		err = ver.NewMobile(recipient)
+		if err != nil {
+			t.Fatalf("Verifier.NewMobile() error = %v", err)
+		}
+
+		verstore.err = errors.New("connection refused")
+		err = ver.Resend(CommTypeMobile, recipient)
+		if !errors.Is(err, verstore.err) {
+			t.Fatalf("expected error '%v', got '%v'", verstore.err, err)
+		}
+
+		// a rotated secret is not sent unless it's persisted
+		wantSends := 2
+		if rotate {
+			wantSends = 1
+		}
+		if mobile.sends != wantSends {
+			t.Fatalf("expected %d sends, got %d", wantSends, mobile.sends)
+		}
+	}
+}
+
+type mockemail struct {
+	body string
+}
+
+func (me *mockemail) Send(ctx context.Context, sender, recipient, subject, body string) (interface{}, error) {
+	me.body = body
+	return "message-id", nil
+}
+
+func TestVerifier_VerifyByID(t *testing.T) {
+	const recipient = "john.doe@example.com"
+	tests := []struct {
+		name    string
+		status  verificationStatus
+		id      string
+		secret  string
+		wantErr error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:    "invalid secret",
+			secret:  "invalid",
+			wantErr: ErrInvalidSecret,
+		},
+		{
+			name:    "unknown ID",
+			id:      "unknown",
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "not pending",
+			status:  VerStatusVerified,
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := &mockemail{}
+			verstore := &mockstore{data: map[string]*Request{}}
+			ver, err := New(
+				&Config{
+					EmailOTPExpiry:      time.Minute,
+					EmailCallbackURL:    "https://example.com/verify",
+					EmailCallbackWithID: true,
+				},
+				verstore,
+				email,
+				nil,
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			err = ver.NewEmail(recipient, "")
+			if err != nil {
+				t.Fatalf("Verifier.NewEmail() error = %v", err)
+			}
+
+			verreq := verstore.data["email-"+recipient]
+			if strings.Contains(email.body, url.QueryEscape(recipient)) {
+				t.Fatalf("expected email address to not be in the callback URL")
+			}
+			callbackURL, err := EmailCallbackURLWithID("https://example.com/verify", verreq.ID, verreq.Secret)
+			if err != nil {
+				t.Fatalf("EmailCallbackURLWithID() error = %v", err)
+			}
+			// the HTML body is escaped by html/template
+			if !strings.Contains(email.body, html.EscapeString(callbackURL)) {
+				t.Fatalf("expected callback URL '%s' in the email body", callbackURL)
+			}
+
+			if tt.status != "" {
+				verreq.Status = tt.status
+			}
+			id := verreq.ID
+			if tt.id != "" {
+				id = tt.id
+			}
+			secret := verreq.Secret
+			if tt.secret != "" {
+				secret = tt.secret
+			}
+
+			err = ver.VerifyByID(id, secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// racingstore changes the status of requests just before their attempts are incremented or they're
+// updated, as a concurrent verification or cancellation would
+type racingstore struct {
+	*mockstore
+	onIncrement verificationStatus
+	onUpdate    verificationStatus
+}
+
+func (rs *racingstore) IncrementAttempts(ctx context.Context, verID string) (*Request, error) {
+	verreq, err := rs.ReadByID(ctx, verID)
+	if err != nil {
+		return nil, err
+	}
+	if rs.onIncrement != "" {
+		verreq.Status = rs.onIncrement
+	}
+	return rs.mockstore.IncrementAttempts(ctx, verID)
+}
+
+func (rs *racingstore) Update(ctx context.Context, verID string, ver *Request) (*Request, error) {
+	if rs.onUpdate != "" {
+		// ver is the request stored, since the mock store returns the requests stored
+		ver.Status = rs.onUpdate
+		return nil, ErrRequestNotPending
+	}
+	return rs.mockstore.Update(ctx, verID, ver)
+}
+
+func TestVerifier_VerifyByID_concurrent(t *testing.T) {
+	const recipient = "john.doe@example.com"
+	tests := []struct {
+		name        string
+		onIncrement verificationStatus
+		onUpdate    verificationStatus
+	}{
+		{
+			name:        "cancelled before attempt",
+			onIncrement: VerStatusCancelled,
+		},
+		{
+			name:     "verified before update",
+			onUpdate: VerStatusVerified,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verstore := &racingstore{mockstore: &mockstore{data: map[string]*Request{}}}
+			ver, err := New(
+				&Config{EmailOTPExpiry: time.Minute, EmailCallbackURL: "https://example.com/verify"},
+				verstore,
+				&mockemail{},
+				nil,
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			err = ver.NewEmail(recipient, "")
+			if err != nil {
+				t.Fatalf("Verifier.NewEmail() error = %v", err)
+			}
+
+			verified := false
+			ver.AddObserver(ObserverFunc(func(ctx context.Context, event Event) {
+				if event.Type == EventVerified {
+					verified = true
+				}
+			}))
+
+			verreq := verstore.data["email-"+recipient]
+			verstore.onIncrement = tt.onIncrement
+			verstore.onUpdate = tt.onUpdate
+			err = ver.VerifyByID(verreq.ID, verreq.Secret)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected error '%v', got '%v'", ErrNotFound, err)
+			}
+			if verified {
+				t.Fatalf("expected no '%s' event", EventVerified)
+			}
+		})
+	}
+}
+
+func TestVerifier_Cancel(t *testing.T) {
+	const recipient = "+919876543210"
+	tests := []struct {
+		name     string
+		status   verificationStatus
+		onUpdate verificationStatus
+		id       string
+		wantErr  error
+	}{
+		{
+			name: "pending",
+		},
+		{
+			name:    "not pending",
+			status:  VerStatusVerified,
+			wantErr: ErrRequestNotPending,
+		},
+		{
+			name:     "verified after read",
+			onUpdate: VerStatusVerified,
+			wantErr:  ErrRequestNotPending,
+		},
+		{
+			name:    "unknown ID",
+			id:      "unknown",
+			wantErr: ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verstore := &racingstore{mockstore: &mockstore{data: map[string]*Request{}}}
+			ver, err := New(&Config{MobileOTPExpiry: time.Minute}, verstore, nil, &mockmobile{})
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			err = ver.NewMobile(recipient)
+			if err != nil {
+				t.Fatalf("Verifier.NewMobile() error = %v", err)
+			}
+
+			verreq := verstore.data["mobile-"+recipient]
+			if tt.status != "" {
+				verreq.Status = tt.status
+			}
+			id := verreq.ID
+			if tt.id != "" {
+				id = tt.id
+			}
+
+			cancelled := false
+			ver.AddObserver(ObserverFunc(func(ctx context.Context, event Event) {
+				if event.Type == EventCancelled {
+					cancelled = true
+				}
+			}))
+			verstore.onUpdate = tt.onUpdate
+			err = ver.Cancel(id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				if cancelled {
+					t.Fatalf("expected no '%s' event", EventCancelled)
+				}
+				// the status set concurrently should not be overwritten
+				if tt.onUpdate != "" && verreq.Status != tt.onUpdate {
+					t.Fatalf("expected status '%s', got '%s'", tt.onUpdate, verreq.Status)
+				}
+				return
+			}
+
+			got, err := ver.Get(id)
+			if err != nil {
+				t.Fatalf("Verifier.Get() error = %v", err)
+			}
+			if got.Status != VerStatusCancelled {
+				t.Fatalf("expected status '%s', got '%s'", VerStatusCancelled, got.Status)
+			}
+			if got.Secret != "" {
+				t.Fatalf("expected secret to be removed")
+			}
+
+			// a cancelled request can no longer be verified
+			err = ver.VerifyByID(id, verreq.Secret)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected error '%v', got '%v'", ErrNotFound, err)
+			}
+		})
+	}
+}
+
+func TestVerifier_List(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    ListFilter
+		wantLimit int
+		wantLen   int
+	}{
+		{
+			name:      "default limit",
+			wantLimit: DefaultListLimit,
+			wantLen:   2,
+		},
+		{
+			name:      "maximum limit",
+			filter:    ListFilter{Limit: MaxListLimit + 1},
+			wantLimit: MaxListLimit,
+			wantLen:   2,
+		},
+		{
+			name:      "filtered",
+			filter:    ListFilter{Type: CommTypeMobile, Limit: 5},
+			wantLimit: 5,
+			wantLen:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verstore := &mockstore{data: map[string]*Request{}}
+			ver, err := New(
+				&Config{EmailOTPExpiry: time.Minute, MobileOTPExpiry: time.Minute},
+				verstore,
+				&mockemail{},
+				&mockmobile{},
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			err = ver.NewMobile("+919876543210")
+			if err != nil {
+				t.Fatalf("Verifier.NewMobile() error = %v", err)
+			}
+			err = ver.NewEmail("john.doe@example.com", "")
+			if err != nil {
+				t.Fatalf("Verifier.NewEmail() error = %v", err)
+			}
+
+			got, err := ver.List(tt.filter)
+			if err != nil {
+				t.Fatalf("Verifier.List() error = %v", err)
+			}
+			if verstore.filter.Limit != tt.wantLimit {
+				t.Fatalf("expected limit %d, got %d", tt.wantLimit, verstore.filter.Limit)
+			}
+			if len(got) != tt.wantLen {
+				t.Fatalf("expected %d requests, got %d", tt.wantLen, len(got))
+			}
+			for _, verreq := range got {
+				if verreq.Secret != "" {
+					t.Fatalf("expected secret to be removed")
+				}
+			}
+		})
+	}
+}
+
+func TestVerifier_AddObserver(t *testing.T) {
+	const recipient = "+919876543210"
+	errSend := errors.New("send failed")
+	tests := []struct {
+		name    string
+		sendErr error
+		expired bool
+		// verify is called with the secret of the request if true, else with an invalid secret
+		verify     bool
+		wantEvents []EventType
+		wantErr    error
+	}{
+		{
+			name:       "verified",
+			verify:     true,
+			wantEvents: []EventType{EventCreated, EventSent, EventVerified},
+		},
+		{
+			name:       "rejected",
+			wantEvents: []EventType{EventCreated, EventSent, EventRejected},
+			wantErr:    ErrInvalidSecret,
+		},
+		{
+			name:       "expired",
+			verify:     true,
+			expired:    true,
+			wantEvents: []EventType{EventCreated, EventSent, EventExpired},
+			wantErr:    ErrSecretExpired,
+		},
+		{
+			name:       "send failed",
+			sendErr:    errSend,
+			verify:     true,
+			wantEvents: []EventType{EventCreated, EventSendFailed, EventVerified},
+			wantErr:    errSend,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verstore := &mockstore{data: map[string]*Request{}}
+			ver, err := New(
+				&Config{MobileOTPExpiry: time.Minute},
+				verstore,
+				nil,
+				&mockmobile{err: tt.sendErr},
+			)
+			if err != nil {
+				t.Fatalf("failed initializing verifier: %v", err)
+			}
+
+			events := make([]Event, 0, len(tt.wantEvents))
+			ver.AddObserver(ObserverFunc(func(ctx context.Context, event Event) {
+				events = append(events, event)
+			}))
+
+			err = ver.NewMobile(recipient)
+			if !errors.Is(err, tt.sendErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.sendErr, err)
+			}
+
+			verreq := verstore.data["mobile-"+recipient]
+			if tt.expired {
+				expiry := time.Now().Add(-time.Second)
+				verreq.SecretExpiry = &expiry
+			}
+			secret := "invalid"
+			if tt.verify {
+				secret = verreq.Secret
+			}
+			err = ver.VerifyMobileSecret(recipient, secret)
+			if tt.sendErr == nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+
+			if len(events) != len(tt.wantEvents) {
+				t.Fatalf("expected %d events, got %d", len(tt.wantEvents), len(events))
+			}
+			for i, event := range events {
+				if event.Type != tt.wantEvents[i] {
+					t.Fatalf("expected event '%s', got '%s'", tt.wantEvents[i], event.Type)
+				}
+				if event.Request == nil || event.Request.ID != verreq.ID {
+					t.Fatalf("expected event of request '%s', got %v", verreq.ID, event.Request)
+				}
+				if event.Request.Secret != "" || event.Request.PlainSecret() != "" {
+					t.Fatalf("expected secret to be removed from the event's request")
+				}
+			}
+
+			last := events[len(events)-1]
+			if tt.wantErr != nil && tt.sendErr == nil && !errors.Is(last.Err, tt.wantErr) {
+				t.Fatalf("expected event error '%v', got '%v'", tt.wantErr, last.Err)
+			}
+			if tt.sendErr != nil && !errors.Is(events[1].Err, tt.sendErr) {
+				t.Fatalf("expected event error '%v', got '%v'", tt.sendErr, events[1].Err)
+			}
+		})
+	}
+}
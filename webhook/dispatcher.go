@@ -0,0 +1,427 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+	"github.com/naughtygopher/verifier/internal/backoff"
+)
+
+const (
+	// DefaultMaxAttempts is the default number of attempts of a delivery, before it's dead lettered
+	DefaultMaxAttempts = 8
+	// DefaultInitialBackoff is the default duration to wait before the first retry
+	DefaultInitialBackoff = time.Second
+	// DefaultMaxBackoff is the default maximum duration to wait between retries
+	DefaultMaxBackoff = time.Minute * 10
+	// DefaultTimeout is the default timeout of a single delivery attempt
+	DefaultTimeout = time.Second * 10
+	// DefaultPollInterval is the default interval at which the store is checked for due deliveries
+	DefaultPollInterval = time.Second
+	// DefaultConcurrency is the default maximum number of concurrent delivery attempts
+	DefaultConcurrency = 4
+)
+
+// Endpoint is a URL to which webhooks are delivered
+type Endpoint struct {
+	URL string `json:"url,omitempty"`
+	// Secret is used to sign the webhooks delivered to the endpoint
+	Secret string `json:"secret,omitempty"`
+	// Events are the events delivered to the endpoint, all events are delivered if empty
+	Events []verifier.EventType `json:"events,omitempty"`
+}
+
+func (ep *Endpoint) subscribed(etype verifier.EventType) bool {
+	if len(ep.Events) == 0 {
+		return true
+	}
+	for _, e := range ep.Events {
+		if e == etype {
+			return true
+		}
+	}
+	return false
+}
+
+// Config is the configuration of the dispatcher, all fields except Endpoints are optional
+type Config struct {
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+	// MaxAttempts is the number of attempts of a delivery, after which it's dead lettered
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// InitialBackoff is the duration to wait before the first retry, it's doubled for every
+	// subsequent retry till MaxBackoff
+	InitialBackoff time.Duration `json:"initialBackoff,omitempty"`
+	MaxBackoff     time.Duration `json:"maxBackoff,omitempty"`
+	// Timeout is the timeout of a single delivery attempt
+	Timeout      time.Duration `json:"timeout,omitempty"`
+	PollInterval time.Duration `json:"pollInterval,omitempty"`
+	Concurrency  int           `json:"concurrency,omitempty"`
+	HTTPClient   *http.Client  `json:"-"`
+	// OnError is called with the errors which cannot be returned, e.g. of persisting a delivery
+	// or of a failed delivery attempt
+	OnError func(err error) `json:"-"`
+}
+
+func (cfg *Config) init() {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = DefaultInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+}
+
+// Dispatcher delivers verifier events to the configured endpoints. It implements verifier.Observer,
+// and every event observed is persisted in the store in the background, so that Observe does not
+// wait for the store. Close waits for the observed events to be persisted. Deliveries are at least
+// once, receivers can use the delivery ID to ignore duplicates
+type Dispatcher struct {
+	cfg       Config
+	store     Store
+	endpoints map[string]Endpoint
+	now       func() time.Time
+
+	mu sync.Mutex
+	// inflight has the IDs of the deliveries being attempted, so they're not picked up again
+	inflight map[string]bool
+	started  bool
+	// unsaved are the deliveries observed which are yet to be saved in the store
+	unsaved []*Delivery
+	// saving is set while the deliveries are being saved, & saved is signalled once it's reset
+	saving bool
+	saved  *sync.Cond
+
+	wake    chan struct{}
+	stop    chan struct{}
+	workers sync.WaitGroup
+	slots   chan struct{}
+}
+
+func (dis *Dispatcher) onError(err error) {
+	if dis.cfg.OnError != nil {
+		dis.cfg.OnError(err)
+	}
+}
+
+// Observe queues a delivery of the event for every endpoint subscribed to it, to be persisted in
+// the background
+func (dis *Dispatcher) Observe(ctx context.Context, event verifier.Event) {
+	payload := Payload{
+		Type:    event.Type,
+		Time:    event.Time,
+		Request: event.Request,
+	}
+	if event.Err != nil {
+		payload.Error = event.Err.Error()
+	}
+
+	deliveries := make([]*Delivery, 0, len(dis.cfg.Endpoints))
+	for _, ep := range dis.cfg.Endpoints {
+		if !ep.subscribed(event.Type) {
+			continue
+		}
+
+		delivery, err := dis.newDelivery(ep.URL, payload)
+		if err != nil {
+			dis.onError(err)
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
+	dis.unsaved = append(dis.unsaved, deliveries...)
+	if !dis.saving {
+		dis.saving = true
+		go dis.save()
+	}
+}
+
+func (dis *Dispatcher) newDelivery(url string, payload Payload) (*Delivery, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	payload.ID = id
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed encoding webhook payload: %w", err)
+	}
+
+	now := dis.now()
+	return &Delivery{
+		ID:            id,
+		URL:           url,
+		Event:         payload.Type,
+		Payload:       body,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
+
+// save saves the observed deliveries in the store, till there are none left
+func (dis *Dispatcher) save() {
+	for {
+		dis.mu.Lock()
+		deliveries := dis.unsaved
+		dis.unsaved = nil
+		if len(deliveries) == 0 {
+			dis.saving = false
+			dis.saved.Broadcast()
+			dis.mu.Unlock()
+			return
+		}
+		dis.mu.Unlock()
+
+		for _, delivery := range deliveries {
+			err := dis.store.Save(context.Background(), delivery)
+			if err != nil {
+				dis.onError(fmt.Errorf("failed saving webhook delivery: %w", err))
+			}
+		}
+		dis.notify()
+	}
+}
+
+// flush waits for the observed deliveries to be saved in the store
+func (dis *Dispatcher) flush() {
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
+	for dis.saving {
+		dis.saved.Wait()
+	}
+}
+
+// notify wakes up the dispatcher to check for due deliveries, without waiting for the poll interval
+func (dis *Dispatcher) notify() {
+	select {
+	case dis.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start starts delivering the pending deliveries in the background, including the ones persisted
+// before a restart. Close should be called to stop it
+func (dis *Dispatcher) Start() {
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
+	if dis.started {
+		return
+	}
+	dis.started = true
+
+	dis.workers.Add(1)
+	go dis.loop()
+}
+
+// Close stops the dispatcher, and waits for the observed events to be persisted & the delivery
+// attempts in progress to complete. Pending deliveries remain in the store, and are delivered once
+// a dispatcher is started again
+func (dis *Dispatcher) Close() error {
+	dis.flush()
+
+	dis.mu.Lock()
+	started := dis.started
+	dis.started = false
+	dis.mu.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	dis.stop <- struct{}{}
+	dis.workers.Wait()
+	return nil
+}
+
+func (dis *Dispatcher) loop() {
+	defer dis.workers.Done()
+
+	ticker := time.NewTicker(dis.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		dis.dispatchDue()
+		select {
+		case <-dis.stop:
+			return
+		case <-ticker.C:
+		case <-dis.wake:
+		}
+	}
+}
+
+// dispatchDue starts delivery attempts of the due deliveries which are not in flight, as long as
+// there are free slots
+func (dis *Dispatcher) dispatchDue() {
+	due, err := dis.store.Due(context.Background(), dis.now(), dis.cfg.Concurrency*2)
+	if err != nil {
+		dis.onError(fmt.Errorf("failed reading due webhook deliveries: %w", err))
+		return
+	}
+
+	for _, delivery := range due {
+		dis.mu.Lock()
+		inflight := dis.inflight[delivery.ID]
+		if !inflight {
+			dis.inflight[delivery.ID] = true
+		}
+		dis.mu.Unlock()
+		if inflight {
+			continue
+		}
+
+		select {
+		case dis.slots <- struct{}{}:
+		default:
+			// all slots are in use, the remaining deliveries are picked up once a slot is free
+			dis.mu.Lock()
+			delete(dis.inflight, delivery.ID)
+			dis.mu.Unlock()
+			return
+		}
+
+		dis.workers.Add(1)
+		go func(delivery *Delivery) {
+			defer func() {
+				dis.mu.Lock()
+				delete(dis.inflight, delivery.ID)
+				dis.mu.Unlock()
+				<-dis.slots
+				dis.workers.Done()
+				dis.notify()
+			}()
+			dis.attempt(context.Background(), delivery)
+		}(delivery)
+	}
+}
+
+// attempt makes a single delivery attempt, and updates the delivery in the store as per the result
+func (dis *Dispatcher) attempt(ctx context.Context, delivery *Delivery) {
+	err := dis.deliver(ctx, delivery)
+	if err == nil {
+		err = dis.store.Delete(ctx, delivery.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			dis.onError(fmt.Errorf("failed deleting webhook delivery %s: %w", delivery.ID, err))
+		}
+		return
+	}
+
+	dis.onError(fmt.Errorf("failed delivering webhook %s to %s: %w", delivery.ID, delivery.URL, err))
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= dis.cfg.MaxAttempts || errors.Is(err, ErrUnknownEndpoint) {
+		err = dis.store.DeadLetter(ctx, delivery)
+		if err != nil {
+			dis.onError(fmt.Errorf("failed dead lettering webhook delivery %s: %w", delivery.ID, err))
+		}
+		return
+	}
+
+	delivery.NextAttemptAt = dis.now().Add(backoff.Exponential(delivery.Attempts, dis.cfg.InitialBackoff, dis.cfg.MaxBackoff))
+	err = dis.store.Save(ctx, delivery)
+	if err != nil {
+		dis.onError(fmt.Errorf("failed saving webhook delivery %s: %w", delivery.ID, err))
+	}
+}
+
+// deliver POSTs the signed payload to the endpoint, any response other than 2xx is a failure
+func (dis *Dispatcher) deliver(ctx context.Context, delivery *Delivery) error {
+	ep, ok := dis.endpoints[delivery.URL]
+	if !ok {
+		return ErrUnknownEndpoint
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dis.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	now := dis.now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(delivery.Event))
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign([]byte(ep.Secret), now, delivery.Payload))
+
+	resp, err := dis.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the body is drained so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// New returns a new dispatcher which persists the deliveries in the store. Start should be
+// called for the deliveries to be made
+func New(cfg *Config, store Store) (*Dispatcher, error) {
+	if store == nil {
+		return nil, errors.New("webhook store is required")
+	}
+
+	dis := &Dispatcher{
+		cfg:       *cfg,
+		store:     store,
+		endpoints: make(map[string]Endpoint, len(cfg.Endpoints)),
+		now:       time.Now,
+		inflight:  map[string]bool{},
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+	dis.saved = sync.NewCond(&dis.mu)
+	dis.cfg.init()
+	dis.slots = make(chan struct{}, dis.cfg.Concurrency)
+
+	for _, ep := range dis.cfg.Endpoints {
+		if ep.URL == "" {
+			return nil, errors.New("webhook endpoint URL is required")
+		}
+		if ep.Secret == "" {
+			return nil, fmt.Errorf("secret of webhook endpoint %s is required", ep.URL)
+		}
+		dis.endpoints[ep.URL] = ep
+	}
+
+	return dis, nil
+}
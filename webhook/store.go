@@ -0,0 +1,343 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store persists the deliveries, so that pending deliveries are not lost on restart
+type Store interface {
+	// Save creates or updates a pending delivery
+	Save(ctx context.Context, delivery *Delivery) error
+	// Due returns at most limit pending deliveries which are due to be attempted at now, oldest first
+	Due(ctx context.Context, now time.Time, limit int) ([]*Delivery, error)
+	// Delete removes a pending delivery, once it's delivered
+	Delete(ctx context.Context, id string) error
+	// DeadLetter moves a pending delivery to the dead letters, once all its attempts fail
+	DeadLetter(ctx context.Context, delivery *Delivery) error
+	// DeadLetters returns all the dead letters, oldest first
+	DeadLetters(ctx context.Context) ([]*Delivery, error)
+}
+
+func sortDeliveries(deliveries []*Delivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].ID < deliveries[j].ID
+		}
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+}
+
+func cloneDelivery(delivery *Delivery) *Delivery {
+	clone := *delivery
+	clone.Payload = append([]byte(nil), delivery.Payload...)
+	return &clone
+}
+
+// MemoryStore keeps the deliveries in memory, deliveries are lost on restart. It's meant for tests
+// & local development
+type MemoryStore struct {
+	mu          sync.Mutex
+	pending     map[string]*Delivery
+	deadLetters map[string]*Delivery
+}
+
+// Save creates or updates a pending delivery
+func (ms *MemoryStore) Save(ctx context.Context, delivery *Delivery) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.pending[delivery.ID] = cloneDelivery(delivery)
+	return nil
+}
+
+// Due returns at most limit pending deliveries which are due to be attempted at now, oldest first
+func (ms *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]*Delivery, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	due := make([]*Delivery, 0, len(ms.pending))
+	for _, delivery := range ms.pending {
+		if !delivery.NextAttemptAt.After(now) {
+			due = append(due, cloneDelivery(delivery))
+		}
+	}
+	sortDeliveries(due)
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Delete removes a pending delivery
+func (ms *MemoryStore) Delete(ctx context.Context, id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.pending[id]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.pending, id)
+	return nil
+}
+
+// DeadLetter moves a pending delivery to the dead letters
+func (ms *MemoryStore) DeadLetter(ctx context.Context, delivery *Delivery) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.pending, delivery.ID)
+	ms.deadLetters[delivery.ID] = cloneDelivery(delivery)
+	return nil
+}
+
+// DeadLetters returns all the dead letters, oldest first
+func (ms *MemoryStore) DeadLetters(ctx context.Context) ([]*Delivery, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	deadLetters := make([]*Delivery, 0, len(ms.deadLetters))
+	for _, delivery := range ms.deadLetters {
+		deadLetters = append(deadLetters, cloneDelivery(delivery))
+	}
+	sortDeliveries(deadLetters)
+	return deadLetters, nil
+}
+
+// NewMemoryStore returns a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		pending:     map[string]*Delivery{},
+		deadLetters: map[string]*Delivery{},
+	}
+}
+
+// FileStore keeps every delivery as a JSON file in a directory, so that pending deliveries survive
+// restarts. Pending deliveries are in the 'pending' sub directory, and dead letters in 'dead'.
+// Files which cannot be decoded are moved to the 'corrupt' sub directory, so that they do not
+// block the other deliveries. The due times of the pending deliveries are indexed in memory, so
+// that only the due deliveries are read from the disk
+type FileStore struct {
+	pendingDir string
+	deadDir    string
+	corruptDir string
+	// mu serializes writes, so that a delivery is not moved while it's being saved
+	mu sync.Mutex
+	// index has the pending deliveries by their ID, without the payload
+	index map[string]*Delivery
+}
+
+// write writes the delivery to the directory atomically, by writing to a temporary file first
+func (fs *FileStore) write(dir string, delivery *Delivery) error {
+	payload, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(payload)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fs.path(dir, delivery.ID))
+}
+
+// fileName returns the name of the file of the delivery
+func fileName(id string) string {
+	// IDs are generated by the dispatcher, this only guards against path traversal
+	return filepath.Base(id) + ".json"
+}
+
+func (fs *FileStore) path(dir, id string) string {
+	return filepath.Join(dir, fileName(id))
+}
+
+// read reads the delivery from the file. A file which cannot be decoded is moved to the corrupt
+// directory, and ErrNotFound is returned
+func (fs *FileStore) read(dir, name string) (*Delivery, error) {
+	path := filepath.Join(dir, name)
+	payload, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// deleted after reading the directory
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &Delivery{}
+	err = json.Unmarshal(payload, delivery)
+	if err == nil {
+		return delivery, nil
+	}
+
+	err = os.Rename(path, filepath.Join(fs.corruptDir, name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return nil, ErrNotFound
+}
+
+// readAll reads all the deliveries in the directory
+func (fs *FileStore) readAll(dir string) ([]*Delivery, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*Delivery, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		delivery, err := fs.read(dir, entry.Name())
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	sortDeliveries(deliveries)
+	return deliveries, nil
+}
+
+// indexed returns the delivery to be kept in the index, i.e. without the payload
+func indexed(delivery *Delivery) *Delivery {
+	clone := *delivery
+	clone.Payload = nil
+	return &clone
+}
+
+// Save creates or updates a pending delivery
+func (fs *FileStore) Save(ctx context.Context, delivery *Delivery) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	err := fs.write(fs.pendingDir, delivery)
+	if err != nil {
+		return err
+	}
+	fs.index[delivery.ID] = indexed(delivery)
+	return nil
+}
+
+// Due returns at most limit pending deliveries which are due to be attempted at now, oldest first
+func (fs *FileStore) Due(ctx context.Context, now time.Time, limit int) ([]*Delivery, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	candidates := make([]*Delivery, 0, limit)
+	for _, delivery := range fs.index {
+		if !delivery.NextAttemptAt.After(now) {
+			candidates = append(candidates, delivery)
+		}
+	}
+	sortDeliveries(candidates)
+
+	due := make([]*Delivery, 0, limit)
+	for _, candidate := range candidates {
+		if len(due) == limit {
+			break
+		}
+
+		delivery, err := fs.read(fs.pendingDir, fileName(candidate.ID))
+		if errors.Is(err, ErrNotFound) {
+			// removed or corrupt, either way it cannot be delivered
+			delete(fs.index, candidate.ID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, delivery)
+	}
+
+	return due, nil
+}
+
+// Delete removes a pending delivery
+func (fs *FileStore) Delete(ctx context.Context, id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.index, id)
+	err := os.Remove(fs.path(fs.pendingDir, id))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// DeadLetter moves a pending delivery to the dead letters
+func (fs *FileStore) DeadLetter(ctx context.Context, delivery *Delivery) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	err := fs.write(fs.deadDir, delivery)
+	if err != nil {
+		return err
+	}
+
+	delete(fs.index, delivery.ID)
+	err = os.Remove(fs.path(fs.pendingDir, delivery.ID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// DeadLetters returns all the dead letters, oldest first
+func (fs *FileStore) DeadLetters(ctx context.Context) ([]*Delivery, error) {
+	return fs.readAll(fs.deadDir)
+}
+
+// NewFileStore returns a store which keeps the deliveries in the directory, creating it if required.
+// The pending deliveries are read once, to index their due times
+func NewFileStore(dir string) (*FileStore, error) {
+	fs := &FileStore{
+		pendingDir: filepath.Join(dir, "pending"),
+		deadDir:    filepath.Join(dir, "dead"),
+		corruptDir: filepath.Join(dir, "corrupt"),
+		index:      map[string]*Delivery{},
+	}
+
+	for _, d := range []string{fs.pendingDir, fs.deadDir, fs.corruptDir} {
+		err := os.MkdirAll(d, 0o700)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pending, err := fs.readAll(fs.pendingDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, delivery := range pending {
+		fs.index[delivery.ID] = indexed(delivery)
+	}
+
+	return fs, nil
+}
@@ -0,0 +1,105 @@
+// Package webhook delivers verifier events to HTTP endpoints. Every event is POSTed as JSON, signed
+// using HMAC-SHA256 with the endpoint's secret. Deliveries are persisted in a Store before they're
+// attempted, retried with exponential backoff, and moved to dead letters once all attempts fail
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+const (
+	// HeaderEvent is the header with the type of the event
+	HeaderEvent = "X-Verifier-Event"
+	// HeaderDelivery is the header with the ID of the delivery, which is the same across retries
+	HeaderDelivery = "X-Verifier-Delivery"
+	// HeaderTimestamp is the header with the unix time (in seconds) at which the request was signed
+	HeaderTimestamp = "X-Verifier-Timestamp"
+	// HeaderSignature is the header with the signature, 'sha256=<hex encoded HMAC-SHA256>' of
+	// '<timestamp>.<body>'
+	HeaderSignature = "X-Verifier-Signature"
+)
+
+var (
+	// ErrInvalidSignature is the error returned when the signature of a webhook is invalid
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrTimestampTolerance is the error returned when the timestamp of a webhook is not within the tolerance
+	ErrTimestampTolerance = errors.New("webhook timestamp not within tolerance")
+	// ErrNotFound is the error returned by stores when the delivery does not exist
+	ErrNotFound = errors.New("webhook delivery not found")
+	// ErrUnknownEndpoint is the error of deliveries whose endpoint is not configured anymore
+	ErrUnknownEndpoint = errors.New("webhook endpoint not configured")
+)
+
+// Payload is the JSON body of a webhook
+type Payload struct {
+	// ID is the ID of the delivery, receivers can use it to ignore duplicate deliveries
+	ID    string             `json:"id"`
+	Type  verifier.EventType `json:"type"`
+	Time  time.Time          `json:"time"`
+	Error string             `json:"error,omitempty"`
+	// Request is the verification request, without the secret
+	Request *verifier.Request `json:"request"`
+}
+
+// Delivery is a webhook to be delivered to an endpoint
+type Delivery struct {
+	ID string `json:"id"`
+	// URL is the URL of the endpoint, the secret of the endpoint is not persisted
+	URL     string             `json:"url"`
+	Event   verifier.EventType `json:"event"`
+	Payload []byte             `json:"payload"`
+
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	LastError     string    `json:"lastError,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Sign returns the signature of the body, signed at timestamp
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify verifies the signature of a webhook received, and that it was signed within tolerance
+// of now. It's meant to be used by receivers of the webhooks
+func Verify(secret []byte, header http.Header, body []byte, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	timestamp := time.Unix(unix, 0)
+	if diff := time.Since(timestamp); diff > tolerance || diff < -tolerance {
+		return ErrTimestampTolerance
+	}
+
+	want := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(want), []byte(header.Get(HeaderSignature))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("failed generating delivery ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
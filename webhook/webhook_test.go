@@ -0,0 +1,458 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/naughtygopher/verifier"
+)
+
+const testSecret = "whsec"
+
+// waitFor waits till cond returns true, or fails the test after a few seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within deadline")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// receiver is a webhook receiver which responds with the statuses in order, and 200 thereafter
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	payloads []Payload
+	errs     []error
+	calls    atomic.Int32
+}
+
+func (rec *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.calls.Add(1)
+	body, _ := io.ReadAll(r.Body)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	err := Verify([]byte(testSecret), r.Header, body, time.Minute)
+	if err != nil {
+		rec.errs = append(rec.errs, err)
+	}
+
+	if len(rec.statuses) > 0 {
+		status := rec.statuses[0]
+		rec.statuses = rec.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+
+	payload := Payload{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		rec.errs = append(rec.errs, err)
+	}
+	if r.Header.Get(HeaderDelivery) != payload.ID || r.Header.Get(HeaderEvent) != string(payload.Type) {
+		rec.errs = append(rec.errs, errors.New("headers do not match the payload"))
+	}
+	rec.payloads = append(rec.payloads, payload)
+}
+
+func (rec *receiver) received() []Payload {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]Payload(nil), rec.payloads...)
+}
+
+func testEvent(etype verifier.EventType) verifier.Event {
+	return verifier.Event{
+		Type:    etype,
+		Request: &verifier.Request{ID: "req-1", Type: verifier.CommTypeMobile, Recipient: "+919876543210"},
+		Time:    time.Now(),
+	}
+}
+
+func newTestDispatcher(t *testing.T, cfg *Config, store Store) *Dispatcher {
+	t.Helper()
+	cfg.PollInterval = time.Millisecond * 10
+	cfg.InitialBackoff = time.Millisecond
+	cfg.MaxBackoff = time.Millisecond * 5
+	dis, err := New(cfg, store)
+	if err != nil {
+		t.Fatalf("failed initializing dispatcher: %v", err)
+	}
+	return dis
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := time.Now()
+	header := func(timestamp time.Time, signature string) http.Header {
+		h := http.Header{}
+		h.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+		h.Set(HeaderSignature, signature)
+		return h
+	}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			header: header(now, Sign([]byte(testSecret), now, body)),
+			body:   body,
+		},
+		{
+			name:    "tampered body",
+			header:  header(now, Sign([]byte(testSecret), now, body)),
+			body:    []byte(`{"id":"2"}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "different secret",
+			header:  header(now, Sign([]byte("other"), now, body)),
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "different timestamp",
+			header:  header(now, Sign([]byte(testSecret), now.Add(-time.Second*2), body)),
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "stale",
+			header:  header(now.Add(-time.Hour), Sign([]byte(testSecret), now.Add(-time.Hour), body)),
+			body:    body,
+			wantErr: ErrTimestampTolerance,
+		},
+		{
+			name:    "missing headers",
+			header:  http.Header{},
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify([]byte(testSecret), tt.header, tt.body, time.Minute)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error '%v', got '%v'", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Observe(t *testing.T) {
+	all := &receiver{}
+	allSrv := httptest.NewServer(all)
+	defer allSrv.Close()
+
+	verified := &receiver{}
+	verifiedSrv := httptest.NewServer(verified)
+	defer verifiedSrv.Close()
+
+	dis := newTestDispatcher(t, &Config{
+		Endpoints: []Endpoint{
+			{URL: allSrv.URL, Secret: testSecret},
+			{URL: verifiedSrv.URL, Secret: testSecret, Events: []verifier.EventType{verifier.EventVerified}},
+		},
+	}, NewMemoryStore())
+	dis.Start()
+	defer dis.Close()
+
+	rejected := testEvent(verifier.EventRejected)
+	rejected.Err = verifier.ErrInvalidSecretHash
+	dis.Observe(context.Background(), rejected)
+	dis.Observe(context.Background(), testEvent(verifier.EventVerified))
+
+	waitFor(t, func() bool { return len(all.received()) == 2 && len(verified.received()) == 1 })
+
+	for _, rec := range []*receiver{all, verified} {
+		if len(rec.errs) > 0 {
+			t.Fatalf("unexpected errors in receiver: %v", rec.errs)
+		}
+	}
+
+	got := verified.received()[0]
+	if got.Type != verifier.EventVerified {
+		t.Fatalf("expected event '%s', got '%s'", verifier.EventVerified, got.Type)
+	}
+	if got.Request == nil || got.Request.ID != "req-1" {
+		t.Fatalf("expected request 'req-1', got %+v", got.Request)
+	}
+
+	for _, got := range all.received() {
+		if got.Type == verifier.EventRejected && got.Error != verifier.ErrInvalidSecretHash.Error() {
+			t.Fatalf("expected error '%s', got '%s'", verifier.ErrInvalidSecretHash, got.Error)
+		}
+	}
+}
+
+func TestDispatcher_retries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		// wantCalls is the number of delivery attempts expected
+		wantCalls      int
+		wantDelivered  bool
+		wantDeadLetter bool
+	}{
+		{
+			name:          "delivered after retries",
+			statuses:      []int{http.StatusInternalServerError, http.StatusBadGateway},
+			wantCalls:     3,
+			wantDelivered: true,
+		},
+		{
+			name:           "dead lettered",
+			statuses:       []int{500, 500, 500, 500},
+			wantCalls:      3,
+			wantDeadLetter: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &receiver{statuses: tt.statuses}
+			srv := httptest.NewServer(rec)
+			defer srv.Close()
+
+			store := NewMemoryStore()
+			dis := newTestDispatcher(t, &Config{
+				Endpoints:   []Endpoint{{URL: srv.URL, Secret: testSecret}},
+				MaxAttempts: 3,
+			}, store)
+			dis.Start()
+			defer dis.Close()
+
+			dis.Observe(context.Background(), testEvent(verifier.EventVerified))
+
+			waitFor(t, func() bool {
+				if tt.wantDelivered {
+					return len(rec.received()) == 1
+				}
+				dead, _ := store.DeadLetters(context.Background())
+				return len(dead) == 1
+			})
+			dis.Close()
+
+			if got := int(rec.calls.Load()); got != tt.wantCalls {
+				t.Fatalf("expected %d calls, got %d", tt.wantCalls, got)
+			}
+
+			pending, _ := store.Due(context.Background(), time.Now().Add(time.Hour), 10)
+			if len(pending) != 0 {
+				t.Fatalf("expected no pending deliveries, got %d", len(pending))
+			}
+
+			if !tt.wantDeadLetter {
+				return
+			}
+			dead, _ := store.DeadLetters(context.Background())
+			if dead[0].Attempts != 3 || dead[0].LastError == "" {
+				t.Fatalf("expected 3 attempts with the last error, got %d & '%s'", dead[0].Attempts, dead[0].LastError)
+			}
+		})
+	}
+}
+
+func TestDispatcher_restart(t *testing.T) {
+	rec := &receiver{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := &Config{Endpoints: []Endpoint{{URL: srv.URL, Secret: testSecret}}}
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("failed initializing file store: %v", err)
+	}
+	// the dispatcher is not started, as if the process exited before the delivery was attempted
+	dis := newTestDispatcher(t, cfg, store)
+	dis.Observe(context.Background(), testEvent(verifier.EventVerified))
+	// Close waits for the observed event to be persisted, even if the dispatcher was not started
+	dis.Close()
+
+	store, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("failed initializing file store: %v", err)
+	}
+	dis = newTestDispatcher(t, cfg, store)
+	dis.Start()
+	defer dis.Close()
+
+	waitFor(t, func() bool { return len(rec.received()) == 1 })
+
+	dis.Close()
+	pending, err := store.Due(context.Background(), time.Now().Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("Store.Due() error = %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending deliveries, got %d", len(pending))
+	}
+}
+
+func TestDispatcher_unknownEndpoint(t *testing.T) {
+	store := NewMemoryStore()
+	err := store.Save(context.Background(), &Delivery{ID: "1", URL: "http://removed.example.com"})
+	if err != nil {
+		t.Fatalf("Store.Save() error = %v", err)
+	}
+
+	dis := newTestDispatcher(t, &Config{}, store)
+	dis.Start()
+	defer dis.Close()
+
+	waitFor(t, func() bool {
+		dead, _ := store.DeadLetters(context.Background())
+		return len(dead) == 1
+	})
+}
+
+func TestStores(t *testing.T) {
+	fstore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed initializing file store: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		store Store
+	}{
+		{name: "memory", store: NewMemoryStore()},
+		{name: "file", store: fstore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().Round(0)
+
+			for i, next := range []time.Duration{0, -time.Minute, time.Minute} {
+				err := tt.store.Save(ctx, &Delivery{
+					ID:            strconv.Itoa(i),
+					Payload:       []byte(`{}`),
+					NextAttemptAt: now.Add(next),
+					CreatedAt:     now.Add(time.Duration(i) * time.Second),
+				})
+				if err != nil {
+					t.Fatalf("Store.Save() error = %v", err)
+				}
+			}
+
+			due, err := tt.store.Due(ctx, now, 10)
+			if err != nil {
+				t.Fatalf("Store.Due() error = %v", err)
+			}
+			if len(due) != 2 || due[0].ID != "0" || due[1].ID != "1" {
+				t.Fatalf("expected deliveries 0 & 1 due, got %+v", due)
+			}
+
+			due, _ = tt.store.Due(ctx, now, 1)
+			if len(due) != 1 {
+				t.Fatalf("expected 1 delivery within the limit, got %d", len(due))
+			}
+
+			err = tt.store.Delete(ctx, "0")
+			if err != nil {
+				t.Fatalf("Store.Delete() error = %v", err)
+			}
+			err = tt.store.Delete(ctx, "0")
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected error '%v', got '%v'", ErrNotFound, err)
+			}
+
+			due, _ = tt.store.Due(ctx, now, 10)
+			if len(due) != 1 || due[0].ID != "1" {
+				t.Fatalf("expected only delivery 1 due, got %+v", due)
+			}
+			due[0].Attempts = 3
+			err = tt.store.DeadLetter(ctx, due[0])
+			if err != nil {
+				t.Fatalf("Store.DeadLetter() error = %v", err)
+			}
+
+			due, _ = tt.store.Due(ctx, now.Add(time.Hour), 10)
+			if len(due) != 1 || due[0].ID != "2" {
+				t.Fatalf("expected only delivery 2 pending, got %+v", due)
+			}
+
+			dead, err := tt.store.DeadLetters(ctx)
+			if err != nil {
+				t.Fatalf("Store.DeadLetters() error = %v", err)
+			}
+			if len(dead) != 1 || dead[0].ID != "1" || dead[0].Attempts != 3 {
+				t.Fatalf("expected delivery 1 dead lettered, got %+v", dead)
+			}
+		})
+	}
+}
+
+func TestFileStore_corrupt(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Now().Round(0)
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("failed initializing file store: %v", err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		err = store.Save(ctx, &Delivery{ID: id, Payload: []byte(`{}`), NextAttemptAt: now, CreatedAt: now})
+		if err != nil {
+			t.Fatalf("Store.Save() error = %v", err)
+		}
+	}
+
+	// corrupted before the store is opened
+	err = os.WriteFile(filepath.Join(dir, "pending", "1.json"), []byte("{"), 0o600)
+	if err != nil {
+		t.Fatalf("failed corrupting delivery: %v", err)
+	}
+	store, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("failed initializing file store: %v", err)
+	}
+
+	// corrupted after the store is opened
+	err = os.WriteFile(filepath.Join(dir, "pending", "2.json"), []byte("{"), 0o600)
+	if err != nil {
+		t.Fatalf("failed corrupting delivery: %v", err)
+	}
+
+	due, err := store.Due(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("Store.Due() error = %v", err)
+	}
+	if len(due) != 1 || due[0].ID != "3" {
+		t.Fatalf("expected only delivery 3 due, got %+v", due)
+	}
+
+	for _, name := range []string{"1.json", "2.json"} {
+		_, err = os.Stat(filepath.Join(dir, "corrupt", name))
+		if err != nil {
+			t.Fatalf("expected %s moved to the corrupt directory, got error %v", name, err)
+		}
+		_, err = os.Stat(filepath.Join(dir, "pending", name))
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %s removed from the pending directory, got error %v", name, err)
+		}
+	}
+}